@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/secrethub/secrethub-cli/internals/secrethub"
+
+	"github.com/secrethub/secrethub-go/internals/assert"
+)
+
+// handleErrorEnv selects the error that is handled in a subprocess of TestHandleError.
+const handleErrorEnv = "TEST_HANDLE_ERROR"
+
+func TestHandleError(t *testing.T) {
+	switch os.Getenv(handleErrorEnv) {
+	case "exit":
+		handleError(secrethub.ExitError{Code: 2})
+		return
+	case "error":
+		handleError(errors.New("failure"))
+		return
+	}
+
+	cases := map[string]struct {
+		code   int
+		stderr string
+	}{
+		"exit": {
+			code: 2,
+		},
+		"error": {
+			code:   1,
+			stderr: "Encountered an error: failure\n",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cmd := exec.Command(os.Args[0], "-test.run=^TestHandleError$")
+			cmd.Env = append(os.Environ(), handleErrorEnv+"="+name)
+			var stderr strings.Builder
+			cmd.Stderr = &stderr
+
+			err := cmd.Run()
+			exitErr, ok := err.(*exec.ExitError)
+			assert.Equal(t, ok, true)
+			assert.Equal(t, exitErr.ExitCode(), tc.code)
+			assert.Equal(t, stderr.String(), tc.stderr)
+		})
+	}
+}
@@ -0,0 +1,255 @@
+// Package diff provides line based unified diffs of text.
+package diff
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// contextLines is the number of unchanged lines shown around a change.
+const contextLines = 3
+
+// op is an operation in the edit script that turns one text into another.
+type op struct {
+	kind byte // ' ' for an unchanged line, '-' for a removed line and '+' for an added line.
+	line string
+}
+
+// Unified returns the unified diff of the texts from and to, with the given names
+// in the header. An empty string is returned when the texts are equal.
+func Unified(fromName, toName, from, to string) string {
+	if from == to {
+		return ""
+	}
+
+	ops := editScript(splitLines(from), splitLines(to))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", fromName, toName)
+
+	// fromLine and toLine are the number of lines of from and to before ops[i].
+	fromLine, toLine := 0, 0
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			fromLine++
+			toLine++
+			i++
+			continue
+		}
+
+		// Start the hunk with the unchanged lines before the change.
+		start := i - contextLines
+		if start < 0 {
+			start = 0
+		}
+		end := hunkEnd(ops, i)
+
+		hunkFromStart, hunkToStart := fromLine-(i-start), toLine-(i-start)
+		hunkFromLen, hunkToLen := 0, 0
+		for _, o := range ops[start:end] {
+			if o.kind != '+' {
+				hunkFromLen++
+			}
+			if o.kind != '-' {
+				hunkToLen++
+			}
+		}
+
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n", hunkRange(hunkFromStart, hunkFromLen), hunkRange(hunkToStart, hunkToLen))
+		for _, o := range ops[start:end] {
+			b.WriteByte(o.kind)
+			b.WriteString(o.line)
+			if !strings.HasSuffix(o.line, "\n") {
+				b.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+
+		for _, o := range ops[i:end] {
+			if o.kind != '+' {
+				fromLine++
+			}
+			if o.kind != '-' {
+				toLine++
+			}
+		}
+		i = end
+	}
+
+	return b.String()
+}
+
+// hunkEnd returns the end of the hunk of which the first change is at ops[i].
+// Changes that are separated by at most twice the number of context lines
+// are in the same hunk.
+func hunkEnd(ops []op, i int) int {
+	for {
+		for i < len(ops) && ops[i].kind != ' ' {
+			i++
+		}
+
+		unchanged := 0
+		for i+unchanged < len(ops) && ops[i+unchanged].kind == ' ' {
+			unchanged++
+		}
+
+		if i+unchanged == len(ops) || unchanged > 2*contextLines {
+			if unchanged > contextLines {
+				unchanged = contextLines
+			}
+			return i + unchanged
+		}
+		i += unchanged
+	}
+}
+
+// hunkRange formats the start and length of a hunk in the header of the hunk.
+// The start is the number of the first line of the hunk, or the line before
+// the hunk when the hunk is empty.
+func hunkRange(start, length int) string {
+	if length == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if length == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, length)
+}
+
+// splitLines splits the text into lines that include their newline.
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// editScript returns the shortest edit script from the lines a to the lines b.
+// Within every change, the removed lines come before the added lines.
+func editScript(a, b []string) []op {
+	ops := appendEditScript(make([]op, 0, len(a)+len(b)), a, b)
+
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+
+		j := i
+		for j < len(ops) && ops[j].kind != ' ' {
+			j++
+		}
+		change := ops[i:j]
+		sort.SliceStable(change, func(x, y int) bool {
+			return change[x].kind == '-' && change[y].kind == '+'
+		})
+		i = j
+	}
+	return ops
+}
+
+// appendEditScript appends the shortest edit script from the lines a to the lines b to ops.
+// It uses the linear space variant of Myers' O(ND) difference algorithm: the edit script is
+// split at its middle snake, after which both halves are solved in the same way.
+func appendEditScript(ops []op, a, b []string) []op {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		ops = append(ops, op{kind: ' ', line: a[prefix]})
+		prefix++
+	}
+	a, b = a[prefix:], b[prefix:]
+
+	suffix := 0
+	for suffix < len(a) && suffix < len(b) && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	common := a[len(a)-suffix:]
+	a, b = a[:len(a)-suffix], b[:len(b)-suffix]
+
+	switch {
+	case len(a) == 0:
+		for _, line := range b {
+			ops = append(ops, op{kind: '+', line: line})
+		}
+	case len(b) == 0:
+		for _, line := range a {
+			ops = append(ops, op{kind: '-', line: line})
+		}
+	default:
+		x, y, u, v := middleSnake(a, b)
+		ops = appendEditScript(ops, a[:x], b[:y])
+		for _, line := range a[x:u] {
+			ops = append(ops, op{kind: ' ', line: line})
+		}
+		ops = appendEditScript(ops, a[u:], b[v:])
+	}
+
+	for _, line := range common {
+		ops = append(ops, op{kind: ' ', line: line})
+	}
+	return ops
+}
+
+// middleSnake returns the start (x, y) and the end (u, v) of the middle snake of the
+// shortest edit script from the lines a to the lines b, which are both non-empty and do
+// not start or end with the same line. A snake is a diagonal of unchanged lines in the
+// edit graph. The middle snake is found by searching for the shortest edit script
+// from the start and from the end at the same time, until both searches overlap.
+func middleSnake(a, b []string) (x, y, u, v int) {
+	n, m := len(a), len(b)
+	max := (n + m + 1) / 2
+	delta := n - m
+	odd := delta%2 != 0
+
+	// forward[offset+k] is the furthest x reached on diagonal k = x - y from the start.
+	// backward[offset+k] is the same for the reversed lines, i.e. searching from the end.
+	offset := max + 1
+	forward := make([]int, 2*max+3)
+	backward := make([]int, 2*max+3)
+
+	for d := 0; d <= max; d++ {
+		for k := -d; k <= d; k += 2 {
+			if k == -d || (k != d && forward[offset+k-1] < forward[offset+k+1]) {
+				x = forward[offset+k+1]
+			} else {
+				x = forward[offset+k-1] + 1
+			}
+			y = x - k
+			u, v = x, y
+			for u < n && v < m && a[u] == b[v] {
+				u++
+				v++
+			}
+			forward[offset+k] = u
+
+			// The diagonal k corresponds to the diagonal delta - k of the reversed lines.
+			if odd && delta-k >= -(d-1) && delta-k <= d-1 && u+backward[offset+delta-k] >= n {
+				return x, y, u, v
+			}
+		}
+
+		for k := -d; k <= d; k += 2 {
+			var rx int
+			if k == -d || (k != d && backward[offset+k-1] < backward[offset+k+1]) {
+				rx = backward[offset+k+1]
+			} else {
+				rx = backward[offset+k-1] + 1
+			}
+			ry := rx - k
+			ru, rv := rx, ry
+			for ru < n && rv < m && a[n-1-ru] == b[m-1-rv] {
+				ru++
+				rv++
+			}
+			backward[offset+k] = ru
+
+			if !odd && delta-k >= -d && delta-k <= d && forward[offset+delta-k]+ru >= n {
+				return n - ru, m - rv, n - rx, m - ry
+			}
+		}
+	}
+
+	// This cannot happen, as the searches overlap after at most n + m edits in total.
+	panic("diff: no middle snake found")
+}
@@ -0,0 +1,77 @@
+package diff
+
+import (
+	"testing"
+
+	"github.com/secrethub/secrethub-go/internals/assert"
+)
+
+func TestUnified(t *testing.T) {
+	cases := map[string]struct {
+		from     string
+		to       string
+		expected string
+	}{
+		"equal": {
+			from:     "a\nb\n",
+			to:       "a\nb\n",
+			expected: "",
+		},
+		"changed line": {
+			from: "a\nb\nc\n",
+			to:   "a\nB\nc\n",
+			expected: "--- old\n+++ new\n" +
+				"@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		},
+		"from empty": {
+			from: "",
+			to:   "a\nb\n",
+			expected: "--- old\n+++ new\n" +
+				"@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		"to empty": {
+			from: "a\n",
+			to:   "",
+			expected: "--- old\n+++ new\n" +
+				"@@ -1 +0,0 @@\n-a\n",
+		},
+		"no newline at end of file": {
+			from: "a\nb",
+			to:   "a\nb\n",
+			expected: "--- old\n+++ new\n" +
+				"@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n",
+		},
+		"separate hunks": {
+			from: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			to:   "one\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\ntwelve\n",
+			expected: "--- old\n+++ new\n" +
+				"@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n 4\n" +
+				"@@ -9,4 +9,4 @@\n 9\n 10\n 11\n-12\n+twelve\n",
+		},
+		"merged hunks": {
+			from: "1\n2\n3\n4\n5\n6\n7\n8\n",
+			to:   "one\n2\n3\n4\n5\n6\n7\neight\n",
+			expected: "--- old\n+++ new\n" +
+				"@@ -1,8 +1,8 @@\n-1\n+one\n 2\n 3\n 4\n 5\n 6\n 7\n-8\n+eight\n",
+		},
+		"inserted lines": {
+			from: "1\n2\n3\n4\n5\n",
+			to:   "1\n2\n3\nthree and a half\n4\n5\n",
+			expected: "--- old\n+++ new\n" +
+				"@@ -1,5 +1,6 @@\n 1\n 2\n 3\n+three and a half\n 4\n 5\n",
+		},
+		"interleaved changes": {
+			from: "a\nb\nc\na\nb\nb\na\n",
+			to:   "c\nb\na\nb\na\nc\n",
+			expected: "--- old\n+++ new\n" +
+				"@@ -1,7 +1,6 @@\n-a\n+c\n b\n-c\n a\n b\n-b\n a\n+c\n",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			actual := Unified("old", "new", tc.from, tc.to)
+			assert.Equal(t, actual, tc.expected)
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package masker
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Encoding returns encoded variants of a value that should be masked as well.
+type Encoding func(value []byte) [][]byte
+
+// encodings contains all supported encodings by name.
+var encodings = map[string]Encoding{
+	"base64": encodeBase64,
+	"url":    encodeURL,
+	"json":   encodeJSON,
+	"hex":    encodeHex,
+}
+
+// EncodingNames returns the names of all supported encodings in alphabetical order.
+func EncodingNames() []string {
+	names := make([]string, 0, len(encodings))
+	for name := range encodings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseEncodings returns the encodings with the given names.
+// An error is returned when an encoding is not supported.
+func ParseEncodings(names []string) ([]Encoding, error) {
+	res := make([]Encoding, 0, len(names))
+	for _, name := range names {
+		encoding, ok := encodings[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return nil, fmt.Errorf("unknown encoding %s, supported encodings are: %s", name, strings.Join(EncodingNames(), ", "))
+		}
+		res = append(res, encoding)
+	}
+	return res, nil
+}
+
+// WithEncodings returns the given masks together with all distinct variants of them.
+// These are the masks with their line endings normalized to both LF and CRLF and
+// the encoded values of all of these variants for each of the given encodings.
+func WithEncodings(masks [][]byte, encodings ...Encoding) [][]byte {
+	seen := make(map[string]struct{})
+	var res [][]byte
+	add := func(variants ...[]byte) {
+		for _, variant := range variants {
+			if len(variant) == 0 {
+				continue
+			}
+			_, found := seen[string(variant)]
+			if !found {
+				seen[string(variant)] = struct{}{}
+				res = append(res, variant)
+			}
+		}
+	}
+
+	for _, mask := range masks {
+		variants := append([][]byte{mask}, lineEndingVariants(mask)...)
+		add(variants...)
+		for _, variant := range variants {
+			for _, encode := range encodings {
+				add(encode(variant)...)
+			}
+		}
+	}
+	return res
+}
+
+// lineEndingVariants returns the value with its line endings normalized to LF and to CRLF.
+// When the value does not contain any line endings, no variants are returned.
+func lineEndingVariants(value []byte) [][]byte {
+	if !bytes.Contains(value, []byte("\n")) {
+		return nil
+	}
+
+	lf := bytes.Replace(value, []byte("\r\n"), []byte("\n"), -1)
+	crlf := bytes.Replace(lf, []byte("\n"), []byte("\r\n"), -1)
+	return [][]byte{lf, crlf}
+}
+
+// encodeBase64 returns the value encoded with the standard and the URL-safe
+// base64 alphabets, both with and without padding.
+func encodeBase64(value []byte) [][]byte {
+	return [][]byte{
+		[]byte(base64.StdEncoding.EncodeToString(value)),
+		[]byte(base64.RawStdEncoding.EncodeToString(value)),
+		[]byte(base64.URLEncoding.EncodeToString(value)),
+		[]byte(base64.RawURLEncoding.EncodeToString(value)),
+	}
+}
+
+// encodeURL returns the value escaped for use in a URL query and in a URL path.
+func encodeURL(value []byte) [][]byte {
+	return [][]byte{
+		[]byte(url.QueryEscape(string(value))),
+		[]byte(url.PathEscape(string(value))),
+	}
+}
+
+// encodeJSON returns the value escaped as the contents of a JSON string,
+// both with and without escaping HTML characters.
+func encodeJSON(value []byte) [][]byte {
+	var res [][]byte
+	for _, escapeHTML := range []bool{true, false} {
+		var buf bytes.Buffer
+		encoder := json.NewEncoder(&buf)
+		encoder.SetEscapeHTML(escapeHTML)
+		err := encoder.Encode(string(value))
+		if err != nil {
+			continue
+		}
+
+		// Strip the surrounding quotes and the trailing newline added by the encoder.
+		encoded := bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+		res = append(res, encoded[1:len(encoded)-1])
+	}
+	return res
+}
+
+// encodeHex returns the value encoded as lowercase and uppercase hexadecimal.
+func encodeHex(value []byte) [][]byte {
+	encoded := hex.EncodeToString(value)
+	return [][]byte{
+		[]byte(encoded),
+		[]byte(strings.ToUpper(encoded)),
+	}
+}
@@ -0,0 +1,107 @@
+package masker
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/secrethub/secrethub-go/internals/assert"
+)
+
+func TestWithEncodings(t *testing.T) {
+	cases := map[string]struct {
+		masks     []string
+		encodings []string
+		expected  []string
+	}{
+		"no encodings": {
+			masks:    []string{"foo"},
+			expected: []string{"foo"},
+		},
+		"base64": {
+			masks:     []string{"fo?"},
+			encodings: []string{"base64"},
+			expected:  []string{"fo?", "Zm8/", "Zm8_"},
+		},
+		"base64 padding": {
+			masks:     []string{"fo"},
+			encodings: []string{"base64"},
+			expected:  []string{"fo", "Zm8=", "Zm8"},
+		},
+		"url": {
+			masks:     []string{"a b&c"},
+			encodings: []string{"url"},
+			expected:  []string{"a b&c", "a+b%26c", "a%20b&c"},
+		},
+		"json": {
+			masks:     []string{`a"b<`},
+			encodings: []string{"json"},
+			expected:  []string{`a"b<`, `a\"b\u003c`, `a\"b<`},
+		},
+		"hex": {
+			masks:     []string{"\xab"},
+			encodings: []string{"hex"},
+			expected:  []string{"\xab", "ab", "AB"},
+		},
+		"unchanged by encoding": {
+			masks:     []string{"foo"},
+			encodings: []string{"url", "json"},
+			expected:  []string{"foo"},
+		},
+		"line endings": {
+			masks:    []string{"foo\nbar\r\nbaz"},
+			expected: []string{"foo\nbar\r\nbaz", "foo\nbar\nbaz", "foo\r\nbar\r\nbaz"},
+		},
+		"line endings encoded": {
+			masks:     []string{"a\nb"},
+			encodings: []string{"json"},
+			expected:  []string{"a\nb", "a\r\nb", `a\nb`, `a\r\nb`},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			encodings, err := ParseEncodings(tc.encodings)
+			assert.OK(t, err)
+
+			var masks [][]byte
+			for _, mask := range tc.masks {
+				masks = append(masks, []byte(mask))
+			}
+
+			var actual []string
+			for _, mask := range WithEncodings(masks, encodings...) {
+				actual = append(actual, string(mask))
+			}
+
+			assert.Equal(t, actual, tc.expected)
+		})
+	}
+}
+
+func TestParseEncodings(t *testing.T) {
+	_, err := ParseEncodings([]string{"base64", " HEX "})
+	assert.OK(t, err)
+
+	_, err = ParseEncodings([]string{"rot13"})
+	assert.Equal(t, err, errors.New("unknown encoding rot13, supported encodings are: base64, hex, json, url"))
+}
+
+func TestNewMaskedWriter_Encodings(t *testing.T) {
+	encodings, err := ParseEncodings(EncodingNames())
+	assert.OK(t, err)
+
+	masks := WithEncodings([][]byte{[]byte("pass word")}, encodings...)
+
+	var buf bytes.Buffer
+	w := NewMaskedWriter(&buf, masks, maskString, 0)
+	go w.Run()
+
+	_, err = w.Write([]byte("cGFzcyB3b3Jk pass%20word 7061737320776f7264"))
+	assert.OK(t, err)
+
+	err = w.Flush()
+	assert.OK(t, err)
+
+	assert.Equal(t, buf.String(), maskString+" "+maskString+" "+maskString)
+}
@@ -0,0 +1,217 @@
+package masker
+
+// matcher is an interface used by MaskedWriter to find matches of sequences to mask.
+type matcher interface {
+	// Read takes in a new byte to match against. If the byte completes one or more
+	// matches, the length of the longest match is returned. A match of a sequence
+	// that overlaps the previous match of the same sequence is skipped.
+	Read(byte) int
+	// Matches returns the indices of all sequences matched by the last call to Read.
+	Matches() []int
+	// Pending returns the number of most recently read bytes that could still
+	// become part of a match.
+	Pending() int
+	// Reset forgets any match in progress.
+	Reset()
+}
+
+// acEdge is a transition from one node in the automaton to another.
+type acEdge struct {
+	b  byte
+	to int32
+}
+
+// acNode is a node in the trie of the Aho-Corasick automaton.
+type acNode struct {
+	edges []acEdge
+	// fail is the node representing the longest proper suffix of this node's
+	// prefix that is also in the trie.
+	fail int32
+	// depth is the length of the prefix this node represents.
+	depth int32
+	// outputs contains the indices of the sequences ending at this node, including
+	// the sequences ending at the nodes of its failure links, from longest to shortest.
+	outputs []int32
+	// pending is the length of the longest suffix of this node's prefix that
+	// can still be extended to a match.
+	pending int32
+	// table contains the next node for every byte, including transitions
+	// through failure links. It is only set for nodes with many edges, as
+	// these are the nodes that are most expensive to search.
+	table *[256]int32
+}
+
+// child returns the node reached from the node by the given byte, if any.
+func (n *acNode) child(b byte) (int32, bool) {
+	for _, e := range n.edges {
+		if e.b == b {
+			return e.to, true
+		}
+	}
+	return 0, false
+}
+
+// denseEdges is the number of edges from which a node gets a transition table.
+const denseEdges = 4
+
+// multiMatcher finds all occurrences of a set of sequences in a stream of bytes
+// in a single pass, using an Aho-Corasick automaton.
+type multiMatcher struct {
+	nodes []acNode
+	// lengths contains the length of every sequence.
+	lengths []int
+	state   int32
+	// pos is the number of bytes that have been read.
+	pos int
+	// ends contains for every sequence the position right after its last match.
+	ends []int
+	// matched contains the indices of the sequences matched by the last call to Read,
+	// from longest to shortest.
+	matched []int
+}
+
+// newMultiMatcher constructs a matcher for the given sequences. Empty sequences are ignored.
+func newMultiMatcher(sequences [][]byte) *multiMatcher {
+	m := &multiMatcher{
+		nodes:   []acNode{{}},
+		lengths: make([]int, len(sequences)),
+		ends:    make([]int, len(sequences)),
+	}
+
+	// Build the trie.
+	for i, seq := range sequences {
+		if len(seq) == 0 {
+			continue
+		}
+
+		current := int32(0)
+		for _, b := range seq {
+			next, ok := m.nodes[current].child(b)
+			if !ok {
+				next = int32(len(m.nodes))
+				m.nodes = append(m.nodes, acNode{
+					depth: m.nodes[current].depth + 1,
+				})
+				m.nodes[current].edges = append(m.nodes[current].edges, acEdge{b: b, to: next})
+			}
+			current = next
+		}
+		m.nodes[current].outputs = append(m.nodes[current].outputs, int32(i))
+		m.lengths[i] = len(seq)
+	}
+
+	// Compute the failure links breadth-first, so that the failure link of a
+	// node is always computed before the failure links of its children.
+	m.nodes[0].table = m.transitions(0)
+	queue := make([]int32, 0, len(m.nodes))
+	for _, e := range m.nodes[0].edges {
+		m.complete(e.to)
+		queue = append(queue, e.to)
+	}
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		for _, e := range m.nodes[current].edges {
+			m.nodes[e.to].fail = m.next(m.nodes[current].fail, e.b)
+			m.complete(e.to)
+			queue = append(queue, e.to)
+		}
+	}
+
+	return m
+}
+
+// complete computes the fields of a node that depend on its failure link.
+// The failure link of the node must already be computed.
+func (m *multiMatcher) complete(node int32) {
+	n := &m.nodes[node]
+	fail := &m.nodes[n.fail]
+
+	// The sequences ending at the failure link are suffixes of the sequences ending at this node.
+	n.outputs = append(n.outputs, fail.outputs...)
+
+	if len(n.edges) > 0 {
+		n.pending = n.depth
+	} else {
+		n.pending = fail.pending
+	}
+
+	if len(n.edges) >= denseEdges {
+		n.table = m.transitions(node)
+	}
+}
+
+// transitions returns the next node for every byte from the given node.
+func (m *multiMatcher) transitions(node int32) *[256]int32 {
+	var table [256]int32
+	for b := range table {
+		if node != 0 {
+			table[b] = m.next(m.nodes[node].fail, byte(b))
+		}
+	}
+	for _, e := range m.nodes[node].edges {
+		table[e.b] = e.to
+	}
+	return &table
+}
+
+// next returns the node reached from the given node by the given byte,
+// following failure links when there is no direct transition.
+func (m *multiMatcher) next(node int32, b byte) int32 {
+	for {
+		n := &m.nodes[node]
+		if n.table != nil {
+			return n.table[b]
+		}
+
+		next, ok := n.child(b)
+		if ok {
+			return next
+		}
+		node = n.fail
+	}
+}
+
+// Read takes in a new byte to match against.
+// If the given byte completes a match with one or more sequences, the length of the longest
+// of these sequences is returned. Like with matching every sequence on its own, a match of
+// a sequence is skipped when it overlaps the previous match of that sequence.
+func (m *multiMatcher) Read(in byte) int {
+	m.pos++
+	m.state = m.next(m.state, in)
+	m.matched = m.matched[:0]
+
+	longest := 0
+	for _, i := range m.nodes[m.state].outputs {
+		length := m.lengths[i]
+		if m.pos-length < m.ends[i] {
+			continue
+		}
+		m.ends[i] = m.pos
+		m.matched = append(m.matched, int(i))
+		if length > longest {
+			longest = length
+		}
+	}
+	return longest
+}
+
+// Matches returns the indices of all sequences matched by the last call to Read,
+// from longest to shortest. The result is only valid until the next call to Read.
+func (m *multiMatcher) Matches() []int {
+	return m.matched
+}
+
+// Pending returns the length of the longest partial match.
+//
+// For example, if the sequence is "foobar" and the registered input is "foob", Pending() returns 4.
+func (m *multiMatcher) Pending() int {
+	return int(m.nodes[m.state].pending)
+}
+
+// Reset forgets the current match.
+func (m *multiMatcher) Reset() {
+	m.state = 0
+}
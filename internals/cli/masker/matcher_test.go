@@ -0,0 +1,250 @@
+package masker
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/secrethub/secrethub-go/internals/assert"
+)
+
+func TestMatcher(t *testing.T) {
+	tests := []struct {
+		matchString     string
+		input           string
+		useReset        bool
+		resetIndex      int
+		expectedMatches []int
+	}{
+		{
+			matchString:     "test",
+			input:           "test",
+			expectedMatches: []int{0},
+		},
+		{
+			matchString:     "test",
+			input:           "ttest",
+			expectedMatches: []int{1},
+		},
+		{
+			matchString:     "test",
+			input:           "testtest",
+			expectedMatches: []int{0, 4},
+		},
+		{
+			matchString:     "testtest",
+			input:           "test",
+			expectedMatches: nil,
+		},
+		{
+			matchString:     "foofoobar",
+			input:           "foofoofoobar",
+			expectedMatches: []int{3},
+		},
+		{
+			matchString:     "test",
+			input:           "123 testtest",
+			expectedMatches: []int{4, 8},
+		},
+		{
+			matchString:     "test",
+			input:           "t est",
+			expectedMatches: nil,
+		},
+		{
+			matchString:     "test",
+			input:           "tesat",
+			expectedMatches: nil,
+		},
+		{
+			matchString:     "test",
+			input:           "tesT",
+			expectedMatches: nil,
+		},
+		{
+			matchString:     "t",
+			input:           "ttattt",
+			expectedMatches: []int{0, 1, 3, 4, 5},
+		},
+		{
+			matchString:     "tt",
+			input:           "ttattt",
+			expectedMatches: []int{0, 3},
+		},
+		{
+			matchString:     "test",
+			input:           "test",
+			useReset:        true,
+			resetIndex:      0,
+			expectedMatches: []int{0},
+		},
+		{
+			matchString:     "test",
+			input:           "test",
+			useReset:        true,
+			resetIndex:      1,
+			expectedMatches: nil,
+		},
+		{
+			matchString:     "test",
+			input:           "testtest",
+			useReset:        true,
+			resetIndex:      1,
+			expectedMatches: []int{4},
+		},
+	}
+
+	for _, tc := range tests {
+		name := fmt.Sprintf("%s in %s", tc.matchString, tc.input)
+
+		t.Run(name, func(t *testing.T) {
+			matcher := newMultiMatcher([][]byte{[]byte(tc.matchString)})
+			var matches []int
+			for i, b := range []byte(tc.input) {
+				if tc.useReset && tc.resetIndex == i {
+					matcher.Reset()
+				}
+
+				matchedBytes := matcher.Read(b)
+				if matchedBytes > 0 {
+					matches = append(matches, i-len(tc.matchString)+1)
+				}
+			}
+			assert.Equal(t, matches, tc.expectedMatches)
+		})
+	}
+}
+
+func TestMultiMatcher(t *testing.T) {
+	cases := map[string]struct {
+		sequences []string
+		input     string
+		// expected contains the number of matched bytes for every byte of the input.
+		expected []int
+		// pending contains the pending bytes after every byte of the input.
+		pending []int
+	}{
+		"disjoint": {
+			sequences: []string{"ab", "cd"},
+			input:     "abcd",
+			expected:  []int{0, 2, 0, 2},
+			pending:   []int{1, 0, 1, 0},
+		},
+		"prefix": {
+			sequences: []string{"foo", "foobar"},
+			input:     "foobar",
+			expected:  []int{0, 0, 3, 0, 0, 6},
+			pending:   []int{1, 2, 3, 4, 5, 0},
+		},
+		"suffix": {
+			sequences: []string{"bar", "obar"},
+			input:     "foobar",
+			expected:  []int{0, 0, 0, 0, 0, 4},
+			pending:   []int{0, 1, 1, 2, 3, 0},
+		},
+		"within": {
+			sequences: []string{"testfoobar", "oob"},
+			input:     "testfoob",
+			expected:  []int{0, 0, 0, 0, 0, 0, 0, 3},
+			pending:   []int{1, 2, 3, 4, 5, 6, 7, 8},
+		},
+		"failure link": {
+			sequences: []string{"abcd", "bce"},
+			input:     "abce",
+			expected:  []int{0, 0, 0, 3},
+			pending:   []int{1, 2, 3, 0},
+		},
+		"empty sequence": {
+			sequences: []string{"", "a"},
+			input:     "ba",
+			expected:  []int{0, 1},
+			pending:   []int{0, 0},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var sequences [][]byte
+			for _, seq := range tc.sequences {
+				sequences = append(sequences, []byte(seq))
+			}
+			matcher := newMultiMatcher(sequences)
+
+			var actual, pending []int
+			for _, b := range []byte(tc.input) {
+				actual = append(actual, matcher.Read(b))
+				pending = append(pending, matcher.Pending())
+			}
+
+			assert.Equal(t, actual, tc.expected)
+			assert.Equal(t, pending, tc.pending)
+		})
+	}
+}
+
+func BenchmarkMaskedWriter(b *testing.B) {
+	for _, n := range []int{1, 100, 1000} {
+		b.Run(fmt.Sprintf("%d masks", n), func(b *testing.B) {
+			benchmarkMaskedWriter(b, n)
+		})
+	}
+}
+
+// benchmarkMaskedWriter measures the throughput of a MaskedWriter with the given
+// number of masks, writing log lines of which some contain a secret.
+func benchmarkMaskedWriter(b *testing.B, n int) {
+	r := rand.New(rand.NewSource(1))
+	randomString := func(length int) []byte {
+		const chars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+		res := make([]byte, length)
+		for i := range res {
+			res[i] = chars[r.Intn(len(chars))]
+		}
+		return res
+	}
+
+	masks := make([][]byte, n)
+	for i := range masks {
+		masks[i] = randomString(16 + r.Intn(16))
+	}
+
+	var input bytes.Buffer
+	for input.Len() < 1<<20 {
+		input.WriteString(time.Unix(r.Int63n(1<<31), 0).UTC().Format(time.RFC3339))
+		input.WriteString(" INFO ")
+		input.Write(randomString(r.Intn(100)))
+		if r.Intn(10) == 0 {
+			input.Write(masks[r.Intn(n)])
+		}
+		input.WriteString("\n")
+	}
+
+	const chunkSize = 32 * 1024
+	data := input.Bytes()
+
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w := NewMaskedWriter(ioutil.Discard, masks, maskString, time.Second)
+		go w.Run()
+
+		for offset := 0; offset < len(data); offset += chunkSize {
+			end := offset + chunkSize
+			if end > len(data) {
+				end = len(data)
+			}
+			_, err := w.Write(data[offset:end])
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+
+		err := w.Flush()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -7,69 +7,6 @@ import (
 	"time"
 )
 
-// matcher is an interface used by MaskedWriter to find matches of sequences to mask.
-type matcher interface {
-	Read(byte) int
-	InProgress() bool
-	Reset()
-}
-
-type sequenceMatcher struct {
-	sequence     []byte
-	currentIndex int
-}
-
-// Read takes in a new byte to match against.
-// If the given byte results in a match with sequence, the number of matched bytes is returned.
-func (m *sequenceMatcher) Read(in byte) int {
-	if m.sequence[m.currentIndex] == in {
-		m.currentIndex++
-
-		if m.currentIndex == len(m.sequence) {
-			m.currentIndex = 0
-			return len(m.sequence)
-		}
-		return 0
-	}
-
-	m.currentIndex -= m.findShift()
-	if m.sequence[m.currentIndex] == in {
-		return m.Read(in)
-	}
-	return 0
-}
-
-// findShift checks whether we can also make a partial match by decreasing the currentIndex .
-// For example, if the sequence is foofoobar, if someone inserts foofoofoobar, we still want to match.
-// So after the third f is inserted, the currentIndex is decreased by 3 with the following code.
-func (m *sequenceMatcher) findShift() int {
-	for offset := 1; offset <= m.currentIndex; offset++ {
-		ok := true
-		for i := 0; i < m.currentIndex-offset; i++ {
-			if m.sequence[i] != m.sequence[i+offset] {
-				ok = false
-				break
-			}
-		}
-		if ok {
-			return offset
-		}
-	}
-	return m.currentIndex
-}
-
-// InProgress returns whether this sequenceMatcher is currently partially matching.
-//
-// For example, if the sequence is "foobar" and the registered input is "foob", InProgress() returns true.
-func (m *sequenceMatcher) InProgress() bool {
-	return m.currentIndex > 0
-}
-
-// Reset forgets the current match.
-func (m *sequenceMatcher) Reset() {
-	m.currentIndex = 0
-}
-
 // maskByte represents a byte and whether the byte should be masked or not.
 type maskByte struct {
 	byte
@@ -82,7 +19,10 @@ type maskByte struct {
 type MaskedWriter struct {
 	w          io.Writer
 	maskString string
-	matchers   []matcher
+	masks      [][]byte
+	matches    []int
+	matcher    matcher
+	matcherMu  sync.Mutex
 	timeout    time.Duration
 
 	buf             []maskByte
@@ -95,16 +35,12 @@ type MaskedWriter struct {
 
 // NewMaskedWriter returns a new MaskedWriter that masks all occurrences of sequences in masks with maskString.
 func NewMaskedWriter(w io.Writer, masks [][]byte, maskString string, timeout time.Duration) *MaskedWriter {
-	matchers := make([]matcher, len(masks))
-	for i, mask := range masks {
-		matchers[i] = &sequenceMatcher{
-			sequence: mask,
-		}
-	}
 	return &MaskedWriter{
 		w:               w,
 		maskString:      maskString,
-		matchers:        matchers,
+		masks:           masks,
+		matches:         make([]int, len(masks)),
+		matcher:         newMultiMatcher(masks),
 		timeout:         timeout,
 		errCh:           make(chan error, 1),
 		outputTimeoutCh: make(chan struct{}, 1),
@@ -113,6 +49,36 @@ func NewMaskedWriter(w io.Writer, masks [][]byte, maskString string, timeout tim
 	}
 }
 
+// AddMasks adds sequences to mask to the MaskedWriter.
+// It can safely be called while the MaskedWriter is running. Only output
+// processed after the call returns is checked for the added sequences.
+func (mw *MaskedWriter) AddMasks(masks [][]byte) {
+	mw.matcherMu.Lock()
+	defer mw.matcherMu.Unlock()
+
+	mw.masks = append(mw.masks, masks...)
+	mw.matches = append(mw.matches, make([]int, len(masks))...)
+	mw.matcher = newMultiMatcher(mw.masks)
+
+	// Restore the progress of any partial match in the buffer.
+	// Matches in the buffer have already been counted, so they are only marked.
+	for i, b := range mw.buf {
+		mw.mark(mw.matcher.Read(b.byte), i+1)
+	}
+}
+
+// Matches returns the number of times each mask has been matched, in the
+// order in which the masks were given to NewMaskedWriter and AddMasks.
+// Call Flush first to make sure all written data has been processed.
+func (mw *MaskedWriter) Matches() []int {
+	mw.matcherMu.Lock()
+	defer mw.matcherMu.Unlock()
+
+	res := make([]int, len(mw.matches))
+	copy(res, mw.matches)
+	return res
+}
+
 // Write implements Write from io.Writer
 // It is responsible for finding any matches to mask and mark the appropriate bytes as masked.
 // This function never returns an error. These can instead be caught with Flush().
@@ -139,37 +105,50 @@ func (mw *MaskedWriter) process() {
 		case <-mw.outputTimeoutCh:
 			// Only flush if there is still nothing send to the output channel.
 			if len(mw.outputCh) == 0 {
-				for _, matcher := range mw.matchers {
-					matcher.Reset()
-				}
-				mw.flushBuffer()
+				mw.matcherMu.Lock()
+				mw.matcher.Reset()
+				mw.flushBuffer(len(mw.buf))
+				mw.matcherMu.Unlock()
 			}
 		case p := <-mw.incomingBytesCh:
+			mw.matcherMu.Lock()
 			for _, b := range p {
-				matchInProgress := false
 				mw.buf = append(mw.buf, maskByte{byte: b})
-
-				for _, matcher := range mw.matchers {
-					maskLen := matcher.Read(b)
-					for i := 0; i < maskLen; i++ {
-						mw.buf[len(mw.buf)-1-i].masked = true
-					}
-					matchInProgress = matchInProgress || matcher.InProgress()
-				}
-
-				if !matchInProgress {
-					mw.flushBuffer()
-				}
+				mw.read(b, len(mw.buf))
 			}
+			mw.flushBuffer(len(mw.buf) - mw.matcher.Pending())
+			mw.matcherMu.Unlock()
 		}
 	}
 }
 
-func (mw *MaskedWriter) flushBuffer() {
-	tmp := make([]maskByte, len(mw.buf))
+// read passes a byte to the matcher and marks the bytes in the buffer up to
+// the given index as masked if the byte completes a match.
+func (mw *MaskedWriter) read(b byte, end int) {
+	maskLen := mw.matcher.Read(b)
+	for _, i := range mw.matcher.Matches() {
+		mw.matches[i]++
+	}
+	mw.mark(maskLen, end)
+}
+
+// mark marks maskLen bytes in the buffer before the given index as masked.
+func (mw *MaskedWriter) mark(maskLen int, end int) {
+	for i := 0; i < maskLen; i++ {
+		mw.buf[end-1-i].masked = true
+	}
+}
+
+// flushBuffer passes the first n bytes of the buffer to the output channel.
+func (mw *MaskedWriter) flushBuffer(n int) {
+	if n <= 0 {
+		return
+	}
+
+	tmp := make([]maskByte, n)
 	copy(tmp, mw.buf)
 	mw.outputCh <- tmp
-	mw.buf = mw.buf[:0]
+	mw.buf = mw.buf[:copy(mw.buf, mw.buf[n:])]
 }
 
 // Run writes any processed data from the output channel to the underlying io.Writer.
@@ -180,29 +159,28 @@ func (mw *MaskedWriter) flushBuffer() {
 func (mw *MaskedWriter) Run() {
 	go mw.process()
 	masking := false
+	var out []byte
 	for {
 		select {
 		case output := <-mw.outputCh:
+			out = out[:0]
 			for _, b := range output {
-				var err error
 				if b.masked {
 					if !masking {
-						_, err = mw.w.Write([]byte(mw.maskString))
-						if err != nil {
-							mw.errCh <- err
-							return
-						}
+						out = append(out, mw.maskString...)
 					}
 					masking = true
 				} else {
-					_, err = mw.w.Write([]byte{b.byte})
-					if err != nil {
-						mw.errCh <- err
-						return
-					}
+					out = append(out, b.byte)
 					masking = false
 				}
 			}
+
+			_, err := mw.w.Write(out)
+			if err != nil {
+				mw.errCh <- err
+				return
+			}
 			mw.wg.Add(-len(output))
 		case <-time.After(mw.timeout):
 			// send to the timeout channel if not already done so.
@@ -13,114 +13,6 @@ import (
 
 var maskString = "<redacted by SecretHub>"
 
-func TestMatcher(t *testing.T) {
-	tests := []struct {
-		matchString     string
-		input           string
-		useReset        bool
-		resetIndex      int
-		expectedMatches []int
-	}{
-		{
-			matchString:     "test",
-			input:           "test",
-			expectedMatches: []int{0},
-		},
-		{
-			matchString:     "test",
-			input:           "ttest",
-			expectedMatches: []int{1},
-		},
-		{
-			matchString:     "test",
-			input:           "testtest",
-			expectedMatches: []int{0, 4},
-		},
-		{
-			matchString:     "testtest",
-			input:           "test",
-			expectedMatches: nil,
-		},
-		{
-			matchString:     "foofoobar",
-			input:           "foofoofoobar",
-			expectedMatches: []int{3},
-		},
-		{
-			matchString:     "test",
-			input:           "123 testtest",
-			expectedMatches: []int{4, 8},
-		},
-		{
-			matchString:     "test",
-			input:           "t est",
-			expectedMatches: nil,
-		},
-		{
-			matchString:     "test",
-			input:           "tesat",
-			expectedMatches: nil,
-		},
-		{
-			matchString:     "test",
-			input:           "tesT",
-			expectedMatches: nil,
-		},
-		{
-			matchString:     "t",
-			input:           "ttattt",
-			expectedMatches: []int{0, 1, 3, 4, 5},
-		},
-		{
-			matchString:     "tt",
-			input:           "ttattt",
-			expectedMatches: []int{0, 3},
-		},
-		{
-			matchString:     "test",
-			input:           "test",
-			useReset:        true,
-			resetIndex:      0,
-			expectedMatches: []int{0},
-		},
-		{
-			matchString:     "test",
-			input:           "test",
-			useReset:        true,
-			resetIndex:      1,
-			expectedMatches: nil,
-		},
-		{
-			matchString:     "test",
-			input:           "testtest",
-			useReset:        true,
-			resetIndex:      1,
-			expectedMatches: []int{4},
-		},
-	}
-
-	for _, tc := range tests {
-		name := fmt.Sprintf("%s in %s", tc.matchString, tc.input)
-
-		t.Run(name, func(t *testing.T) {
-			matcher := sequenceMatcher{sequence: []byte(tc.matchString)}
-			var matches []int
-			for i, b := range []byte(tc.input) {
-				if tc.useReset && tc.resetIndex == i {
-					matcher.Reset()
-				}
-
-				matchedBytes := matcher.Read(b)
-				if matchedBytes > 0 {
-					matches = append(matches, i-len(tc.matchString)+1)
-				}
-			}
-			assert.Equal(t, matches, tc.expectedMatches)
-		})
-	}
-
-}
-
 func TestNewMaskedWriter(t *testing.T) {
 	timeout10s := time.Second * 10
 	timeout1us := time.Microsecond * 1
@@ -320,3 +212,96 @@ func TestNewMaskedWriter_WriteError(t *testing.T) {
 	err = w.Flush()
 	assert.Equal(t, err, expectedErr)
 }
+
+func TestMaskedWriter_AddMasks(t *testing.T) {
+	var buf bytes.Buffer
+
+	w := NewMaskedWriter(&buf, [][]byte{[]byte("foo")}, maskString, time.Millisecond*10)
+
+	go w.Run()
+	_, err := w.Write([]byte("foo bar "))
+	assert.OK(t, err)
+
+	err = w.Flush()
+	assert.OK(t, err)
+
+	w.AddMasks([][]byte{[]byte("bar")})
+
+	_, err = w.Write([]byte("foo bar"))
+	assert.OK(t, err)
+
+	err = w.Flush()
+	assert.OK(t, err)
+
+	assert.Equal(t, buf.String(), maskString+" bar "+maskString+" "+maskString)
+}
+
+func TestMaskedWriter_Matches(t *testing.T) {
+	var buf bytes.Buffer
+
+	w := NewMaskedWriter(&buf, [][]byte{[]byte("foo"), []byte("bar"), []byte("baz")}, maskString, time.Millisecond*10)
+
+	go w.Run()
+	_, err := w.Write([]byte("foo bar foo "))
+	assert.OK(t, err)
+
+	w.AddMasks([][]byte{[]byte("qux")})
+
+	_, err = w.Write([]byte("qux"))
+	assert.OK(t, err)
+
+	err = w.Flush()
+	assert.OK(t, err)
+
+	assert.Equal(t, w.Matches(), []int{2, 1, 0, 1})
+}
+
+func TestMaskedWriter_Matches_Counting(t *testing.T) {
+	cases := map[string]struct {
+		masks    []string
+		input    string
+		expected []int
+	}{
+		"overlapping matches": {
+			masks:    []string{"tt"},
+			input:    "tttt",
+			expected: []int{2},
+		},
+		"overlapping matches with gap": {
+			masks:    []string{"tt"},
+			input:    "ttattt",
+			expected: []int{2},
+		},
+		"same value": {
+			masks:    []string{"foo", "foo"},
+			input:    "foo bar foo",
+			expected: []int{2, 2},
+		},
+		"suffix": {
+			masks:    []string{"foobar", "bar"},
+			input:    "foobar bar",
+			expected: []int{1, 2},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			masks := make([][]byte, len(tc.masks))
+			for i, mask := range tc.masks {
+				masks[i] = []byte(mask)
+			}
+			w := NewMaskedWriter(&buf, masks, maskString, time.Millisecond*10)
+
+			go w.Run()
+			_, err := w.Write([]byte(tc.input))
+			assert.OK(t, err)
+
+			err = w.Flush()
+			assert.OK(t, err)
+
+			assert.Equal(t, w.Matches(), tc.expected)
+		})
+	}
+}
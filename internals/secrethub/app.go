@@ -62,6 +62,17 @@ var (
 	ErrFileAlreadyExists        = errMain.Code("file_already_exists").Error("file already exists")
 )
 
+// ExitError is returned by a command that succeeded, but exits with a non-zero exit code
+// to report its result, e.g. when inject --diff finds that an output file would change.
+type ExitError struct {
+	Code int
+}
+
+// Error implements the error interface.
+func (e ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
 // App is the secrethub command-line application.
 type App struct {
 	credentialStore CredentialConfig
@@ -163,6 +174,7 @@ func (app *App) registerCommands() {
 	NewAccountCommand(app.io, app.clientFactory.NewClient, app.credentialStore).Register(app.cli)
 	NewCredentialCommand(app.io, app.clientFactory, app.credentialStore).Register(app.cli)
 	NewConfigCommand(app.io, app.credentialStore).Register(app.cli)
+	NewTemplateCommand(app.io, app.clientFactory.NewClient).Register(app.cli)
 
 	// Commands
 	NewInitCommand(app.io, app.clientFactory.NewUnauthenticatedClient, app.clientFactory.NewClientWithCredentials, app.credentialStore).Register(app.cli)
@@ -178,7 +190,9 @@ func (app *App) registerCommands() {
 	NewAuditCommand(app.io, app.clientFactory.NewClient).Register(app.cli)
 	NewInjectCommand(app.io, app.clientFactory.NewClient).Register(app.cli)
 	NewRunCommand(app.io, app.clientFactory.NewClient).Register(app.cli)
+	NewMaskCommand(app.io, app.clientFactory.NewClient).Register(app.cli)
 	NewPrintEnvCommand(app.cli, app.io).Register(app.cli)
+	NewStatusCommand(app.io, app.clientFactory.NewClient).Register(app.cli)
 
 	// Hidden commands
 	NewClearCommand(app.io).Register(app.cli)
@@ -0,0 +1,158 @@
+package secrethub
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/secrethub/secrethub-go/internals/api"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Errors
+var (
+	ErrInvalidSecretField      = errMain.Code("invalid_secret_field").ErrorPref("invalid field selector in %s: %s")
+	ErrSecretNotStructured     = errMain.Code("secret_not_structured").ErrorPref("cannot select field %s of secret %s: its value is not a JSON or YAML object or list")
+	ErrSecretFieldNotFound     = errMain.Code("secret_field_not_found").ErrorPref("field %s not found in secret %s")
+	ErrCannotEncodeSecretField = errMain.Code("cannot_encode_secret_field").ErrorPref("cannot encode field %s of secret %s: %s")
+)
+
+// secretFieldSeparator separates the path of a secret from the field that is selected
+// from its value, e.g. company/app/gcp/key#client_email.
+const secretFieldSeparator = "#"
+
+// splitSecretField splits the given path into the path of the secret and the field
+// selected from its value. The field is empty when the path does not select a field.
+func splitSecretField(path string) (string, string) {
+	i := strings.Index(path, secretFieldSeparator)
+	if i < 0 {
+		return path, ""
+	}
+	return path[:i], path[i+len(secretFieldSeparator):]
+}
+
+// joinSecretField returns the path that selects the given field from the secret at the given path.
+func joinSecretField(path string, field string) string {
+	if field == "" {
+		return path
+	}
+	return path + secretFieldSeparator + field
+}
+
+// validateSecretFieldPath validates a secret path that optionally selects a field from the value of the secret.
+func validateSecretFieldPath(path string) error {
+	secretPath, field := splitSecretField(path)
+	if secretPath != path {
+		if field == "" {
+			return ErrInvalidSecretField(path, "the field is empty")
+		}
+		for _, key := range secretFieldKeys(field) {
+			if key == "" {
+				return ErrInvalidSecretField(path, "the field contains an empty key")
+			}
+		}
+	}
+	return api.ValidateSecretPath(secretPath)
+}
+
+// secretFieldKeys returns the keys of the given field selector. A selector starting with a dot
+// is a path of keys separated by dots, e.g. .db.host. Otherwise, the selector is a single key.
+func secretFieldKeys(field string) []string {
+	if strings.HasPrefix(field, ".") {
+		return strings.Split(field[1:], ".")
+	}
+	return []string{field}
+}
+
+// selectSecretField returns the field with the given selector from the JSON or YAML value
+// of the secret at the given path. A key in the selector can also be the index of an element
+// of a list. Fields with a string value are returned as is and fields with an object or list
+// value are encoded in the format of the secret.
+func selectSecretField(path string, field string, value []byte) ([]byte, error) {
+	var data interface{}
+	isJSON := true
+	decoder := json.NewDecoder(bytes.NewReader(value))
+	decoder.UseNumber()
+	err := decoder.Decode(&data)
+	if err != nil {
+		isJSON = false
+		err = yaml.Unmarshal(value, &data)
+		if err != nil {
+			return nil, ErrSecretNotStructured(field, path)
+		}
+	}
+
+	switch data.(type) {
+	case map[string]interface{}, map[interface{}]interface{}, []interface{}:
+	default:
+		return nil, ErrSecretNotStructured(field, path)
+	}
+
+	for _, key := range secretFieldKeys(field) {
+		switch v := data.(type) {
+		case map[string]interface{}:
+			elem, ok := v[key]
+			if !ok {
+				return nil, ErrSecretFieldNotFound(field, path)
+			}
+			data = elem
+		case map[interface{}]interface{}:
+			elem, ok := v[key]
+			if !ok {
+				return nil, ErrSecretFieldNotFound(field, path)
+			}
+			data = elem
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, ErrSecretFieldNotFound(field, path)
+			}
+			data = v[i]
+		default:
+			return nil, ErrSecretFieldNotFound(field, path)
+		}
+	}
+
+	switch v := data.(type) {
+	case string:
+		return []byte(v), nil
+	case nil:
+		return []byte{}, nil
+	case map[string]interface{}, map[interface{}]interface{}, []interface{}:
+		var encoded []byte
+		if isJSON {
+			encoded, err = json.Marshal(v)
+		} else {
+			encoded, err = yaml.Marshal(v)
+			encoded = bytes.TrimSuffix(encoded, []byte("\n"))
+		}
+		if err != nil {
+			return nil, ErrCannotEncodeSecretField(field, path, err)
+		}
+		return encoded, nil
+	default:
+		return []byte(fmt.Sprint(v)), nil
+	}
+}
+
+// secretFieldPath is a secret path that optionally selects a field from the value of the secret.
+// It implements kingpin.Value.
+type secretFieldPath string
+
+// Set validates and sets the path.
+func (p *secretFieldPath) Set(value string) error {
+	err := validateSecretFieldPath(value)
+	if err != nil {
+		return err
+	}
+	*p = secretFieldPath(value)
+	return nil
+}
+
+// String returns the path.
+func (p secretFieldPath) String() string {
+	return string(p)
+}
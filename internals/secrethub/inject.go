@@ -20,14 +20,25 @@ import (
 
 // Errors
 var (
-	ErrUnknownTemplateVersion = errMain.Code("unknown_template_version").ErrorPref("unknown template version: '%s' supported versions are 1, 2 and latest")
+	ErrUnknownTemplateVersion = errMain.Code("unknown_template_version").ErrorPref("unknown template version: '%s' supported versions are 1, 2, 3 and latest")
 	ErrReadFile               = errMain.Code("in_file_read_error").ErrorPref("could not read the input file %s: %s")
+	ErrUnknownTemplateEngine  = errMain.Code("unknown_template_engine").ErrorPref("unknown template engine: '%s' supported engines are secrethub and gotemplate")
+	ErrInjectFilesMismatch    = errMain.Code("inject_files_mismatch").Error("every --in-file must be paired with an --out-file when injecting multiple templates or using --watch")
+	ErrWatchWithoutFiles      = errMain.Code("watch_without_files").Error("--watch requires at least one --in-file and --out-file pair")
+	ErrDiffWithoutOutFile     = errMain.Code("diff_without_out_file").Error("--diff requires --out-file to compare the injected template with")
+	ErrInjectDirMismatch      = errMain.Code("inject_dir_mismatch").Error("--in-dir and --out-dir must be used together")
+)
+
+// Template engines
+const (
+	templateEngineSecretHub  = "secrethub"
+	templateEngineGoTemplate = "gotemplate"
 )
 
 // InjectCommand is a command to read a secret.
 type InjectCommand struct {
-	outFile                       string
-	inFile                        string
+	outFiles                      []string
+	inFiles                       []string
 	fileMode                      filemode.FileMode
 	force                         bool
 	io                            ui.IO
@@ -36,8 +47,19 @@ type InjectCommand struct {
 	clipper                       clip.Clipper
 	newClient                     newClientFunc
 	templateVars                  map[string]string
+	varFiles                      []string
+	environment                   string
 	templateVersion               string
+	templateEngine                string
 	dontPromptMissingTemplateVars bool
+	lockFile                      string
+	updateLock                    bool
+	watch                         bool
+	watchInterval                 time.Duration
+	onChange                      string
+	inDir                         string
+	outDir                        string
+	showDiff                      bool
 }
 
 // NewInjectCommand creates a new InjectCommand.
@@ -62,13 +84,24 @@ func (cmd *InjectCommand) Register(r command.Registerer) {
 			units.HumanDuration(cmd.clearClipboardAfter),
 		),
 	).Short('c').BoolVar(&cmd.useClipboard)
-	clause.Flag("in-file", "The filename of a template file to inject.").Short('i').StringVar(&cmd.inFile)
-	clause.Flag("out-file", "Write the injected template to a file instead of stdout.").Short('o').StringVar(&cmd.outFile)
-	clause.Flag("file", "").Hidden().StringVar(&cmd.outFile) // Alias of --out-file (for backwards compatibility)
+	clause.Flag("in-file", "The filename of a template file to inject. Can be used multiple times together with --out-file to inject multiple templates, in which case the n-th --in-file is written to the n-th --out-file.").Short('i').StringsVar(&cmd.inFiles)
+	clause.Flag("out-file", "Write the injected template to a file instead of stdout.").Short('o').StringsVar(&cmd.outFiles)
+	clause.Flag("file", "").Hidden().StringsVar(&cmd.outFiles) // Alias of --out-file (for backwards compatibility)
+	clause.Flag("in-dir", "A directory of templates to inject. Only the files with the .tpl extension in the directory and its subdirectories are rendered as templates, into the file with the same relative path without the extension in --out-dir. All other files are not rendered, but copied to --out-dir unchanged. Every file gets the same file mode as in --in-dir.").StringVar(&cmd.inDir)
+	clause.Flag("out-dir", "The directory to write the templates of --in-dir to. Only the files that changed are written and printed.").StringVar(&cmd.outDir)
 	clause.Flag("file-mode", "Set filemode for the output file if it does not yet exist. Defaults to 0600 (read and write for current user) and is ignored without the --out-file flag.").Default("0600").SetValue(&cmd.fileMode)
 	clause.Flag("var", "Define the value for a template variable with `VAR=VALUE`, e.g. --var env=prod").Short('v').StringMapVar(&cmd.templateVars)
-	clause.Flag("template-version", "The template syntax version to be used. The options are v1, v2, latest or auto to automatically detect the version.").Default("auto").StringVar(&cmd.templateVersion)
+	clause.Flag("var-file", "Read template variables from a YAML file with `VAR: VALUE` mappings. Can be used multiple times, in which case later files take precedence. Variables defined with --var or SECRETHUB_VAR_ environment variables take precedence over variable files.").StringsVar(&cmd.varFiles)
+	clause.Flag("environment", "Read template variables from the file secrethub.<environment>.vars.yml, e.g. --environment prod reads secrethub.prod.vars.yml. Variables from files given with --var-file take precedence.").StringVar(&cmd.environment)
+	clause.Flag("template-version", "The template syntax version to be used. The options are v1, v2, v3, latest or auto to automatically detect the version.").Default("auto").StringVar(&cmd.templateVersion)
+	clause.Flag("engine", "The template engine to be used. The options are secrethub to use the SecretHub template syntax and gotemplate to use the syntax of Go's text/template package, with the functions secret \"path\" and var \"name\" to read secrets and template variables.").Default(templateEngineSecretHub).StringVar(&cmd.templateEngine)
 	clause.Flag("no-prompt", "Do not prompt when a template variable is missing and return an error instead.").BoolVar(&cmd.dontPromptMissingTemplateVars)
+	clause.Flag("lock-file", "The path to a lockfile that pins the versions of the secrets that are read. It is used when it exists.").Default(defaultLockFile).StringVar(&cmd.lockFile)
+	clause.Flag("update-lock", "Read the latest versions of the secrets instead of the versions pinned in the lockfile and update the lockfile with them.").BoolVar(&cmd.updateLock)
+	clause.Flag("watch", "Keep running and periodically check the secrets for new values. When a value changes, the templates are injected again and the output files are replaced atomically. Requires --in-file and --out-file. Secrets are always read at their latest version, the lockfile is not used. Cannot be used with --update-lock.").BoolVar(&cmd.watch)
+	clause.Flag("watch-interval", "The time between checks for new secret values when --watch is used.").Default("1m").DurationVar(&cmd.watchInterval)
+	clause.Flag("on-change", "A command to run with the shell when --watch is used and any of the output files changed, e.g. \"systemctl reload nginx\".").StringVar(&cmd.onChange)
+	clause.Flag("diff", fmt.Sprintf("Instead of writing --out-file, print a unified diff of the changes that injecting the template would make to it. The values of secrets are replaced with placeholders such as <secret:path/to/secret:v1>, so that the diff can be shared safely. Exits with code %d when the file would change. Cannot be used with --engine gotemplate.", diffExitCode)).BoolVar(&cmd.showDiff)
 	registerForceFlag(clause).BoolVar(&cmd.force)
 
 	command.BindAction(clause, cmd.Run)
@@ -76,19 +109,72 @@ func (cmd *InjectCommand) Register(r command.Registerer) {
 
 // Run handles the command with the options as specified in the command.
 func (cmd *InjectCommand) Run() error {
-	if cmd.useClipboard && cmd.outFile != "" {
+	if cmd.useClipboard && len(cmd.outFiles) > 0 {
 		return ErrFlagsConflict("--clip and --file")
 	}
 
+	if cmd.watch || len(cmd.inFiles) > 1 || len(cmd.outFiles) > 1 {
+		if len(cmd.inFiles) != len(cmd.outFiles) {
+			return ErrInjectFilesMismatch
+		}
+	}
+
+	if cmd.watch {
+		if len(cmd.inFiles) == 0 {
+			return ErrWatchWithoutFiles
+		}
+		if cmd.watchInterval <= 0 {
+			return ErrInvalidWatchInterval
+		}
+		if cmd.updateLock {
+			return ErrFlagsConflict("--watch and --update-lock")
+		}
+	} else if cmd.onChange != "" {
+		return ErrFlagsConflict("--on-change without --watch")
+	}
+
+	if cmd.inDir != "" || cmd.outDir != "" {
+		if cmd.inDir == "" || cmd.outDir == "" {
+			return ErrInjectDirMismatch
+		}
+		if len(cmd.inFiles) > 0 || len(cmd.outFiles) > 0 {
+			return ErrFlagsConflict("--in-dir and --in-file or --out-file")
+		}
+		if cmd.useClipboard {
+			return ErrFlagsConflict("--in-dir and --clip")
+		}
+		if cmd.watch {
+			return ErrFlagsConflict("--in-dir and --watch")
+		}
+		if cmd.showDiff {
+			return ErrFlagsConflict("--in-dir and --diff")
+		}
+	}
+
+	if cmd.showDiff {
+		if len(cmd.outFiles) == 0 {
+			return ErrDiffWithoutOutFile
+		}
+		if cmd.watch {
+			return ErrFlagsConflict("--diff and --watch")
+		}
+		// Go templates can transform the values of secrets in ways that cannot be traced
+		// back in the output, so the values cannot be hidden reliably in a diff.
+		if cmd.templateEngine == templateEngineGoTemplate {
+			return ErrFlagsConflict("--diff and --engine gotemplate")
+		}
+	}
+
+	var inFile string
+	if len(cmd.inFiles) > 0 {
+		inFile = cmd.inFiles[0]
+	}
+	fromStdin := inFile == "" && cmd.inDir == ""
+
 	var err error
 	var raw []byte
 
-	if cmd.inFile != "" {
-		raw, err = ioutil.ReadFile(cmd.inFile)
-		if err != nil {
-			return ErrReadFile(cmd.inFile, err)
-		}
-	} else {
+	if fromStdin {
 		if !cmd.io.Stdin().IsPiped() {
 			return ErrNoDataOnStdin
 		}
@@ -102,69 +188,180 @@ func (cmd *InjectCommand) Run() error {
 	osEnv, _ := parseKeyValueStringsToMap(os.Environ())
 
 	var templateVariableReader tpl.VariableReader
-	templateVariableReader, err = newVariableReader(osEnv, cmd.templateVars)
+	templateVariableReader, err = newVariableReader(osEnv, cmd.templateVars, templateVarFiles(cmd.environment, cmd.varFiles)...)
 	if err != nil {
 		return err
 	}
 
-	if !cmd.dontPromptMissingTemplateVars {
+	if !cmd.dontPromptMissingTemplateVars && !cmd.watch {
 		templateVariableReader = newPromptMissingVariableReader(templateVariableReader, cmd.io)
 	}
 
-	parser, err := getTemplateParser(raw, cmd.templateVersion)
-	if err != nil {
-		return err
+	// Secrets pinned in the lockfile never get new values, so it is not used when watching.
+	lock := newLockFile(cmd.lockFile)
+	if !cmd.watch {
+		lock, err = readLockFile(cmd.lockFile)
+		if err != nil {
+			return err
+		}
 	}
 
-	template, err := parser.Parse(string(raw), 1, 1)
-	if err != nil {
-		return err
+	if cmd.inDir != "" {
+		return cmd.injectDir(templateVariableReader, lock)
 	}
 
-	injected, err := template.Evaluate(templateVariableReader, newSecretReader(cmd.newClient))
-	if err != nil {
-		return err
+	var templates []tpl.Template
+	if fromStdin {
+		template, err := cmd.parseTemplate(raw, "")
+		if err != nil {
+			return err
+		}
+		templates = []tpl.Template{template}
+	} else {
+		templates, err = cmd.readTemplates()
+		if err != nil {
+			return err
+		}
 	}
 
-	out := []byte(injected)
-	if cmd.useClipboard {
-		err = WriteClipboardAutoClear(out, cmd.clearClipboardAfter, cmd.clipper)
+	if cmd.showDiff {
+		changed, err := cmd.diffOutFiles(templates, templateVariableReader, lock)
 		if err != nil {
 			return err
 		}
+		if changed {
+			return ExitError{Code: diffExitCode}
+		}
+		return nil
+	}
 
-		fmt.Fprintln(cmd.io.Stdout(), fmt.Sprintf("Copied injected template to clipboard. It will be cleared after %s.", units.HumanDuration(cmd.clearClipboardAfter)))
-	} else if cmd.outFile != "" {
-		_, err := os.Stat(cmd.outFile)
-		if err == nil && !cmd.force {
-			if cmd.io.Stdout().IsPiped() {
-				return ErrFileAlreadyExists
-			}
-
-			confirmed, err := ui.AskYesNo(
-				cmd.io,
-				fmt.Sprintf(
-					"File %s already exists, overwrite it?",
-					cmd.outFile,
-				),
-				ui.DefaultNo,
-			)
+	if cmd.watch {
+		// The output files are replaced on every change, so overwriting them is confirmed once up front.
+		for _, outFile := range cmd.outFiles {
+			confirmed, err := cmd.confirmOverwrite(outFile)
 			if err != nil {
 				return err
 			}
-
 			if !confirmed {
 				fmt.Fprintln(cmd.io.Stdout(), "Aborting.")
 				return nil
 			}
 		}
 
-		err = ioutil.WriteFile(cmd.outFile, posix.AddNewLine(out), cmd.fileMode.FileMode())
+		w, err := newInjectWatcher(cmd, templates, templateVariableReader, lock)
+		if err != nil {
+			return err
+		}
+		return w.run()
+	}
+
+	injected, err := cmd.inject(templates, templateVariableReader, lock)
+	if err != nil {
+		return err
+	}
+
+	for i, out := range injected {
+		var outFile string
+		if len(cmd.outFiles) > i {
+			outFile = cmd.outFiles[i]
+		}
+		err = cmd.output(out, outFile)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readTemplates reads and parses the templates in the input files.
+func (cmd *InjectCommand) readTemplates() ([]tpl.Template, error) {
+	templates := make([]tpl.Template, len(cmd.inFiles))
+	for i, inFile := range cmd.inFiles {
+		raw, err := ioutil.ReadFile(inFile)
+		if err != nil {
+			return nil, ErrReadFile(inFile, err)
+		}
+
+		templates[i], err = cmd.parseTemplate(raw, inFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return templates, nil
+}
+
+// parseTemplate parses the given template that is read from the given file.
+// The file is empty when the template is read from stdin.
+func (cmd *InjectCommand) parseTemplate(raw []byte, file string) (tpl.Template, error) {
+	parser, err := cmd.templateParser(raw)
+	if err != nil {
+		return nil, err
+	}
+	if file != "" {
+		parser = tpl.ForFile(parser, file)
+	}
+
+	return parser.Parse(string(raw), 1, 1)
+}
+
+// inject evaluates the given templates. Secrets that are used in multiple
+// templates are only read once. When --update-lock is set, the lockfile is
+// updated with the versions of the secrets that are read.
+func (cmd *InjectCommand) inject(templates []tpl.Template, varReader tpl.VariableReader, lock *lockFile) ([]string, error) {
+	baseReader := newSecretReader(cmd.newClient)
+	var sr tpl.SecretReader = baseReader
+	if !cmd.updateLock {
+		sr = newLockedSecretReader(sr, lock)
+	}
+	sr = newBufferedSecretReader(sr)
+
+	injected := make([]string, len(templates))
+	for i, template := range templates {
+		var err error
+		injected[i], err = template.Evaluate(varReader, sr)
 		if err != nil {
-			return ErrCannotWrite(cmd.outFile, err)
+			return nil, err
 		}
+	}
 
-		absPath, err := filepath.Abs(cmd.outFile)
+	if cmd.updateLock {
+		lock.update(baseReader.Versions())
+		err := lock.write()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return injected, nil
+}
+
+// output writes an injected template to the clipboard, to the given file
+// or to stdout when no file is given.
+func (cmd *InjectCommand) output(injected string, outFile string) error {
+	out := []byte(injected)
+	if cmd.useClipboard {
+		err := WriteClipboardAutoClear(out, cmd.clearClipboardAfter, cmd.clipper)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(cmd.io.Stdout(), fmt.Sprintf("Copied injected template to clipboard. It will be cleared after %s.", units.HumanDuration(cmd.clearClipboardAfter)))
+	} else if outFile != "" {
+		confirmed, err := cmd.confirmOverwrite(outFile)
+		if err != nil {
+			return err
+		}
+		if !confirmed {
+			fmt.Fprintln(cmd.io.Stdout(), "Aborting.")
+			return nil
+		}
+
+		err = ioutil.WriteFile(outFile, posix.AddNewLine(out), cmd.fileMode.FileMode())
+		if err != nil {
+			return ErrCannotWrite(outFile, err)
+		}
+
+		absPath, err := filepath.Abs(outFile)
 		if err != nil {
 			return ErrCannotWrite(err)
 		}
@@ -176,3 +373,40 @@ func (cmd *InjectCommand) Run() error {
 
 	return nil
 }
+
+// confirmOverwrite returns whether the given output file may be written. When the file
+// already exists and --force is not set, the user is asked to confirm overwriting it.
+func (cmd *InjectCommand) confirmOverwrite(outFile string) (bool, error) {
+	_, err := os.Stat(outFile)
+	if err != nil || cmd.force {
+		return true, nil
+	}
+
+	if cmd.io.Stdout().IsPiped() {
+		return false, ErrFileAlreadyExists
+	}
+
+	return ui.AskYesNo(
+		cmd.io,
+		fmt.Sprintf(
+			"File %s already exists, overwrite it?",
+			outFile,
+		),
+		ui.DefaultNo,
+	)
+}
+
+// templateParser returns the parser of the configured template engine for the given template.
+func (cmd *InjectCommand) templateParser(raw []byte) (tpl.Parser, error) {
+	switch cmd.templateEngine {
+	case templateEngineSecretHub, "":
+		return getTemplateParser(raw, cmd.templateVersion)
+	case templateEngineGoTemplate:
+		if cmd.templateVersion != "" && cmd.templateVersion != "auto" {
+			return nil, ErrFlagsConflict("--engine gotemplate and --template-version")
+		}
+		return tpl.NewGoTemplateParser(), nil
+	default:
+		return nil, ErrUnknownTemplateEngine(cmd.templateEngine)
+	}
+}
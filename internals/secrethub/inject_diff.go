@@ -0,0 +1,262 @@
+package secrethub
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/secrethub/secrethub-cli/internals/cli/diff"
+	"github.com/secrethub/secrethub-cli/internals/cli/posix"
+	"github.com/secrethub/secrethub-cli/internals/secrethub/tpl"
+)
+
+const (
+	// diffExitCode is the exit code of inject --diff when any of the output files would change.
+	diffExitCode = 2
+	// redactedLine replaces the lines of an output file that cannot be shown in a diff
+	// because they may contain the values of secrets.
+	redactedLine = "<line redacted: it does not match the template and may contain secrets>"
+)
+
+// secretMarkerRegexp matches a secret value that is marked by a markingSecretReader.
+var secretMarkerRegexp = regexp.MustCompile("(?s)\x00([0-9]+)\x01(.*?)\x00\x02")
+
+// markingSecretReader is a tpl.SecretMarker that marks the secret values in an injected
+// template, so that they can be told apart from the rest of the output. The values are marked
+// as they are rendered, after any functions are applied to them.
+type markingSecretReader struct {
+	secretReader tpl.SecretReader
+	// versions is the secret reader at the bottom of the chain of secret readers,
+	// which records the versions of the secrets that are read.
+	versions *secretReader
+	// lock is the lockfile with which the secrets are pinned. It is nil when secrets
+	// are not read at their pinned version.
+	lock    *lockFile
+	mutex   sync.Mutex
+	secrets []markedSecret
+}
+
+// markedSecret is a secret value in an injected template.
+type markedSecret struct {
+	// path is the path of the secret without a version, including the selected field.
+	path    string
+	version int
+	// value is the value as it is rendered in the injected template.
+	value string
+}
+
+// placeholder returns the text that is shown instead of the value of the secret.
+func (s markedSecret) placeholder() string {
+	return fmt.Sprintf("<secret:%s:v%d>", s.path, s.version)
+}
+
+// previousPlaceholder returns the text that is shown instead of a previous value of the secret.
+func (s markedSecret) previousPlaceholder() string {
+	return fmt.Sprintf("<secret:%s:previous>", s.path)
+}
+
+// ReadSecret implements tpl.SecretReader.
+func (sr *markingSecretReader) ReadSecret(path string) (string, error) {
+	return sr.secretReader.ReadSecret(path)
+}
+
+// LookupSecret implements tpl.SecretLookupReader.
+func (sr *markingSecretReader) LookupSecret(path string) (string, bool, error) {
+	return tpl.LookupSecret(sr.secretReader, path)
+}
+
+// ListSecrets implements tpl.SecretDirReader.
+func (sr *markingSecretReader) ListSecrets(dirPath string) ([]string, error) {
+	return tpl.ListSecrets(sr.secretReader, dirPath)
+}
+
+// Prefetch implements tpl.SecretPrefetcher.
+func (sr *markingSecretReader) Prefetch(paths []string) error {
+	prefetcher, ok := sr.secretReader.(tpl.SecretPrefetcher)
+	if !ok {
+		return nil
+	}
+	return prefetcher.Prefetch(paths)
+}
+
+// MarkSecret implements tpl.SecretMarker. It records the rendered value
+// of the secret and returns it with markers around it.
+func (sr *markingSecretReader) MarkSecret(path string, value string) string {
+	secretPath, field := splitSecretField(path)
+	pinnedPath, _ := splitSecretField(sr.lock.pin(secretPath))
+	version := sr.versions.Version(pinnedPath)
+	if i := strings.LastIndex(secretPath, ":"); i >= 0 {
+		secretPath = secretPath[:i]
+	}
+
+	sr.mutex.Lock()
+	defer sr.mutex.Unlock()
+	sr.secrets = append(sr.secrets, markedSecret{
+		path:    joinSecretField(secretPath, field),
+		version: version,
+		value:   value,
+	})
+	return fmt.Sprintf("\x00%d\x01%s\x00\x02", len(sr.secrets)-1, value)
+}
+
+// injectedDiff is an injected template of which the secret values are marked.
+type injectedDiff struct {
+	// marked is the injected template as it is written to the output file, with markers
+	// around the secret values.
+	marked  string
+	secrets []markedSecret
+}
+
+// newInjectedDiff returns the injectedDiff of the given injected template with marked secrets.
+func newInjectedDiff(injected string, secrets []markedSecret) injectedDiff {
+	d := injectedDiff{
+		marked:  injected,
+		secrets: secrets,
+	}
+	if output := d.output(); string(posix.AddNewLine([]byte(output))) != output {
+		d.marked += "\n"
+	}
+	return d
+}
+
+// output returns the injected template as it is written to the output file.
+func (d injectedDiff) output() string {
+	return secretMarkerRegexp.ReplaceAllString(d.marked, "$2")
+}
+
+// masked returns the injected template as it is written to the output file,
+// with all secret values replaced by placeholders.
+func (d injectedDiff) masked() string {
+	return secretMarkerRegexp.ReplaceAllStringFunc(d.marked, func(marker string) string {
+		return d.secret(marker).placeholder()
+	})
+}
+
+// maskCurrent returns the current contents of the output file with all secret values
+// replaced by placeholders. When the current contents match the structure of the template,
+// every value at the position of a secret is replaced, also when it is a previous value of the
+// secret. Otherwise, or when the template is too large to match it, the current values of the
+// secrets are replaced and the lines of which it cannot be known whether they contain secrets
+// are redacted.
+func (d injectedDiff) maskCurrent(current string) string {
+	var pattern strings.Builder
+	pattern.WriteString("(?s)^")
+	var secrets []markedSecret
+	last := 0
+	for _, loc := range secretMarkerRegexp.FindAllStringIndex(d.marked, -1) {
+		pattern.WriteString(regexp.QuoteMeta(d.marked[last:loc[0]]))
+		pattern.WriteString("(.*?)")
+		secrets = append(secrets, d.secret(d.marked[loc[0]:loc[1]]))
+		last = loc[1]
+	}
+	pattern.WriteString(regexp.QuoteMeta(d.marked[last:]))
+	pattern.WriteString("$")
+
+	var matches []int
+	// Compiling the pattern fails when the template is too large or contains too many secrets.
+	re, err := regexp.Compile(pattern.String())
+	if err == nil {
+		matches = re.FindStringSubmatchIndex(current)
+	}
+	if matches != nil {
+		var masked strings.Builder
+		last := 0
+		for i, secret := range secrets {
+			start, end := matches[2*i+2], matches[2*i+3]
+			masked.WriteString(current[last:start])
+			if current[start:end] == secret.value {
+				masked.WriteString(secret.placeholder())
+			} else {
+				masked.WriteString(secret.previousPlaceholder())
+			}
+			last = end
+		}
+		masked.WriteString(current[last:])
+		return masked.String()
+	}
+
+	// Replace the longest values first, so that values that contain other values are replaced entirely.
+	values := append([]markedSecret{}, d.secrets...)
+	sort.SliceStable(values, func(i, j int) bool {
+		return len(values[i].value) > len(values[j].value)
+	})
+	for _, secret := range values {
+		if secret.value != "" {
+			current = strings.Replace(current, secret.value, secret.placeholder(), -1)
+		}
+	}
+
+	safeLines := make(map[string]bool)
+	scanner := bufio.NewScanner(strings.NewReader(d.masked()))
+	for scanner.Scan() {
+		safeLines[scanner.Text()] = true
+	}
+
+	lines := strings.SplitAfter(current, "\n")
+	for i, line := range lines {
+		text := strings.TrimSuffix(line, "\n")
+		if text != "" && !safeLines[text] {
+			lines[i] = redactedLine + line[len(text):]
+		}
+	}
+	return strings.Join(lines, "")
+}
+
+// secret returns the secret of the given marker.
+func (d injectedDiff) secret(marker string) markedSecret {
+	i, _ := strconv.Atoi(secretMarkerRegexp.FindStringSubmatch(marker)[1])
+	return d.secrets[i]
+}
+
+// diffOutFiles prints the unified diffs between the current contents of the output files
+// and the injected templates, with all secret values replaced by placeholders. It returns
+// whether any of the output files would change. Nothing is written, also not the lockfile.
+func (cmd *InjectCommand) diffOutFiles(templates []tpl.Template, varReader tpl.VariableReader, lock *lockFile) (bool, error) {
+	baseReader := newSecretReader(cmd.newClient)
+	var sr tpl.SecretReader = baseReader
+	if cmd.updateLock {
+		lock = nil
+	} else {
+		sr = newLockedSecretReader(sr, lock)
+	}
+	markingReader := &markingSecretReader{
+		secretReader: newBufferedSecretReader(sr),
+		versions:     baseReader,
+		lock:         lock,
+	}
+
+	injected := make([]string, len(templates))
+	for i, template := range templates {
+		var err error
+		injected[i], err = template.Evaluate(varReader, markingReader)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	changed := false
+	for i, outFile := range cmd.outFiles {
+		d := newInjectedDiff(injected[i], markingReader.secrets)
+
+		fromName := outFile
+		current, err := ioutil.ReadFile(outFile)
+		if os.IsNotExist(err) {
+			fromName = os.DevNull
+		} else if err != nil {
+			return false, ErrReadFile(outFile, err)
+		} else if string(current) == d.output() {
+			continue
+		}
+		changed = true
+
+		fmt.Fprint(cmd.io.Stdout(), diff.Unified(fromName, outFile, d.maskCurrent(string(current)), d.masked()))
+	}
+
+	return changed, nil
+}
@@ -0,0 +1,230 @@
+package secrethub
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/secrethub/secrethub-cli/internals/cli/ui"
+	"github.com/secrethub/secrethub-cli/internals/secrethub/tpl"
+
+	"github.com/secrethub/secrethub-go/internals/api"
+	"github.com/secrethub/secrethub-go/internals/assert"
+	"github.com/secrethub/secrethub-go/pkg/secrethub"
+	"github.com/secrethub/secrethub-go/pkg/secrethub/fakeclient"
+)
+
+func TestInjectCommand_diffOutFiles(t *testing.T) {
+	const template = "user = admin\npassword = {{ company/app/password }}\n"
+
+	cases := map[string]struct {
+		template string
+		current  *string
+		expected string
+		changed  bool
+	}{
+		"unchanged": {
+			current: strPtr("user = admin\npassword = new\n"),
+		},
+		"file does not exist": {
+			expected: "--- " + os.DevNull + "\n+++ OUT\n" +
+				"@@ -0,0 +1,2 @@\n+user = admin\n+password = <secret:company/app/password:v2>\n",
+			changed: true,
+		},
+		"secret changed": {
+			current: strPtr("user = admin\npassword = old\n"),
+			expected: "--- OUT\n+++ OUT\n" +
+				"@@ -1,2 +1,2 @@\n user = admin\n-password = <secret:company/app/password:previous>\n+password = <secret:company/app/password:v2>\n",
+			changed: true,
+		},
+		"text changed": {
+			// The line cannot be shown, because it could contain a secret in a previous version of the template.
+			current: strPtr("user = root\npassword = new\n"),
+			expected: "--- OUT\n+++ OUT\n" +
+				"@@ -1,2 +1,2 @@\n-" + redactedLine + "\n+user = admin\n password = <secret:company/app/password:v2>\n",
+			changed: true,
+		},
+		"does not match template": {
+			current: strPtr("user = root\npassword = old\npassword = new\n"),
+			expected: "--- OUT\n+++ OUT\n" +
+				"@@ -1,3 +1,2 @@\n-" + redactedLine + "\n-" + redactedLine + "\n+user = admin\n password = <secret:company/app/password:v2>\n",
+			changed: true,
+		},
+		"function applied": {
+			template: "password = {{ company/app/password | base64 }}\n",
+			current:  strPtr("password = b2xk\n"),
+			expected: "--- OUT\n+++ OUT\n" +
+				"@@ -1 +1 @@\n-password = <secret:company/app/password:previous>\n+password = <secret:company/app/password:v2>\n",
+			changed: true,
+		},
+		"function applied to new file": {
+			template: "checksum = {{ company/app/password | sha256 }}\n",
+			expected: "--- " + os.DevNull + "\n+++ OUT\n" +
+				"@@ -0,0 +1 @@\n+checksum = <secret:company/app/password:v2>\n",
+			changed: true,
+		},
+		"function applied unchanged": {
+			template: "password = {{ company/app/password | upper }}\n",
+			current:  strPtr("password = NEW\n"),
+		},
+		"range block": {
+			template: "{{ range $name, $value := company/app }}\n${name} = ${value}\n{{ end }}\n",
+			current:  strPtr("password = old\n"),
+			expected: "--- OUT\n+++ OUT\n" +
+				"@@ -1 +1 @@\n-password = <secret:company/app/password:previous>\n+password = <secret:company/app/password:v2>\n",
+			changed: true,
+		},
+		"if block": {
+			template: "{{ if ${env} }}\npassword = dev\n{{ else }}\npassword = {{ company/app/password | json }}\n{{ end }}\n",
+			current:  strPtr("password = \"old\"\n"),
+			expected: "--- OUT\n+++ OUT\n" +
+				"@@ -1 +1 @@\n-password = <secret:company/app/password:previous>\n+password = <secret:company/app/password:v2>\n",
+			changed: true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			dir, cleanup := testdata.tempDir(t)
+			defer cleanup()
+
+			outFile := filepath.Join(dir, "app.conf")
+			if tc.current != nil {
+				err := ioutil.WriteFile(outFile, []byte(*tc.current), 0600)
+				assert.OK(t, err)
+			}
+
+			io := ui.NewFakeIO()
+			cmd := InjectCommand{
+				io:       io,
+				outFiles: []string{outFile},
+				newClient: func() (secrethub.ClientInterface, error) {
+					return fakeclient.Client{
+						DirService: &fakeclient.DirService{
+							TreeGetter: fakeclient.TreeGetter{
+								ReturnsTree: &api.Tree{
+									RootDir: &api.Dir{
+										Name:    "app",
+										Secrets: []*api.Secret{{Name: "password"}},
+									},
+								},
+							},
+						},
+						SecretService: &fakeclient.SecretService{
+							VersionService: &fakeclient.SecretVersionService{
+								WithDataGetter: fakeclient.WithDataGetter{
+									ReturnsVersion: &api.SecretVersion{
+										Version: 2,
+										Data:    []byte("new"),
+									},
+								},
+							},
+						},
+					}, nil
+				},
+			}
+
+			raw := template
+			if tc.template != "" {
+				raw = tc.template
+			}
+			parsed, err := tpl.NewV3Parser().Parse(raw, 1, 1)
+			assert.OK(t, err)
+
+			varReader, err := newVariableReader(nil, nil)
+			assert.OK(t, err)
+
+			lock, err := readLockFile(filepath.Join(dir, defaultLockFile))
+			assert.OK(t, err)
+
+			changed, err := cmd.diffOutFiles([]tpl.Template{parsed}, varReader, lock)
+			assert.OK(t, err)
+			assert.Equal(t, changed, tc.changed)
+			assert.Equal(t, io.StdOut.String(), strings.Replace(tc.expected, "OUT", outFile, -1))
+
+			// Nothing is written.
+			current, err := ioutil.ReadFile(outFile)
+			if tc.current == nil {
+				assert.Equal(t, os.IsNotExist(err), true)
+			} else {
+				assert.OK(t, err)
+				assert.Equal(t, string(current), *tc.current)
+			}
+		})
+	}
+}
+
+func TestInjectCommand_Run_diff(t *testing.T) {
+	cases := map[string]struct {
+		current string
+		err     error
+	}{
+		"unchanged": {
+			current: "password = new\n",
+		},
+		"changed": {
+			current: "password = old\n",
+			err:     ExitError{Code: diffExitCode},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			dir, cleanup := testdata.tempDir(t)
+			defer cleanup()
+
+			inFile := filepath.Join(dir, "app.conf.tpl")
+			err := ioutil.WriteFile(inFile, []byte("password = {{ company/app/password }}\n"), 0600)
+			assert.OK(t, err)
+
+			outFile := filepath.Join(dir, "app.conf")
+			err = ioutil.WriteFile(outFile, []byte(tc.current), 0600)
+			assert.OK(t, err)
+
+			cmd := InjectCommand{
+				io:                            ui.NewFakeIO(),
+				inFiles:                       []string{inFile},
+				outFiles:                      []string{outFile},
+				showDiff:                      true,
+				templateVersion:               "auto",
+				lockFile:                      filepath.Join(dir, defaultLockFile),
+				dontPromptMissingTemplateVars: true,
+				newClient: func() (secrethub.ClientInterface, error) {
+					return fakeclient.Client{
+						SecretService: &fakeclient.SecretService{
+							VersionService: &fakeclient.SecretVersionService{
+								WithDataGetter: fakeclient.WithDataGetter{
+									ReturnsVersion: &api.SecretVersion{
+										Version: 2,
+										Data:    []byte("new"),
+									},
+								},
+							},
+						},
+					}, nil
+				},
+			}
+
+			err = cmd.Run()
+			assert.Equal(t, err, tc.err)
+		})
+	}
+}
+
+func TestInjectCommand_Run_diffInDir(t *testing.T) {
+	cmd := InjectCommand{
+		io:       ui.NewFakeIO(),
+		inDir:    "templates",
+		outDir:   "out",
+		showDiff: true,
+	}
+
+	err := cmd.Run()
+	assert.Equal(t, err, ErrFlagsConflict("--in-dir and --diff"))
+}
+
+func strPtr(s string) *string {
+	return &s
+}
@@ -0,0 +1,163 @@
+package secrethub
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/secrethub/secrethub-cli/internals/secrethub/tpl"
+)
+
+// Errors
+var (
+	ErrCannotInjectFile    = errMain.Code("cannot_inject_file").ErrorPref("could not inject %s: %s")
+	ErrTemplateDirConflict = errMain.Code("template_dir_conflict").ErrorPref("%s and %s would both be written to %s")
+)
+
+// templateFileExtension is the extension of the files in the directory tree given with --in-dir
+// that are templates. The extension is removed from the path the template is injected into.
+const templateFileExtension = ".tpl"
+
+// templateDirFile is a file or directory in the directory tree given with --in-dir.
+type templateDirFile struct {
+	// path is the path of the output file relative to the root of the directory tree.
+	path string
+	mode os.FileMode
+	// raw is the contents of a file that is not a template, which is copied unchanged.
+	raw []byte
+	// template is the parsed template of a template file.
+	template tpl.Template
+}
+
+// injectDir injects all templates in the directory tree of --in-dir into
+// the files with the same relative paths in --out-dir. The secrets are read
+// once for all templates. Only the files that changed are written and printed.
+func (cmd *InjectCommand) injectDir(varReader tpl.VariableReader, lock *lockFile) error {
+	files, err := cmd.readTemplateDir()
+	if err != nil {
+		return err
+	}
+
+	var templates []tpl.Template
+	for _, file := range files {
+		if file.template != nil {
+			templates = append(templates, file.template)
+		}
+	}
+
+	injected, err := cmd.inject(templates, varReader, lock)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		outPath := filepath.Join(cmd.outDir, file.path)
+		if file.mode.IsDir() {
+			err = os.MkdirAll(outPath, file.mode.Perm())
+			if err != nil {
+				return ErrCannotWrite(outPath, err)
+			}
+			continue
+		}
+
+		contents := file.raw
+		if file.template != nil {
+			contents = []byte(injected[0])
+			injected = injected[1:]
+		}
+
+		changed, err := writeFileIfChanged(outPath, contents, file.mode.Perm())
+		if err != nil {
+			return ErrCannotWrite(outPath, err)
+		}
+		if !changed {
+			continue
+		}
+
+		absPath, err := filepath.Abs(outPath)
+		if err != nil {
+			return ErrCannotWrite(err)
+		}
+		fmt.Fprintf(cmd.io.Stdout(), "%s\n", absPath)
+	}
+
+	return nil
+}
+
+// readTemplateDir reads the directory tree of --in-dir and parses the template files in it,
+// which are the files with the templateFileExtension. Directories are returned before the
+// files in them.
+func (cmd *InjectCommand) readTemplateDir() ([]templateDirFile, error) {
+	var files []templateDirFile
+	// written contains the input path of every output path.
+	written := make(map[string]string)
+	err := filepath.Walk(cmd.inDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return ErrReadFile(path, err)
+		}
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(cmd.inDir, path)
+		if err != nil {
+			return ErrReadFile(path, err)
+		}
+
+		file := templateDirFile{
+			path: relPath,
+			mode: info.Mode(),
+		}
+
+		if !info.IsDir() {
+			raw, err := ioutil.ReadFile(path)
+			if err != nil {
+				return ErrReadFile(path, err)
+			}
+
+			if strings.HasSuffix(relPath, templateFileExtension) {
+				file.path = strings.TrimSuffix(relPath, templateFileExtension)
+				file.template, err = cmd.parseTemplate(raw, path)
+				if err != nil {
+					return ErrCannotInjectFile(path, err)
+				}
+			} else {
+				file.raw = raw
+			}
+
+			if other, ok := written[file.path]; ok {
+				return ErrTemplateDirConflict(other, path, filepath.Join(cmd.outDir, file.path))
+			}
+			written[file.path] = path
+		}
+
+		files = append(files, file)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// writeFileIfChanged atomically replaces the file at the given path when its
+// contents or mode differ from the given contents and mode. It returns whether
+// the file is written.
+func writeFileIfChanged(path string, data []byte, mode os.FileMode) (bool, error) {
+	info, err := os.Stat(path)
+	if err == nil && info.Mode().Perm() == mode {
+		current, err := ioutil.ReadFile(path)
+		if err == nil && bytes.Equal(current, data) {
+			return false, nil
+		}
+	}
+
+	err = writeFileAtomic(path, data, mode)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
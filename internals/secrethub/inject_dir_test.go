@@ -0,0 +1,157 @@
+package secrethub
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/secrethub/secrethub-cli/internals/cli/ui"
+
+	"github.com/secrethub/secrethub-go/internals/api"
+	"github.com/secrethub/secrethub-go/internals/assert"
+	"github.com/secrethub/secrethub-go/pkg/secrethub"
+	"github.com/secrethub/secrethub-go/pkg/secrethub/fakeclient"
+)
+
+func TestInjectCommand_injectDir(t *testing.T) {
+	dir, cleanup := testdata.tempDir(t)
+	defer cleanup()
+
+	inDir := filepath.Join(dir, "templates")
+	outDir := filepath.Join(dir, "out")
+
+	binary := []byte{0x89, 'P', 'N', 'G', 0x00, 0xff}
+	inFiles := map[string]struct {
+		contents []byte
+		mode     os.FileMode
+	}{
+		"app.conf.tpl": {
+			contents: []byte("password = {{ company/app/password }}\n"),
+			mode:     0640,
+		},
+		"logo.png": {
+			contents: binary,
+			mode:     0644,
+		},
+		"nested/db.yml.tpl": {
+			contents: []byte("password: {{company/app/password}}"),
+			mode:     0600,
+		},
+		// Files without the .tpl extension are not templates, even when they look like one.
+		"start.sh": {
+			contents: []byte("#!/bin/sh\necho ${HOME}\n"),
+			mode:     0755,
+		},
+	}
+	for name, file := range inFiles {
+		path := filepath.Join(inDir, name)
+		err := os.MkdirAll(filepath.Dir(path), 0700)
+		assert.OK(t, err)
+		err = ioutil.WriteFile(path, file.contents, file.mode)
+		assert.OK(t, err)
+		err = os.Chmod(path, file.mode)
+		assert.OK(t, err)
+	}
+
+	// The output file of nested/db.yml is already up to date.
+	err := os.MkdirAll(filepath.Join(outDir, "nested"), 0700)
+	assert.OK(t, err)
+	err = ioutil.WriteFile(filepath.Join(outDir, "nested/db.yml"), []byte("password: secret"), 0600)
+	assert.OK(t, err)
+
+	io := ui.NewFakeIO()
+	cmd := InjectCommand{
+		io:                            io,
+		inDir:                         inDir,
+		outDir:                        outDir,
+		templateVersion:               "auto",
+		lockFile:                      filepath.Join(dir, defaultLockFile),
+		dontPromptMissingTemplateVars: true,
+		newClient: func() (secrethub.ClientInterface, error) {
+			return fakeclient.Client{
+				SecretService: &fakeclient.SecretService{
+					VersionService: &fakeclient.SecretVersionService{
+						WithDataGetter: fakeclient.WithDataGetter{
+							ReturnsVersion: &api.SecretVersion{Data: []byte("secret")},
+						},
+					},
+				},
+			}, nil
+		},
+	}
+
+	err = cmd.Run()
+	assert.OK(t, err)
+
+	absOutDir, err := filepath.Abs(outDir)
+	assert.OK(t, err)
+	expectedOut := filepath.Join(absOutDir, "app.conf") + "\n" +
+		filepath.Join(absOutDir, "logo.png") + "\n" +
+		filepath.Join(absOutDir, "start.sh") + "\n"
+	assert.Equal(t, io.StdOut.String(), expectedOut)
+
+	expected := map[string]struct {
+		contents []byte
+		mode     os.FileMode
+	}{
+		"app.conf": {
+			contents: []byte("password = secret\n"),
+			mode:     0640,
+		},
+		"logo.png": {
+			contents: binary,
+			mode:     0644,
+		},
+		"nested/db.yml": {
+			contents: []byte("password: secret"),
+			mode:     0600,
+		},
+		"start.sh": {
+			contents: []byte("#!/bin/sh\necho ${HOME}\n"),
+			mode:     0755,
+		},
+	}
+	for name, file := range expected {
+		path := filepath.Join(outDir, name)
+		contents, err := ioutil.ReadFile(path)
+		assert.OK(t, err)
+		assert.Equal(t, contents, file.contents)
+
+		info, err := os.Stat(path)
+		assert.OK(t, err)
+		assert.Equal(t, info.Mode().Perm(), file.mode)
+	}
+
+	// Nothing changed, so nothing is written.
+	io = ui.NewFakeIO()
+	cmd.io = io
+	err = cmd.Run()
+	assert.OK(t, err)
+	assert.Equal(t, io.StdOut.String(), "")
+}
+
+func TestInjectCommand_injectDir_conflict(t *testing.T) {
+	dir, cleanup := testdata.tempDir(t)
+	defer cleanup()
+
+	inDir := filepath.Join(dir, "templates")
+	outDir := filepath.Join(dir, "out")
+
+	err := os.MkdirAll(inDir, 0700)
+	assert.OK(t, err)
+	for _, name := range []string{"app.conf", "app.conf.tpl"} {
+		err = ioutil.WriteFile(filepath.Join(inDir, name), []byte("password = {{ company/app/password }}\n"), 0600)
+		assert.OK(t, err)
+	}
+
+	cmd := InjectCommand{
+		io:              ui.NewFakeIO(),
+		inDir:           inDir,
+		outDir:          outDir,
+		templateVersion: "auto",
+	}
+
+	_, err = cmd.readTemplateDir()
+	assert.Equal(t, err, ErrTemplateDirConflict(filepath.Join(inDir, "app.conf"), filepath.Join(inDir, "app.conf.tpl"), filepath.Join(outDir, "app.conf")))
+}
@@ -0,0 +1,173 @@
+package secrethub
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"time"
+
+	"github.com/secrethub/secrethub-cli/internals/cli/posix"
+	"github.com/secrethub/secrethub-cli/internals/secrethub/tpl"
+)
+
+// Errors
+var (
+	ErrInjectRefreshFailed = errMain.Code("inject_refresh_failed").ErrorPref("could not refresh the output files, keeping the current ones: %s")
+	ErrOnChangeFailed      = errMain.Code("on_change_failed").ErrorPref("the --on-change command failed: %s")
+)
+
+// injectWatcher periodically injects templates into their output files
+// and runs a command when any of the output files changed.
+type injectWatcher struct {
+	cmd       *InjectCommand
+	templates []tpl.Template
+	varReader tpl.VariableReader
+	lock      *lockFile
+	// contents are the current contents of the output files.
+	contents [][]byte
+	onChange func() error
+}
+
+// newInjectWatcher creates a watcher for the given templates, which are
+// written to the output files of the command.
+func newInjectWatcher(cmd *InjectCommand, templates []tpl.Template, varReader tpl.VariableReader, lock *lockFile) (*injectWatcher, error) {
+	w := &injectWatcher{
+		cmd:       cmd,
+		templates: templates,
+		varReader: varReader,
+		lock:      lock,
+		contents:  make([][]byte, len(cmd.outFiles)),
+	}
+
+	for i, outFile := range cmd.outFiles {
+		contents, err := ioutil.ReadFile(outFile)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, ErrReadFile(outFile, err)
+		}
+		w.contents[i] = contents
+	}
+
+	if cmd.onChange != "" {
+		w.onChange = func() error {
+			command := shellCommand(cmd.onChange)
+			command.Stdout = os.Stdout
+			command.Stderr = os.Stderr
+			return command.Run()
+		}
+	}
+
+	return w, nil
+}
+
+// run writes the output files and then checks for updated secrets every
+// watch interval, until the process is interrupted or terminated.
+func (w *injectWatcher) run() error {
+	err := w.refresh()
+	if err != nil {
+		return err
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	ticker := time.NewTicker(w.cmd.watchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-signals:
+			return nil
+		case <-ticker.C:
+			err := w.refresh()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, ErrInjectRefreshFailed(err))
+			}
+		}
+	}
+}
+
+// refresh injects the templates and replaces the output files of which the
+// contents changed. When any of the files changed, the --on-change command is run.
+// When a template cannot be injected, none of the files are replaced.
+func (w *injectWatcher) refresh() error {
+	injected, err := w.cmd.inject(w.templates, w.varReader, w.lock)
+	if err != nil {
+		return err
+	}
+
+	changed := false
+	for i, out := range injected {
+		contents := posix.AddNewLine([]byte(out))
+		if w.contents[i] != nil && bytes.Equal(contents, w.contents[i]) {
+			continue
+		}
+
+		outFile := w.cmd.outFiles[i]
+		err = writeFileAtomic(outFile, contents, w.cmd.fileMode.FileMode())
+		if err != nil {
+			return ErrCannotWrite(outFile, err)
+		}
+		w.contents[i] = contents
+		changed = true
+
+		absPath, err := filepath.Abs(outFile)
+		if err != nil {
+			return ErrCannotWrite(err)
+		}
+		fmt.Fprintf(w.cmd.io.Stdout(), "%s\n", absPath)
+	}
+
+	if changed && w.onChange != nil {
+		err = w.onChange()
+		if err != nil {
+			return ErrOnChangeFailed(err)
+		}
+	}
+
+	return nil
+}
+
+// writeFileAtomic writes the data to a temporary file in the directory of the
+// given file and renames it to the file, so that readers of the file never see
+// a partially written file. The file gets the given mode.
+func writeFileAtomic(path string, data []byte, mode os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+
+	err = tmp.Chmod(mode)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// shellCommand returns a command that runs the given command line with the shell of the platform.
+func shellCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", command)
+	}
+	return exec.Command("/bin/sh", "-c", command)
+}
@@ -0,0 +1,202 @@
+package secrethub
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/secrethub/secrethub-cli/internals/cli/filemode"
+	"github.com/secrethub/secrethub-cli/internals/cli/ui"
+	"github.com/secrethub/secrethub-cli/internals/secrethub/tpl"
+
+	"github.com/secrethub/secrethub-go/internals/api"
+	"github.com/secrethub/secrethub-go/internals/assert"
+	"github.com/secrethub/secrethub-go/pkg/secrethub"
+	"github.com/secrethub/secrethub-go/pkg/secrethub/fakeclient"
+)
+
+func TestInjectWatcher_refresh(t *testing.T) {
+	dir, cleanup := testdata.tempDir(t)
+	defer cleanup()
+
+	outFiles := []string{
+		filepath.Join(dir, "a.conf"),
+		filepath.Join(dir, "b.conf"),
+	}
+	err := ioutil.WriteFile(outFiles[1], []byte("static\n"), 0600)
+	assert.OK(t, err)
+
+	getter := &fakeclient.WithDataGetter{
+		ReturnsVersion: &api.SecretVersion{Data: []byte("first")},
+	}
+	cmd := &InjectCommand{
+		io:       ui.NewFakeIO(),
+		outFiles: outFiles,
+		fileMode: filemode.New(0600),
+		lockFile: filepath.Join(dir, defaultLockFile),
+		newClient: func() (secrethub.ClientInterface, error) {
+			return fakeclient.Client{
+				SecretService: &fakeclient.SecretService{
+					VersionService: &fakeclient.SecretVersionService{
+						WithDataGetter: *getter,
+					},
+				},
+			}, nil
+		},
+	}
+
+	parser := tpl.NewV2Parser()
+	templateA, err := parser.Parse("password: {{ company/app/password }}", 1, 1)
+	assert.OK(t, err)
+	templateB, err := parser.Parse("static", 1, 1)
+	assert.OK(t, err)
+
+	lock, err := readLockFile(cmd.lockFile)
+	assert.OK(t, err)
+
+	varReader, err := newVariableReader(nil, nil)
+	assert.OK(t, err)
+
+	w, err := newInjectWatcher(cmd, []tpl.Template{templateA, templateB}, varReader, lock)
+	assert.OK(t, err)
+
+	changes := 0
+	w.onChange = func() error {
+		changes++
+		return nil
+	}
+
+	assertFiles := func(t *testing.T, expectedChanges int, expectedA string) {
+		assert.Equal(t, changes, expectedChanges)
+
+		a, err := ioutil.ReadFile(outFiles[0])
+		assert.OK(t, err)
+		assert.Equal(t, string(a), expectedA)
+
+		b, err := ioutil.ReadFile(outFiles[1])
+		assert.OK(t, err)
+		assert.Equal(t, string(b), "static\n")
+
+		files, err := ioutil.ReadDir(dir)
+		assert.OK(t, err)
+		assert.Equal(t, len(files), 2)
+	}
+
+	err = w.refresh()
+	assert.OK(t, err)
+	assertFiles(t, 1, "password: first\n")
+
+	err = w.refresh()
+	assert.OK(t, err)
+	assertFiles(t, 1, "password: first\n")
+
+	getter.ReturnsVersion = &api.SecretVersion{Data: []byte("second")}
+	err = w.refresh()
+	assert.OK(t, err)
+	assertFiles(t, 2, "password: second\n")
+
+	getter.Err = api.ErrSecretNotFound
+	err = w.refresh()
+	assert.Equal(t, err, api.ErrSecretNotFound)
+	assertFiles(t, 2, "password: second\n")
+
+	getter.Err = nil
+	getter.ReturnsVersion = &api.SecretVersion{Data: []byte("third")}
+	w.onChange = func() error {
+		return errors.New("exit status 1")
+	}
+	err = w.refresh()
+	assert.Equal(t, err, ErrOnChangeFailed(errors.New("exit status 1")))
+	assertFiles(t, 2, "password: third\n")
+}
+
+func TestInjectCommand_Run_watchLock(t *testing.T) {
+	dir, cleanup := testdata.tempDir(t)
+	defer cleanup()
+
+	lockFile := filepath.Join(dir, defaultLockFile)
+	err := ioutil.WriteFile(lockFile, []byte("secrets:\n  company/app/password: 1\n"), 0644)
+	assert.OK(t, err)
+
+	cases := map[string]struct {
+		updateLock bool
+		err        error
+	}{
+		"update lock": {
+			updateLock: true,
+			err:        ErrFlagsConflict("--watch and --update-lock"),
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cmd := &InjectCommand{
+				io:                            ui.NewFakeIO(),
+				inFiles:                       []string{filepath.Join(dir, "app.conf.tpl")},
+				outFiles:                      []string{filepath.Join(dir, "app.conf")},
+				watch:                         true,
+				watchInterval:                 time.Minute,
+				lockFile:                      lockFile,
+				updateLock:                    tc.updateLock,
+				dontPromptMissingTemplateVars: true,
+			}
+
+			err := cmd.Run()
+			assert.Equal(t, err, tc.err)
+		})
+	}
+}
+
+func TestInjectCommand_Run_watchOverwrite(t *testing.T) {
+	dir, cleanup := testdata.tempDir(t)
+	defer cleanup()
+
+	inFile := filepath.Join(dir, "app.conf.tpl")
+	err := ioutil.WriteFile(inFile, []byte("password: {{ company/app/password }}\n"), 0644)
+	assert.OK(t, err)
+
+	outFile := filepath.Join(dir, "app.conf")
+	err = ioutil.WriteFile(outFile, []byte("password: old\n"), 0644)
+	assert.OK(t, err)
+
+	cases := map[string]struct {
+		piped  bool
+		answer string
+		out    string
+		err    error
+	}{
+		"piped": {
+			piped: true,
+			err:   ErrFileAlreadyExists,
+		},
+		"not confirmed": {
+			answer: "n\n",
+			out:    "Aborting.\n",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			io := ui.NewFakeIO()
+			io.StdOut.Piped = tc.piped
+			io.PromptIn.WriteString(tc.answer)
+
+			cmd := &InjectCommand{
+				io:                            io,
+				inFiles:                       []string{inFile},
+				outFiles:                      []string{outFile},
+				watch:                         true,
+				watchInterval:                 time.Minute,
+				lockFile:                      filepath.Join(dir, defaultLockFile),
+				templateVersion:               "auto",
+				dontPromptMissingTemplateVars: true,
+			}
+
+			err := cmd.Run()
+			assert.Equal(t, err, tc.err)
+			assert.Equal(t, io.StdOut.String(), tc.out)
+		})
+	}
+}
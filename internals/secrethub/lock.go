@@ -0,0 +1,168 @@
+package secrethub
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+
+	"github.com/secrethub/secrethub-cli/internals/secrethub/tpl"
+
+	"github.com/secrethub/secrethub-go/internals/api"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Errors
+var (
+	ErrReadLockFile    = errMain.Code("lock_file_read_error").ErrorPref("could not read the lockfile %s: %s")
+	ErrInvalidLockFile = errMain.Code("invalid_lock_file").ErrorPref("lockfile %s is invalid: %s")
+)
+
+const (
+	// defaultLockFile is the lockfile that is used when no other lockfile is specified.
+	defaultLockFile = "secrethub.lock"
+	// lockFileMode is the file mode of newly created lockfiles. Lockfiles do not
+	// contain any secrets and are meant to be committed together with the templates.
+	lockFileMode = 0644
+	// lockFileHeader is written at the top of every lockfile.
+	lockFileHeader = "# This file pins the versions of the secrets used in templates and env-files.\n" +
+		"# It is generated by `secrethub template lock` and should not be edited manually.\n"
+)
+
+// lockFile pins the versions of secrets by their path. Secrets that are in the lockfile
+// are read at their pinned version instead of at their latest version.
+type lockFile struct {
+	path    string
+	Secrets map[string]int `yaml:"secrets"`
+}
+
+// newLockFile returns an empty lockfile that is written to the given path.
+func newLockFile(path string) *lockFile {
+	return &lockFile{
+		path:    path,
+		Secrets: make(map[string]int),
+	}
+}
+
+// readLockFile reads the lockfile at the given path. When the file does
+// not exist, an empty lockfile is returned.
+func readLockFile(path string) (*lockFile, error) {
+	lock := newLockFile(path)
+
+	raw, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return lock, nil
+	}
+	if err != nil {
+		return nil, ErrReadLockFile(path, err)
+	}
+
+	err = yaml.UnmarshalStrict(raw, lock)
+	if err != nil {
+		return nil, ErrInvalidLockFile(path, err)
+	}
+	if lock.Secrets == nil {
+		lock.Secrets = make(map[string]int)
+	}
+
+	for secretPath, version := range lock.Secrets {
+		p, err := api.NewSecretPath(secretPath)
+		if err != nil {
+			return nil, ErrInvalidLockFile(path, err)
+		}
+		if p.HasVersion() || version < 1 {
+			return nil, ErrInvalidLockFile(path, api.ErrInvalidSecretVersion)
+		}
+	}
+
+	return lock, nil
+}
+
+// write writes the lockfile to its path.
+func (l *lockFile) write() error {
+	raw, err := yaml.Marshal(l)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(lockFileHeader)
+	buf.Write(raw)
+
+	err = ioutil.WriteFile(l.path, buf.Bytes(), lockFileMode)
+	if err != nil {
+		return ErrCannotWrite(l.path, err)
+	}
+	return nil
+}
+
+// update replaces the pinned secrets with the given secrets at the given versions, so that
+// secrets that are no longer read are removed. Paths that already contain a version are skipped.
+func (l *lockFile) update(versions map[string]int) {
+	l.Secrets = make(map[string]int, len(versions))
+	for path, version := range versions {
+		if version > 0 && !hasVersion(path) {
+			l.Secrets[path] = version
+		}
+	}
+}
+
+// pin returns the given path with the version of the secret in the lockfile added
+// to it. The path is returned as is when it is not in the lockfile or when it already
+// contains a version. A nil lockfile does not pin any secrets.
+func (l *lockFile) pin(path string) string {
+	if l == nil {
+		return path
+	}
+
+	secretPath, field := splitSecretField(path)
+	version, ok := l.Secrets[secretPath]
+	if !ok || hasVersion(secretPath) {
+		return path
+	}
+
+	p, err := api.NewSecretPath(secretPath)
+	if err != nil {
+		return path
+	}
+	pinned, err := p.AddVersion(version)
+	if err != nil {
+		return path
+	}
+	return joinSecretField(pinned.Value(), field)
+}
+
+// hasVersion returns whether the given secret path contains a version.
+func hasVersion(path string) bool {
+	p, err := api.NewSecretPath(path)
+	return err == nil && p.HasVersion()
+}
+
+// lockedSecretReader reads the secrets that are in the lockfile at their pinned version.
+type lockedSecretReader struct {
+	secretReader tpl.SecretReader
+	lock         *lockFile
+}
+
+// newLockedSecretReader wraps a secret reader to read secrets at the versions pinned in the given lockfile.
+func newLockedSecretReader(sr tpl.SecretReader, lock *lockFile) *lockedSecretReader {
+	return &lockedSecretReader{
+		secretReader: sr,
+		lock:         lock,
+	}
+}
+
+// ReadSecret reads the secret at the version pinned in the lockfile.
+func (sr *lockedSecretReader) ReadSecret(path string) (string, error) {
+	return sr.secretReader.ReadSecret(sr.lock.pin(path))
+}
+
+// LookupSecret implements tpl.SecretLookupReader.
+func (sr *lockedSecretReader) LookupSecret(path string) (string, bool, error) {
+	return tpl.LookupSecret(sr.secretReader, sr.lock.pin(path))
+}
+
+// ListSecrets implements tpl.SecretDirReader.
+func (sr *lockedSecretReader) ListSecrets(dirPath string) ([]string, error) {
+	return tpl.ListSecrets(sr.secretReader, dirPath)
+}
@@ -0,0 +1,114 @@
+package secrethub
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/secrethub/secrethub-go/internals/api"
+	"github.com/secrethub/secrethub-go/internals/assert"
+)
+
+func TestLockFile(t *testing.T) {
+	dir, cleanup := testdata.tempDir(t)
+	defer cleanup()
+
+	path := filepath.Join(dir, defaultLockFile)
+
+	// A lockfile that does not exist is empty.
+	lock, err := readLockFile(path)
+	assert.OK(t, err)
+	assert.Equal(t, lock.Secrets, map[string]int{})
+
+	lock.update(map[string]int{
+		"company/app/db":    3,
+		"company/app/key":   1,
+		"company/app/old:2": 2,
+	})
+	err = lock.write()
+	assert.OK(t, err)
+
+	raw, err := ioutil.ReadFile(path)
+	assert.OK(t, err)
+	assert.Equal(t, string(raw), lockFileHeader+
+		"secrets:\n"+
+		"  company/app/db: 3\n"+
+		"  company/app/key: 1\n")
+
+	lock, err = readLockFile(path)
+	assert.OK(t, err)
+	assert.Equal(t, lock.Secrets, map[string]int{
+		"company/app/db":  3,
+		"company/app/key": 1,
+	})
+
+	assert.Equal(t, lock.pin("company/app/db"), "company/app/db:3")
+	assert.Equal(t, lock.pin("company/app/db:1"), "company/app/db:1")
+	assert.Equal(t, lock.pin("company/app/other"), "company/app/other")
+	assert.Equal(t, lock.pin("company/app/db#.host"), "company/app/db:3#.host")
+
+	// Secrets that are no longer read are removed.
+	lock.update(map[string]int{
+		"company/app/db": 4,
+	})
+	assert.Equal(t, lock.Secrets, map[string]int{
+		"company/app/db": 4,
+	})
+}
+
+func TestReadLockFile_Invalid(t *testing.T) {
+	dir, cleanup := testdata.tempDir(t)
+	defer cleanup()
+
+	cases := map[string]struct {
+		raw string
+		err error
+	}{
+		"unknown field": {
+			raw: "versions:\n  company/app/db: 3\n",
+		},
+		"versioned path": {
+			raw: "secrets:\n  company/app/db:1: 3\n",
+			err: api.ErrInvalidSecretVersion,
+		},
+		"invalid version": {
+			raw: "secrets:\n  company/app/db: 0\n",
+			err: api.ErrInvalidSecretVersion,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, defaultLockFile)
+			err := ioutil.WriteFile(path, []byte(tc.raw), lockFileMode)
+			assert.OK(t, err)
+
+			_, err = readLockFile(path)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if tc.err != nil {
+				assert.Equal(t, err, ErrInvalidLockFile(path, tc.err))
+			}
+		})
+	}
+}
+
+func TestLockedSecretReader(t *testing.T) {
+	sr := &countingSecretReader{
+		reads: make(map[string]int),
+	}
+	lock := newLockFile(defaultLockFile)
+	lock.Secrets["company/app/db"] = 3
+
+	locked := newLockedSecretReader(sr, lock)
+
+	secret, err := locked.ReadSecret("company/app/db")
+	assert.OK(t, err)
+	assert.Equal(t, secret, "value of company/app/db:3")
+
+	secret, ok, err := locked.LookupSecret("company/app/key")
+	assert.OK(t, err)
+	assert.Equal(t, ok, true)
+	assert.Equal(t, secret, "value of company/app/key")
+}
@@ -0,0 +1,184 @@
+package secrethub
+
+import (
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/secrethub/secrethub-cli/internals/cli/masker"
+	"github.com/secrethub/secrethub-cli/internals/cli/ui"
+	"github.com/secrethub/secrethub-cli/internals/secrethub/command"
+	"github.com/secrethub/secrethub-cli/internals/secrethub/tpl"
+
+	"github.com/secrethub/secrethub-go/internals/api"
+	"github.com/secrethub/secrethub-go/internals/errio"
+)
+
+// Errors
+var (
+	errMask            = errio.Namespace("mask")
+	ErrNoSecretsToMask = errMask.Code("no_secrets").Error("no secrets to mask: provide secret paths as arguments or use the --envar or --env-file flags")
+	ErrSecretsMasked   = errMask.Code("secrets_masked").Error("secrets were found in the input and have been masked")
+)
+
+// MaskCommand masks secrets in data read from stdin and writes the result to stdout.
+type MaskCommand struct {
+	envSourceFlags
+	io                   ui.IO
+	paths                []string
+	maskingTimeout       time.Duration
+	maskEncodings        string
+	failOnMatch          bool
+	ignoreMissingSecrets bool
+	lockFile             string
+	newClient            newClientFunc
+}
+
+// NewMaskCommand creates a new MaskCommand.
+func NewMaskCommand(io ui.IO, newClient newClientFunc) *MaskCommand {
+	return &MaskCommand{
+		envSourceFlags: newEnvSourceFlags(),
+		io:             io,
+		newClient:      newClient,
+	}
+}
+
+// Register registers the command, arguments and flags on the provided Registerer.
+func (cmd *MaskCommand) Register(r command.Registerer) {
+	clause := r.Command("mask", "Mask secrets in data read from stdin.")
+	clause.HelpLong("The secrets to mask are read from the given secret paths and the secrets used in the environment as configured for the run command with the --envar, --env-file and --env-dir flags. " +
+		"Every occurrence of a secret in the data read from stdin is replaced by \"" + maskString + "\" before it is written to stdout. " +
+		"Output is buffered to detect secrets, up to a maximum duration as defined by the --masking-timeout flag.")
+	clause.Arg("secret-path", "The paths to secrets to mask").PlaceHolder(secretPathOptionalVersionPlaceHolder).StringsVar(&cmd.paths)
+	clause.Flag("envar", "Mask the secret used for an environment variable with `NAME=<path>`").Short('e').StringMapVar(&cmd.envar)
+	clause.Flag("env-file", "Mask the secrets used in an env-file as used by the run command. Can be used multiple times. When no env-file is given, the secrethub.env file in the working directory or the closest of its parent directories is used.").StringsVar(&cmd.envFiles)
+	clause.Flag("env-dir", "Mask every secret in the directory at the given path. Can be used multiple times.").PlaceHolder(optionalDirPathPlaceHolder).StringsVar(&cmd.secretDirs)
+	clause.Flag("env-dir-recursive", "Also mask the secrets in all subdirectories of the directories given with --env-dir.").BoolVar(&cmd.secretDirRecursive)
+	clause.Flag("var", "Define the value for a template variable with `VAR=VALUE`, e.g. --var env=prod").Short('v').StringMapVar(&cmd.templateVars)
+	clause.Flag("var-file", "Read template variables from a YAML file with `VAR: VALUE` mappings. Can be used multiple times, in which case later files take precedence. Variables defined with --var or SECRETHUB_VAR_ environment variables take precedence over variable files.").StringsVar(&cmd.varFiles)
+	clause.Flag("environment", "Read template variables from the file secrethub.<environment>.vars.yml, e.g. --environment prod reads secrethub.prod.vars.yml. Variables from files given with --var-file take precedence.").StringVar(&cmd.environment)
+	clause.Flag("env", "The name of the environment prepared by the set command (default is `default`)").Default("default").Hidden().StringVar(&cmd.env)
+	clause.Flag("template-version", "The template syntax version to be used. The options are v1, v2, v3, latest or auto to automatically detect the version.").Default("auto").StringVar(&cmd.templateVersion)
+	clause.Flag("lock-file", "The path to a lockfile that pins the versions of the secrets that are read. It is used when it exists.").Default(defaultLockFile).StringVar(&cmd.lockFile)
+	clause.Flag("masking-timeout", "The maximum time output is buffered. Warning: lowering this value increases the chance of secrets not being masked.").Default("1s").DurationVar(&cmd.maskingTimeout)
+	clause.Flag("mask-encodings", "A comma-separated list of encodings of the secrets that should be masked as well. The options are "+strings.Join(masker.EncodingNames(), ", ")+". Set to an empty value to only mask the secrets as they are.").Default(strings.Join(masker.EncodingNames(), ",")).StringVar(&cmd.maskEncodings)
+	clause.Flag("fail-on-match", "Exit with a non-zero exit code when any secret has been masked.").BoolVar(&cmd.failOnMatch)
+	clause.Flag("ignore-missing-secrets", "Do not return an error when a secret does not exist.").BoolVar(&cmd.ignoreMissingSecrets)
+	clause.Flag("no-prompt", "Do not prompt when a template variable is missing and return an error instead.").BoolVar(&cmd.dontPromptMissingTemplateVar)
+
+	command.BindAction(clause, cmd.Run)
+}
+
+// Run masks the secrets in the data read from stdin and writes the result to stdout.
+func (cmd *MaskCommand) Run() error {
+	encodings, err := parseMaskEncodings(cmd.maskEncodings)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range cmd.paths {
+		err = api.ValidateSecretPath(path)
+		if err != nil {
+			return err
+		}
+	}
+
+	envSources, err := cmd.sourceEnvironment()
+	if err != nil {
+		return err
+	}
+
+	if len(cmd.paths) == 0 && len(envSources) == 0 {
+		return ErrNoSecretsToMask
+	}
+
+	values, err := cmd.readSecrets(envSources)
+	if err != nil {
+		return err
+	}
+
+	var masks [][]byte
+	for _, val := range values {
+		if val != "" {
+			masks = append(masks, []byte(val))
+		}
+	}
+	masks = masker.WithEncodings(masks, encodings...)
+
+	maskedStdout := masker.NewMaskedWriter(cmd.io.Stdout(), masks, maskString, cmd.maskingTimeout)
+	go maskedStdout.Run()
+
+	_, err = io.Copy(maskedStdout, cmd.io.Stdin())
+	if err != nil {
+		return err
+	}
+
+	err = maskedStdout.Flush()
+	if err != nil {
+		return err
+	}
+
+	if cmd.failOnMatch {
+		for _, n := range maskedStdout.Matches() {
+			if n > 0 {
+				return ErrSecretsMasked
+			}
+		}
+	}
+
+	return nil
+}
+
+// sourceEnvironment returns the configured sources of environment variables,
+// in the same way as the run command does.
+func (cmd *MaskCommand) sourceEnvironment() ([]EnvSource, error) {
+	osEnv, _ := parseKeyValueStringsToMap(os.Environ())
+	return cmd.envSourceFlags.sourceEnvironment(cmd.io, cmd.newClient, osEnv)
+}
+
+// readSecrets reads the secrets at the given paths and the secrets used in the
+// given sources and returns their values.
+func (cmd *MaskCommand) readSecrets(envSources []EnvSource) ([]string, error) {
+	lock, err := readLockFile(cmd.lockFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var sr tpl.SecretReader = newLockedSecretReader(newSecretReader(cmd.newClient), lock)
+	if cmd.ignoreMissingSecrets {
+		sr = newIgnoreMissingSecretReader(sr)
+	}
+	secretReader := newBufferedSecretReader(sr)
+
+	err = secretReader.Prefetch(cmd.paths)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range cmd.paths {
+		_, err := secretReader.ReadSecret(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, source := range envSources {
+		secrets := make(map[string]string)
+		for _, path := range source.Secrets() {
+			secret, err := secretReader.ReadSecret(path)
+			if err != nil {
+				return nil, err
+			}
+			secrets[path] = secret
+		}
+
+		// Evaluating the environment reads all secrets used in templates.
+		_, err := source.Env(secrets, secretReader)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return secretReader.Values(), nil
+}
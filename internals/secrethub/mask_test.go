@@ -0,0 +1,160 @@
+package secrethub
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/secrethub/secrethub-cli/internals/cli/ui"
+
+	"github.com/secrethub/secrethub-go/internals/api"
+	"github.com/secrethub/secrethub-go/internals/assert"
+	"github.com/secrethub/secrethub-go/pkg/secrethub"
+	"github.com/secrethub/secrethub-go/pkg/secrethub/fakeclient"
+)
+
+func TestMaskCommand_Run(t *testing.T) {
+	newClient := func() (secrethub.ClientInterface, error) {
+		return fakeclient.Client{
+			SecretService: &fakeclient.SecretService{
+				VersionService: &fakeclient.SecretVersionService{
+					WithDataGetter: fakeclient.WithDataGetter{
+						ReturnsVersion: &api.SecretVersion{
+							Data: []byte("password"),
+						},
+					},
+				},
+			},
+		}, nil
+	}
+
+	cases := map[string]struct {
+		cmd      MaskCommand
+		in       string
+		expected string
+		err      error
+	}{
+		"path": {
+			cmd: MaskCommand{
+				paths:     []string{"namespace/repo/secret"},
+				newClient: newClient,
+			},
+			in:       "the password is password",
+			expected: "the " + maskString + " is " + maskString,
+		},
+		"envar": {
+			cmd: MaskCommand{
+				envSourceFlags: envSourceFlags{
+					envar: map[string]string{
+						"PASSWORD": "namespace/repo/secret",
+					},
+				},
+				newClient: newClient,
+			},
+			in:       "password",
+			expected: maskString,
+		},
+		"encoded": {
+			cmd: MaskCommand{
+				paths:         []string{"namespace/repo/secret"},
+				maskEncodings: "base64",
+				newClient:     newClient,
+			},
+			in:       "cGFzc3dvcmQ=",
+			expected: maskString,
+		},
+		"fail on match": {
+			cmd: MaskCommand{
+				paths:       []string{"namespace/repo/secret"},
+				failOnMatch: true,
+				newClient:   newClient,
+			},
+			in:       "password",
+			expected: maskString,
+			err:      ErrSecretsMasked,
+		},
+		"fail on match without match": {
+			cmd: MaskCommand{
+				paths:       []string{"namespace/repo/secret"},
+				failOnMatch: true,
+				newClient:   newClient,
+			},
+			in:       "nothing to see here",
+			expected: "nothing to see here",
+		},
+		"no secrets": {
+			cmd: MaskCommand{},
+			err: ErrNoSecretsToMask,
+		},
+		"invalid path": {
+			cmd: MaskCommand{
+				paths: []string{"invalid"},
+			},
+			err: api.ErrInvalidSecretPath("invalid"),
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			io := ui.NewFakeIO()
+			io.StdIn.WriteString(tc.in)
+			tc.cmd.io = io
+			tc.cmd.maskingTimeout = time.Millisecond * 10
+
+			err := tc.cmd.Run()
+
+			assert.Equal(t, err, tc.err)
+			assert.Equal(t, io.StdOut.String(), tc.expected)
+		})
+	}
+}
+
+func TestMaskCommand_Run_envFiles(t *testing.T) {
+	dir, cleanup := testdata.tempDir(t)
+	defer cleanup()
+
+	files := map[string]string{
+		"base.env":      "USER=admin\nPASSWORD={{ namespace/repo/secret }}",
+		"override.env":  "USER=root",
+		defaultLockFile: "secrets:\n  namespace/repo/secret: 2\n",
+	}
+	for name, content := range files {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600)
+		assert.OK(t, err)
+	}
+
+	versionService := &fakeclient.SecretVersionService{
+		WithDataGetter: fakeclient.WithDataGetter{
+			ReturnsVersion: &api.SecretVersion{
+				Data: []byte("password"),
+			},
+		},
+	}
+
+	io := ui.NewFakeIO()
+	io.StdIn.WriteString("root:password")
+
+	cmd := MaskCommand{
+		envSourceFlags: envSourceFlags{
+			envFiles:                     []string{filepath.Join(dir, "base.env"), filepath.Join(dir, "override.env")},
+			templateVersion:              "auto",
+			dontPromptMissingTemplateVar: true,
+		},
+		io:             io,
+		maskingTimeout: time.Millisecond * 10,
+		lockFile:       filepath.Join(dir, defaultLockFile),
+		newClient: func() (secrethub.ClientInterface, error) {
+			return fakeclient.Client{
+				SecretService: &fakeclient.SecretService{
+					VersionService: versionService,
+				},
+			}, nil
+		},
+	}
+
+	err := cmd.Run()
+	assert.OK(t, err)
+	assert.Equal(t, io.StdOut.String(), "root:"+maskString)
+	assert.Equal(t, versionService.WithDataGetter.ArgPath, "namespace/repo/secret:2")
+}
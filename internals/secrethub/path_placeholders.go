@@ -6,4 +6,5 @@ const (
 	optionalDirPathPlaceHolder           = repoPathPlaceHolder + "[/<dir> ...]"
 	secretPathPlaceHolder                = optionalDirPathPlaceHolder + "/<secret>"
 	secretPathOptionalVersionPlaceHolder = secretPathPlaceHolder + "[:<version>]"
+	secretPathOptionalFieldPlaceHolder   = secretPathOptionalVersionPlaceHolder + "[#<field>]"
 )
@@ -11,15 +11,13 @@ import (
 	"github.com/secrethub/secrethub-cli/internals/cli/ui"
 	"github.com/secrethub/secrethub-cli/internals/secrethub/command"
 
-	"github.com/secrethub/secrethub-go/internals/api"
-
 	"github.com/docker/go-units"
 )
 
 // ReadCommand is a command to read a secret.
 type ReadCommand struct {
 	io                  ui.IO
-	path                api.SecretPath
+	path                secretFieldPath
 	useClipboard        bool
 	clearClipboardAfter time.Duration
 	clipper             clip.Clipper
@@ -41,7 +39,7 @@ func NewReadCommand(io ui.IO, newClient newClientFunc) *ReadCommand {
 // Register registers the command, arguments and flags on the provided Registerer.
 func (cmd *ReadCommand) Register(r command.Registerer) {
 	clause := r.Command("read", "Read a secret.")
-	clause.Arg("secret-path", "The path to the secret").Required().PlaceHolder(secretPathOptionalVersionPlaceHolder).SetValue(&cmd.path)
+	clause.Arg("secret-path", "The path to the secret. Append #<field> to read a single field of a JSON or YAML value, e.g. #client_email or #.db.host.").Required().PlaceHolder(secretPathOptionalFieldPlaceHolder).SetValue(&cmd.path)
 	clause.Flag(
 		"clip",
 		fmt.Sprintf(
@@ -62,11 +60,19 @@ func (cmd *ReadCommand) Run() error {
 		return err
 	}
 
-	secret, err := client.Secrets().Versions().GetWithData(cmd.path.Value())
+	path, field := splitSecretField(cmd.path.String())
+	secret, err := client.Secrets().Versions().GetWithData(path)
 	if err != nil {
 		return err
 	}
 
+	if field != "" {
+		secret.Data, err = selectSecretField(path, field, secret.Data)
+		if err != nil {
+			return err
+		}
+	}
+
 	if cmd.useClipboard {
 		err = WriteClipboardAutoClear(secret.Data, cmd.clearClipboardAfter, cmd.clipper)
 		if err != nil {
@@ -10,11 +10,16 @@ import (
 	"os"
 	"os/exec"
 	"os/signal"
+	"path"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
 	"strings"
 	"syscall"
 	"time"
 	"unicode"
+	"unicode/utf8"
 
 	"github.com/secrethub/secrethub-cli/internals/cli/ui"
 
@@ -23,6 +28,7 @@ import (
 	"github.com/secrethub/secrethub-cli/internals/secrethub/command"
 	"github.com/secrethub/secrethub-cli/internals/secrethub/tpl"
 	"github.com/secrethub/secrethub-cli/internals/secretspec"
+	generictpl "github.com/secrethub/secrethub-cli/internals/tpl"
 
 	"github.com/secrethub/secrethub-go/internals/api"
 	"github.com/secrethub/secrethub-go/internals/errio"
@@ -32,16 +38,31 @@ import (
 
 // Errors
 var (
-	errRun                    = errio.Namespace("run")
-	ErrStartFailed            = errRun.Code("start_failed").ErrorPref("error while starting process: %s")
-	ErrSignalFailed           = errRun.Code("signal_failed").ErrorPref("error while propagating signal to process: %s")
-	ErrReadEnvDir             = errRun.Code("env_dir_read_error").ErrorPref("could not read the environment directory: %s")
-	ErrReadEnvFile            = errRun.Code("env_file_read_error").ErrorPref("could not read the environment file %s: %s")
-	ErrEnvDirNotFound         = errRun.Code("env_dir_not_found").Error(fmt.Sprintf("could not find specified environment. Make sure you have executed `%s set`.", ApplicationName))
-	ErrTemplate               = errRun.Code("invalid_template").ErrorPref("could not parse template at line %d: %s")
-	ErrParsingTemplate        = errRun.Code("template_parsing_failed").ErrorPref("error while processing template file '%s': %s")
-	ErrInvalidTemplateVar     = errRun.Code("invalid_template_var").ErrorPref("template variable '%s' is invalid: template variables may only contain uppercase letters, digits, and the '_' (underscore) and are not allowed to start with a number")
-	ErrSecretsNotAllowedInKey = errRun.Code("secret_in_key").Error("secrets are not allowed in run template keys")
+	errRun                       = errio.Namespace("run")
+	ErrStartFailed               = errRun.Code("start_failed").ErrorPref("error while starting process: %s")
+	ErrSignalFailed              = errRun.Code("signal_failed").ErrorPref("error while propagating signal to process: %s")
+	ErrReadEnvDir                = errRun.Code("env_dir_read_error").ErrorPref("could not read the environment directory: %s")
+	ErrReadEnvFile               = errRun.Code("env_file_read_error").ErrorPref("could not read the environment file %s: %s")
+	ErrEnvDirNotFound            = errRun.Code("env_dir_not_found").Error(fmt.Sprintf("could not find specified environment. Make sure you have executed `%s set`.", ApplicationName))
+	ErrTemplate                  = errRun.Code("invalid_template").ErrorPref("could not parse template at line %d: %s")
+	ErrParsingTemplate           = errRun.Code("template_parsing_failed").ErrorPref("error while processing template file '%s': %s")
+	ErrInvalidTemplateVar        = errRun.Code("invalid_template_var").ErrorPref("template variable '%s' is invalid: template variables may only contain uppercase letters, digits, and the '_' (underscore) and are not allowed to start with a number")
+	ErrSecretsNotAllowedInKey    = errRun.Code("secret_in_key").Error("secrets are not allowed in run template keys")
+	ErrUnknownSignal             = errRun.Code("unknown_signal").ErrorPref("unknown signal: %s")
+	ErrWatchRefreshFailed        = errRun.Code("watch_refresh_failed").ErrorPref("could not refresh the environment, keeping the current one: %s")
+	ErrInvalidWatchInterval      = errRun.Code("invalid_watch_interval").Error("the watch interval must be positive")
+	ErrInvalidMaskEncodings      = errRun.Code("invalid_mask_encodings").ErrorPref("invalid --mask-encodings: %s")
+	ErrSecretsLeaked             = errRun.Code("secrets_leaked").Error("secrets were found in the output of the process")
+	ErrNoCommand                 = errRun.Code("no_command").Error("required argument 'command' not provided")
+	ErrJSONWithoutExplain        = errRun.Code("json_without_explain").Error("the --json flag can only be used together with --explain")
+	ErrPassEnvWithoutCleanEnv    = errRun.Code("pass_env_without_clean_env").Error("the --pass-env flag can only be used together with --clean-env")
+	ErrInvalidPassEnvPattern     = errRun.Code("invalid_pass_env_pattern").ErrorPref("invalid --pass-env pattern: %s")
+	ErrInvalidSecretDirEnvarName = errRun.Code("invalid_secret_dir_envar_name").ErrorPref("cannot source the secret at %s into an environment variable: %s is not a valid environment variable name")
+	ErrSecretDirEnvarConflict    = errRun.Code("secret_dir_envar_conflict").ErrorPref("cannot source both the secrets at %s and %s into the environment variable %s")
+	ErrCannotCreateSecretDir     = errRun.Code("cannot_create_secret_dir").ErrorPref("cannot create a directory for the secret files: %s")
+	ErrCannotWriteSecretFile     = errRun.Code("cannot_write_secret_file").ErrorPref("cannot write the secret file for %s: %s")
+	ErrCannotRemoveSecretDir     = errRun.Code("cannot_remove_secret_dir").ErrorPref("cannot remove the secret files directory %s: %s")
+	ErrInvalidSecretFileName     = errRun.Code("invalid_secret_file_name").ErrorPref("cannot write the secret in %s to a file: the name of the variable cannot be used as a file name")
 )
 
 const (
@@ -49,33 +70,44 @@ const (
 	// templateVarEnvVarPrefix is used to prefix environment variables
 	// that should be used as template variables.
 	templateVarEnvVarPrefix = "SECRETHUB_VAR_"
+	// watchStopTimeout is the time a process is given to stop after
+	// being signaled to before it is killed when restarting it.
+	watchStopTimeout = 10 * time.Second
 )
 
 // RunCommand runs a program and passes environment variables to it that are
 // defined with --envar or --env-file flags and secrets.yml files.
 // The yml files write to .secretsenv/<env-name> when running the set command.
 type RunCommand struct {
-	command                      []string
-	io                           ui.IO
-	envar                        map[string]string
-	envFile                      string
-	templateVars                 map[string]string
-	templateVersion              string
-	env                          string
-	noMasking                    bool
-	maskingTimeout               time.Duration
-	newClient                    newClientFunc
-	ignoreMissingSecrets         bool
-	dontPromptMissingTemplateVar bool
+	envSourceFlags
+	command              []string
+	io                   ui.IO
+	noMasking            bool
+	maskingTimeout       time.Duration
+	maskEncodings        string
+	failOnLeak           bool
+	newClient            newClientFunc
+	ignoreMissingSecrets bool
+	watch                bool
+	watchInterval        time.Duration
+	watchSignal          string
+	secretsAsFiles       bool
+	explain              bool
+	explainJSON          bool
+	cleanEnv             bool
+	passEnv              []string
+	unset                []string
+	lockFile             string
+	updateLock           bool
+	lock                 *lockFile
 }
 
 // NewRunCommand creates a new RunCommand.
 func NewRunCommand(io ui.IO, newClient newClientFunc) *RunCommand {
 	return &RunCommand{
-		io:           io,
-		envar:        make(map[string]string),
-		templateVars: make(map[string]string),
-		newClient:    newClient,
+		envSourceFlags: newEnvSourceFlags(),
+		io:             io,
+		newClient:      newClient,
 	}
 }
 
@@ -89,17 +121,39 @@ func (cmd *RunCommand) Register(r command.Registerer) {
 	clause := r.Command("run", helpShort)
 	clause.HelpLong(helpLong)
 	clause.Alias("exec")
-	clause.Arg("command", "The command to execute").Required().StringsVar(&cmd.command)
+	clause.Arg("command", "The command to execute. Required unless --explain is used.").StringsVar(&cmd.command)
 	clause.Flag("envar", "Source an environment variable from a secret at a given path with `NAME=<path>`").Short('e').StringMapVar(&cmd.envar)
-	clause.Flag("env-file", "The path to a file with environment variable mappings of the form `NAME=value`. Template syntax can be used to inject secrets.").StringVar(&cmd.envFile)
-	clause.Flag("template", "").Hidden().StringVar(&cmd.envFile)
+	clause.Flag("env-file", "The path to a file with environment variable mappings of the form `NAME=value`, or a yml or JSON file with (nested) mappings. Template syntax can be used to inject secrets and a line `{{ include \"path/to/file.env\" }}` includes the variables of another env-file. Can be used multiple times, in which case the variables in later files take precedence. When no env-file is given, the secrethub.env file in the working directory or the closest of its parent directories is used.").StringsVar(&cmd.envFiles)
+	clause.Flag("template", "").Hidden().StringsVar(&cmd.envFiles)
+	clause.Flag("env-dir", "Source an environment variable from every secret in the directory at the given path. The names of the variables are the upper-cased names of the secrets, with dashes and dots replaced by underscores. Can be used multiple times.").PlaceHolder(optionalDirPathPlaceHolder).StringsVar(&cmd.secretDirs)
+	clause.Flag("env-dir-prefix", "Prefix the names of the environment variables sourced with --env-dir with the given prefix, e.g. APP_.").StringVar(&cmd.secretDirPrefix)
+	clause.Flag("env-dir-recursive", "Also source the secrets in all subdirectories of the directories given with --env-dir. The names of subdirectories are prepended to the variable names, joined with underscores.").BoolVar(&cmd.secretDirRecursive)
 	clause.Flag("var", "Define the value for a template variable with `VAR=VALUE`, e.g. --var env=prod").Short('v').StringMapVar(&cmd.templateVars)
+	clause.Flag("var-file", "Read template variables from a YAML file with `VAR: VALUE` mappings. Can be used multiple times, in which case later files take precedence. Variables defined with --var or SECRETHUB_VAR_ environment variables take precedence over variable files.").StringsVar(&cmd.varFiles)
+	clause.Flag("environment", "Read template variables from the file secrethub.<environment>.vars.yml, e.g. --environment prod reads secrethub.prod.vars.yml. Variables from files given with --var-file take precedence.").StringVar(&cmd.environment)
 	clause.Flag("env", "The name of the environment prepared by the set command (default is `default`)").Default("default").Hidden().StringVar(&cmd.env)
 	clause.Flag("no-masking", "Disable masking of secrets on stdout and stderr").BoolVar(&cmd.noMasking)
 	clause.Flag("masking-timeout", "The maximum time output is buffered. Warning: lowering this value increases the chance of secrets not being masked.").Default("1s").DurationVar(&cmd.maskingTimeout)
-	clause.Flag("template-version", "The template syntax version to be used. The options are v1, v2, latest or auto to automatically detect the version.").Default("auto").StringVar(&cmd.templateVersion)
+	clause.Flag("mask-encodings", "A comma-separated list of encodings of the secrets that should be masked as well. The options are "+strings.Join(masker.EncodingNames(), ", ")+". Set to an empty value to only mask the secrets as they are.").Default(strings.Join(masker.EncodingNames(), ",")).StringVar(&cmd.maskEncodings)
+	clause.Flag("fail-on-leak", "Exit with a non-zero exit code when any secret has been masked in the output of the process.").BoolVar(&cmd.failOnLeak)
+	clause.Flag("template-version", "The template syntax version to be used. The options are v1, v2, v3, latest or auto to automatically detect the version.").Default("auto").StringVar(&cmd.templateVersion)
+	clause.Flag("lock-file", "The path to a lockfile that pins the versions of the secrets that are read. It is used when it exists.").Default(defaultLockFile).StringVar(&cmd.lockFile)
+	clause.Flag("update-lock", "Read the latest versions of the secrets instead of the versions pinned in the lockfile and update the lockfile with them.").BoolVar(&cmd.updateLock)
 	clause.Flag("ignore-missing-secrets", "Do not return an error when a secret does not exist and use an empty value instead.").BoolVar(&cmd.ignoreMissingSecrets)
 	clause.Flag("no-prompt", "Do not prompt when a template variable is missing and return an error instead.").BoolVar(&cmd.dontPromptMissingTemplateVar)
+	clause.Flag("watch", "Periodically check the secrets for new values and restart the process or send it a signal when they change. Secrets are always read at their latest version, the lockfile is not used. Cannot be used with --update-lock.").BoolVar(&cmd.watch)
+	clause.Flag("watch-interval", "The time between checks for new secret values when --watch is used.").Default("1m").DurationVar(&cmd.watchInterval)
+	clause.Flag("watch-signal", "The signal to send to the process when a secret value changes, e.g. SIGHUP. By default, the process is stopped and started again with the new values.").StringVar(&cmd.watchSignal)
+
+	clause.Flag("secrets-as-files", "Write the secrets to files in a private directory instead of passing them as environment variables. "+
+		"Every environment variable `NAME` containing a secret is replaced by a variable `NAME_FILE` containing the path to the file with its value. "+
+		"The directory is created in $XDG_RUNTIME_DIR or on another tmpfs when available and is removed when the process exits.").BoolVar(&cmd.secretsAsFiles)
+
+	clause.Flag("clean-env", "Do not pass the environment of this command on to the process. Only the variables defined with --envar, --env-file and the variables allowed with --pass-env are passed to the process.").BoolVar(&cmd.cleanEnv)
+	clause.Flag("pass-env", "Pass the variables from the environment of this command with a name matching the given glob `PATTERN` on to the process when --clean-env is used, e.g. --pass-env 'LC_*'. Can be used multiple times.").StringsVar(&cmd.passEnv)
+	clause.Flag("unset", "Do not pass the variable with the given `NAME` from the environment of this command on to the process. Can be used multiple times.").StringsVar(&cmd.unset)
+	clause.Flag("explain", "Do not run the command, but show where every environment variable is defined and which secrets it uses instead. The values of the variables are never shown.").BoolVar(&cmd.explain)
+	clause.Flag("json", "Show the output of --explain in JSON format.").BoolVar(&cmd.explainJSON)
 
 	command.BindAction(clause, cmd.Run)
 }
@@ -107,70 +161,438 @@ func (cmd *RunCommand) Register(r command.Registerer) {
 // Run reads files from the .secretsenv/<env-name> directory, sets them as environment variables and runs the given command.
 // Note that the environment variables are only passed to the child process and not exported globally, which is nice.
 func (cmd *RunCommand) Run() error {
-	// Parse
-	envSources := []EnvSource{}
+	if cmd.noMasking && cmd.failOnLeak {
+		return ErrFlagsConflict("--no-masking and --fail-on-leak")
+	}
 
-	// TODO: Validate the flags when parsing by implementing the Flag interface for EnvFlags.
-	flagSource, err := NewEnvFlags(cmd.envar)
+	if cmd.explainJSON && !cmd.explain {
+		return ErrJSONWithoutExplain
+	}
+
+	if len(cmd.passEnv) > 0 && !cmd.cleanEnv {
+		return ErrPassEnvWithoutCleanEnv
+	}
+
+	for _, pattern := range cmd.passEnv {
+		_, err := path.Match(pattern, "")
+		if err != nil {
+			return ErrInvalidPassEnvPattern(pattern)
+		}
+	}
+
+	maskEncodings, err := parseMaskEncodings(cmd.maskEncodings)
 	if err != nil {
 		return err
 	}
-	envSources = append(envSources, flagSource)
 
-	if cmd.envFile == "" {
-		const defaultEnvFile = "secrethub.env"
-		_, err := os.Stat(defaultEnvFile)
-		if err != nil {
-			if !os.IsNotExist(err) {
-				return fmt.Errorf("could not read default run env-file %s: %s", defaultEnvFile, err)
+	var reloadSignal os.Signal
+	if cmd.watch {
+		if cmd.watchInterval <= 0 {
+			return ErrInvalidWatchInterval
+		}
+
+		if cmd.updateLock {
+			return ErrFlagsConflict("--watch and --update-lock")
+		}
+
+		if cmd.watchSignal != "" {
+			reloadSignal, err = parseSignal(cmd.watchSignal)
+			if err != nil {
+				return err
 			}
-		} else {
-			cmd.envFile = defaultEnvFile
+		}
+	}
+
+	// Secrets pinned in the lockfile never get new values, so it is not used when watching.
+	cmd.lock = newLockFile(cmd.lockFile)
+	if !cmd.watch {
+		cmd.lock, err = readLockFile(cmd.lockFile)
+		if err != nil {
+			return err
 		}
 	}
 
 	osEnv, passthroughEnv := parseKeyValueStringsToMap(os.Environ())
+	// Template variables are always read from the full environment, as they
+	// are meant for this command instead of for the process it runs.
+	inheritedEnv, passthroughEnv := cmd.inheritEnvironment(osEnv, passthroughEnv)
+
+	envSources, err := cmd.sourceEnvironment(osEnv)
 	if err != nil {
 		return err
 	}
 
-	if cmd.envFile != "" {
-		templateVariableReader, err := newVariableReader(osEnv, cmd.templateVars)
+	if cmd.explain {
+		vars, err := cmd.explainEnvironment(envSources, inheritedEnv)
 		if err != nil {
 			return err
 		}
 
-		if !cmd.dontPromptMissingTemplateVar {
-			templateVariableReader = newPromptMissingVariableReader(templateVariableReader, cmd.io)
+		if cmd.explainJSON {
+			return printExplainedVarsJSON(cmd.io.Stdout(), vars)
 		}
+		return printExplainedVars(cmd.io.Stdout(), vars)
+	}
+
+	if len(cmd.command) == 0 {
+		return ErrNoCommand
+	}
+
+	environment, err := cmd.resolveEnvironment(envSources, inheritedEnv)
+	if err != nil {
+		return err
+	}
 
-		raw, err := ioutil.ReadFile(cmd.envFile)
+	var files *secretFiles
+	if cmd.secretsAsFiles {
+		files, err = newSecretFiles()
 		if err != nil {
-			return ErrCannotReadFile(cmd.envFile, err)
+			return err
 		}
+		defer func() {
+			err := files.remove()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		}()
+	}
+
+	processEnv, err := cmd.processEnvironment(environment, files)
+	if err != nil {
+		return err
+	}
+
+	// This makes sure commands encapsulated in quotes also work.
+	if len(cmd.command) == 1 {
+		cmd.command = strings.Split(cmd.command[0], " ")
+	}
+
+	secretMasker := newSecretMasker(maskEncodings)
+	valuesToMask := secretMasker.add(environment.secrets)
+
+	maskedStdout := masker.NewMaskedWriter(os.Stdout, valuesToMask, maskString, cmd.maskingTimeout)
+	maskedStderr := masker.NewMaskedWriter(os.Stderr, valuesToMask, maskString, cmd.maskingTimeout)
 
-		parser, err := getTemplateParser(raw, cmd.templateVersion)
+	var stdout, stderr io.Writer = os.Stdout, os.Stderr
+	if !cmd.noMasking {
+		stdout = maskedStdout
+		stderr = maskedStderr
+
+		go maskedStdout.Run()
+		go maskedStderr.Run()
+	}
+
+	command := cmd.newProcess(passthroughEnv, processEnv, stdout, stderr)
+	err = command.Start()
+	if err != nil {
+		return ErrStartFailed(err)
+	}
+
+	var commandErr error
+	var leaks map[string]int
+	if cmd.watch {
+		w := &runWatcher{
+			cmd:            cmd,
+			process:        command,
+			envSources:     envSources,
+			osEnv:          inheritedEnv,
+			passthroughEnv: passthroughEnv,
+			environment:    environment,
+			processEnv:     processEnv,
+			files:          files,
+			reloadSignal:   reloadSignal,
+			secretMasker:   secretMasker,
+			stdout:         stdout,
+			stderr:         stderr,
+		}
+		if !cmd.noMasking {
+			w.maskedWriters = []*masker.MaskedWriter{maskedStdout, maskedStderr}
+		}
+		commandErr = w.run()
+	} else {
+		done := make(chan bool, 1)
+
+		// Pass all signals to child process
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals)
+
+		go func() {
+			select {
+			case s := <-signals:
+				err := command.Process.Signal(s)
+				if err != nil && !strings.Contains(err.Error(), "process already finished") {
+					fmt.Fprintln(os.Stderr, ErrSignalFailed(err))
+				}
+			case <-done:
+				signal.Stop(signals)
+				return
+			}
+		}()
+
+		commandErr = command.Wait()
+		done <- true
+	}
+
+	if !cmd.noMasking {
+		err = maskedStdout.Flush()
 		if err != nil {
-			return err
+			fmt.Fprintln(os.Stderr, err)
 		}
+		err = maskedStderr.Flush()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+
+		leaks = secretMasker.leaks(maskedStdout.Matches(), maskedStderr.Matches())
+		printLeaks(os.Stderr, leaks)
+	}
 
-		envFile, err := ReadEnvFile(cmd.envFile, templateVariableReader, parser)
+	// The process has exited, so its secret files can be removed. This cannot
+	// be deferred, as os.Exit is used to pass on the exit code of the process.
+	if files != nil {
+		err = files.remove()
 		if err != nil {
-			return err
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+
+	if commandErr != nil {
+		// Check if the program exited with an error
+		exitErr, ok := commandErr.(*exec.ExitError)
+		if ok {
+			waitStatus, ok := exitErr.Sys().(syscall.WaitStatus)
+			if ok {
+				// Return the status code returned by the process
+				os.Exit(waitStatus.ExitStatus())
+				return nil
+			}
+
+		}
+		return commandErr
+	}
+
+	if cmd.failOnLeak && len(leaks) > 0 {
+		return ErrSecretsLeaked
+	}
+
+	return nil
+}
+
+// parseMaskEncodings returns the encodings of secrets that should be masked
+// from a comma-separated list of encoding names.
+func parseMaskEncodings(list string) ([]masker.Encoding, error) {
+	var names []string
+	for _, name := range strings.Split(list, ",") {
+		if strings.TrimSpace(name) != "" {
+			names = append(names, name)
 		}
-		envSources = append(envSources, envFile)
 	}
 
-	envDir := filepath.Join(secretspec.SecretEnvPath, cmd.env)
-	_, err = os.Stat(envDir)
-	if err == nil {
-		dirSource, err := NewEnvDir(envDir)
+	encodings, err := masker.ParseEncodings(names)
+	if err != nil {
+		return nil, ErrInvalidMaskEncodings(err)
+	}
+	return encodings, nil
+}
+
+// sourceEnvironment parses the configured sources of environment variables.
+// The returned sources are ordered by precedence.
+func (cmd *RunCommand) sourceEnvironment(osEnv map[string]string) ([]EnvSource, error) {
+	return cmd.envSourceFlags.sourceEnvironment(cmd.io, cmd.newClient, osEnv)
+}
+
+// envSourceFlags are the flags that configure the sources of environment variables.
+// They are shared by the commands that read the environment used by the run command.
+type envSourceFlags struct {
+	envar                        map[string]string
+	envFiles                     []string
+	templateVars                 map[string]string
+	varFiles                     []string
+	environment                  string
+	templateVersion              string
+	dontPromptMissingTemplateVar bool
+	secretDirs                   []string
+	secretDirPrefix              string
+	secretDirRecursive           bool
+	env                          string
+}
+
+// newEnvSourceFlags returns envSourceFlags without any configured sources.
+func newEnvSourceFlags() envSourceFlags {
+	return envSourceFlags{
+		envar:        make(map[string]string),
+		templateVars: make(map[string]string),
+	}
+}
+
+// sourceEnvironment parses the configured sources of environment variables.
+// The returned sources are ordered by precedence. When no env-file is configured,
+// the default env-file is used when it can be found.
+func (f *envSourceFlags) sourceEnvironment(io ui.IO, newClient newClientFunc, osEnv map[string]string) ([]EnvSource, error) {
+	envSources := []EnvSource{}
+
+	// TODO: Validate the flags when parsing by implementing the Flag interface for EnvFlags.
+	if len(f.envar) > 0 {
+		flagSource, err := NewEnvFlags(f.envar)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		envSources = append(envSources, flagSource)
+	}
+
+	if len(f.envFiles) == 0 {
+		defaultEnvFile, err := findDefaultEnvFile()
+		if err != nil {
+			return nil, err
+		}
+		if defaultEnvFile != "" {
+			f.envFiles = []string{defaultEnvFile}
+		}
+	}
+
+	if len(f.envFiles) > 0 {
+		templateVariableReader, err := newVariableReader(osEnv, f.templateVars, templateVarFiles(f.environment, f.varFiles)...)
+		if err != nil {
+			return nil, err
+		}
+
+		if !f.dontPromptMissingTemplateVar {
+			templateVariableReader = newPromptMissingVariableReader(templateVariableReader, io)
+		}
+
+		// Later env-files take precedence over earlier ones.
+		for i := len(f.envFiles) - 1; i >= 0; i-- {
+			path := f.envFiles[i]
+			raw, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil, ErrCannotReadFile(path, err)
+			}
+
+			parser, err := getTemplateParser(raw, f.templateVersion)
+			if err != nil {
+				return nil, err
+			}
+
+			envFile, err := ReadEnvFile(path, templateVariableReader, parser)
+			if err != nil {
+				return nil, err
+			}
+			envSources = append(envSources, envFile)
+		}
+	}
+
+	for _, path := range f.secretDirs {
+		secretDirSource, err := NewEnvSecretDir(path, f.secretDirPrefix, f.secretDirRecursive, newClient)
+		if err != nil {
+			return nil, err
+		}
+		envSources = append(envSources, secretDirSource)
+	}
+
+	if f.env != "" {
+		envDir := filepath.Join(secretspec.SecretEnvPath, f.env)
+		_, err := os.Stat(envDir)
+		if err == nil {
+			dirSource, err := NewEnvDir(envDir)
+			if err != nil {
+				return nil, err
+			}
+			envSources = append(envSources, dirSource)
+		}
+	}
+
+	return envSources, nil
+}
+
+// findDefaultEnvFile returns the path of the secrethub.env file in the working directory or
+// in the closest of its parent directories. When no such file exists, an empty path is returned.
+func findDefaultEnvFile() (string, error) {
+	const defaultEnvFile = "secrethub.env"
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+
+	dir := wd
+	for {
+		path := filepath.Join(dir, defaultEnvFile)
+		_, err := os.Stat(path)
+		if err == nil {
+			if dir == wd {
+				return defaultEnvFile, nil
+			}
+			return path, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", fmt.Errorf("could not read default run env-file %s: %s", path, err)
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// runEnvironment is the resolved environment of the child process.
+type runEnvironment struct {
+	// vars contains the values of the environment variables by name.
+	vars map[string]string
+	// secretVars contains the names of the variables that contain secrets.
+	secretVars map[string]struct{}
+	// secrets contains the values of all secrets that were read by their path.
+	secrets map[string]string
+}
+
+// inheritEnvironment returns the variables from the environment of this command that
+// are passed on to the process, together with the entries that are not formatted as
+// key-value pairs that are passed on. With --clean-env, only the variables matching
+// a --pass-env pattern are passed on. Variables given with --unset are never passed on.
+func (cmd *RunCommand) inheritEnvironment(osEnv map[string]string, passthroughEnv []string) (map[string]string, []string) {
+	unset := make(map[string]struct{}, len(cmd.unset))
+	for _, name := range cmd.unset {
+		unset[name] = struct{}{}
+	}
+
+	inherited := make(map[string]string, len(osEnv))
+	for key, value := range osEnv {
+		_, isUnset := unset[key]
+		if isUnset {
+			continue
 		}
-		envSources = append(envSources, dirSource)
+
+		if cmd.cleanEnv && !matchesAny(key, cmd.passEnv) {
+			continue
+		}
+
+		inherited[key] = value
 	}
 
+	if cmd.cleanEnv {
+		passthroughEnv = nil
+	}
+
+	return inherited, passthroughEnv
+}
+
+// matchesAny returns whether the name matches any of the given glob patterns.
+// Invalid patterns never match.
+func matchesAny(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		match, err := path.Match(pattern, name)
+		if err == nil && match {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveEnvironment fetches all secrets used in the given sources and constructs the
+// environment for the child process. The values of all secrets that were read are
+// returned as well by their path, so they can be masked.
+func (cmd *RunCommand) resolveEnvironment(envSources []EnvSource, osEnv map[string]string) (*runEnvironment, error) {
 	// Collect all secrets
 	secrets := make(map[string]string)
 	for _, source := range envSources {
@@ -179,26 +601,39 @@ func (cmd *RunCommand) Run() error {
 		}
 	}
 
-	var sr tpl.SecretReader = newSecretReader(cmd.newClient)
-	if cmd.ignoreMissingSecrets {
-		sr = newIgnoreMissingSecretReader(sr)
-	}
-	secretReader := newBufferedSecretReader(sr)
+	secretReader, baseReader := cmd.newSecretReader()
 
+	paths := make([]string, 0, len(secrets))
 	for path := range secrets {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	err := secretReader.Prefetch(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range paths {
 		secret, err := secretReader.ReadSecret(path)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		secrets[path] = secret
 	}
 
 	// Construct the environment, sourcing variables from the configured sources.
 	environment := make(map[string]string)
+	secretVars := make(map[string]struct{})
 	for _, source := range envSources {
 		pairs, err := source.Env(secrets, secretReader)
 		if err != nil {
-			return err
+			return nil, err
+		}
+
+		sourceSecretVars, err := secretVarNames(source, pairs, secrets, secretReader)
+		if err != nil {
+			return nil, err
 		}
 
 		for key, value := range pairs {
@@ -206,10 +641,22 @@ func (cmd *RunCommand) Run() error {
 			_, found := environment[key]
 			if !found {
 				environment[key] = value
+				_, isSecret := sourceSecretVars[key]
+				if isSecret {
+					secretVars[key] = struct{}{}
+				}
 			}
 		}
 	}
 
+	if cmd.updateLock {
+		cmd.lock.update(baseReader.Versions())
+		err = cmd.lock.write()
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Finally, source the remaining envars from the OS environment.
 	for key, value := range osEnv {
 		// Only set a variable if it wasn't set by a configured source.
@@ -219,91 +666,304 @@ func (cmd *RunCommand) Run() error {
 		}
 	}
 
-	// This makes sure commands encapsulated in quotes also work.
-	if len(cmd.command) == 1 {
-		cmd.command = strings.Split(cmd.command[0], " ")
+	return &runEnvironment{
+		vars:       environment,
+		secretVars: secretVars,
+		secrets:    secretReader.Secrets(),
+	}, nil
+}
+
+// newSecretReader returns the reader that is used to read the secrets, together with
+// the underlying reader that records the versions of the secrets that are read.
+// Secrets are read at the versions pinned in the lockfile, unless --update-lock is used.
+func (cmd *RunCommand) newSecretReader() (*bufferedSecretReader, *secretReader) {
+	baseReader := newSecretReader(cmd.newClient)
+	var sr tpl.SecretReader = baseReader
+	if !cmd.updateLock {
+		sr = newLockedSecretReader(sr, cmd.lock)
 	}
+	if cmd.ignoreMissingSecrets {
+		sr = newIgnoreMissingSecretReader(sr)
+	}
+	return newBufferedSecretReader(sr), baseReader
+}
 
-	values := secretReader.Values()
+// secretVarNames returns the names of the variables in the given environment of the source
+// whose values are resolved from secrets.
+func secretVarNames(source EnvSource, env map[string]string, secrets map[string]string, sr tpl.SecretReader) (map[string]struct{}, error) {
+	switch s := source.(type) {
+	case EnvFile:
+		return secretVarNames(s.env, env, secrets, sr)
+	case envTemplate:
+		return s.secretVars(secrets, sr)
+	}
 
-	valuesToMask := make([][]byte, 0, len(values))
-	for _, val := range values {
-		if val != "" {
-			valuesToMask = append(valuesToMask, []byte(val))
-		}
+	// The variables of the other sources are all sourced from secrets. This includes the
+	// variables sourced from an environment directory, as it is populated by the set command.
+	names := make(map[string]struct{}, len(env))
+	for name := range env {
+		names[name] = struct{}{}
 	}
+	return names, nil
+}
 
-	maskedStdout := masker.NewMaskedWriter(os.Stdout, valuesToMask, maskString, cmd.maskingTimeout)
-	maskedStderr := masker.NewMaskedWriter(os.Stderr, valuesToMask, maskString, cmd.maskingTimeout)
+// processEnvironment returns the environment variables to pass to the process.
+// When secret files are given, the secrets are written to files and the variables
+// containing them are replaced by variables containing the paths to these files.
+func (cmd *RunCommand) processEnvironment(environment *runEnvironment, files *secretFiles) (map[string]string, error) {
+	if files == nil {
+		return environment.vars, nil
+	}
+	return files.write(environment)
+}
 
+// newProcess returns the command to run with the given environment.
+func (cmd *RunCommand) newProcess(passthroughEnv []string, environment map[string]string, stdout, stderr io.Writer) *exec.Cmd {
 	command := exec.Command(cmd.command[0], cmd.command[1:]...)
 	command.Env = append(passthroughEnv, mapToKeyValueStrings(environment)...)
 	command.Stdin = os.Stdin
-	if cmd.noMasking {
-		command.Stdout = os.Stdout
-		command.Stderr = os.Stderr
-	} else {
-		command.Stdout = maskedStdout
-		command.Stderr = maskedStderr
-
-		go maskedStdout.Run()
-		go maskedStderr.Run()
-	}
-
-	err = command.Start()
-	if err != nil {
-		return ErrStartFailed(err)
-	}
+	command.Stdout = stdout
+	command.Stderr = stderr
+	return command
+}
 
-	done := make(chan bool, 1)
+// runWatcher periodically resolves the environment of a running process
+// and signals or restarts the process when any of the values changed.
+type runWatcher struct {
+	cmd            *RunCommand
+	process        *exec.Cmd
+	envSources     []EnvSource
+	osEnv          map[string]string
+	passthroughEnv []string
+	environment    *runEnvironment
+	processEnv     map[string]string
+	files          *secretFiles
+	reloadSignal   os.Signal
+	secretMasker   *secretMasker
+	maskedWriters  []*masker.MaskedWriter
+	stdout         io.Writer
+	stderr         io.Writer
+}
 
-	// Pass all signals to child process
+// run passes all signals to the process and checks for updated secrets every
+// watch interval. It returns when the process exits without being restarted.
+func (w *runWatcher) run() error {
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals)
+	defer signal.Stop(signals)
 
-	go func() {
+	exited := w.wait()
+
+	ticker := time.NewTicker(w.cmd.watchInterval)
+	defer ticker.Stop()
+
+	for {
 		select {
 		case s := <-signals:
-			err := command.Process.Signal(s)
+			err := w.process.Process.Signal(s)
 			if err != nil && !strings.Contains(err.Error(), "process already finished") {
 				fmt.Fprintln(os.Stderr, ErrSignalFailed(err))
 			}
-		case <-done:
-			signal.Stop(signals)
-			return
+		case err := <-exited:
+			return err
+		case <-ticker.C:
+			environment, err := w.cmd.resolveEnvironment(w.envSources, w.osEnv)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, ErrWatchRefreshFailed(err))
+				continue
+			}
+
+			if reflect.DeepEqual(environment.vars, w.environment.vars) {
+				continue
+			}
+
+			processEnv, err := w.cmd.processEnvironment(environment, w.files)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, ErrWatchRefreshFailed(err))
+				continue
+			}
+			w.environment = environment
+			w.processEnv = processEnv
+			w.addMasks(environment.secrets)
+
+			if w.reloadSignal != nil {
+				err = w.process.Process.Signal(w.reloadSignal)
+				if err != nil {
+					fmt.Fprintln(os.Stderr, ErrSignalFailed(err))
+				}
+				continue
+			}
+
+			exited, err = w.restart(exited)
+			if err != nil {
+				return err
+			}
 		}
-	}()
+	}
+}
 
-	commandErr := command.Wait()
-	done <- true
+// wait waits for the current process to exit in a separate goroutine.
+// The error returned by the process is sent on the returned channel.
+func (w *runWatcher) wait() <-chan error {
+	exited := make(chan error, 1)
+	go func(process *exec.Cmd) {
+		exited <- process.Wait()
+	}(w.process)
+	return exited
+}
 
-	if !cmd.noMasking {
-		err = maskedStdout.Flush()
-		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
+// restart gracefully stops the current process and starts it again with the
+// latest environment. If the process does not stop within watchStopTimeout,
+// it is killed.
+func (w *runWatcher) restart(exited <-chan error) (<-chan error, error) {
+	err := stopProcess(w.process.Process)
+	if err != nil && !strings.Contains(err.Error(), "process already finished") {
+		fmt.Fprintln(os.Stderr, ErrSignalFailed(err))
+	}
+
+	select {
+	case <-exited:
+	case <-time.After(watchStopTimeout):
+		err = w.process.Process.Kill()
+		if err != nil && !strings.Contains(err.Error(), "process already finished") {
+			fmt.Fprintln(os.Stderr, ErrSignalFailed(err))
 		}
-		err = maskedStderr.Flush()
-		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
+		<-exited
+	}
+
+	w.process = w.cmd.newProcess(w.passthroughEnv, w.processEnv, w.stdout, w.stderr)
+	err = w.process.Start()
+	if err != nil {
+		return nil, ErrStartFailed(err)
+	}
+
+	return w.wait(), nil
+}
+
+// addMasks makes sure the given secrets are masked by the masked writers.
+func (w *runWatcher) addMasks(secrets map[string]string) {
+	masks := w.secretMasker.add(secrets)
+	if len(masks) == 0 {
+		return
+	}
+
+	for _, mw := range w.maskedWriters {
+		mw.AddMasks(masks)
+	}
+}
+
+// secretMasker keeps track of the masks for secrets and the paths of
+// the secrets each of them is derived from.
+type secretMasker struct {
+	encodings []masker.Encoding
+	// paths contains the paths of the secrets for every mask, by the index of the mask.
+	paths [][]string
+	// masks contains the indices of the masks for every secret value.
+	masks map[string][]int
+}
+
+// newSecretMasker creates a secretMasker that also masks the given encodings of secrets.
+func newSecretMasker(encodings []masker.Encoding) *secretMasker {
+	return &secretMasker{
+		encodings: encodings,
+		masks:     make(map[string][]int),
+	}
+}
+
+// add registers the given secrets by their path and returns the masks for
+// the values that were not registered before, in the order in which they should
+// be passed to a masker.MaskedWriter.
+func (m *secretMasker) add(secrets map[string]string) [][]byte {
+	paths := make([]string, 0, len(secrets))
+	for path := range secrets {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var res [][]byte
+	for _, path := range paths {
+		value := secrets[path]
+		if value == "" {
+			continue
+		}
+
+		indices, found := m.masks[value]
+		if !found {
+			for _, mask := range masker.WithEncodings([][]byte{[]byte(value)}, m.encodings...) {
+				indices = append(indices, len(m.paths))
+				m.paths = append(m.paths, nil)
+				res = append(res, mask)
+			}
+			m.masks[value] = indices
+		}
+
+		for _, i := range indices {
+			if !containsString(m.paths[i], path) {
+				m.paths[i] = append(m.paths[i], path)
+			}
 		}
 	}
+	return res
+}
 
-	if commandErr != nil {
-		// Check if the program exited with an error
-		exitErr, ok := commandErr.(*exec.ExitError)
-		if ok {
-			waitStatus, ok := exitErr.Sys().(syscall.WaitStatus)
-			if ok {
-				// Return the status code returned by the process
-				os.Exit(waitStatus.ExitStatus())
-				return nil
+// leaks returns how often the secret at each path has been masked, given the number
+// of matches per mask of one or more masker.MaskedWriters. Paths of secrets that
+// have not been masked are omitted.
+func (m *secretMasker) leaks(matches ...[]int) map[string]int {
+	res := make(map[string]int)
+	for _, counts := range matches {
+		for i, count := range counts {
+			if count == 0 || i >= len(m.paths) {
+				continue
 			}
+			for _, path := range m.paths[i] {
+				res[path] += count
+			}
+		}
+	}
+	return res
+}
+
+// printLeaks prints a summary of the secrets that have been masked, without their values.
+func printLeaks(w io.Writer, leaks map[string]int) {
+	if len(leaks) == 0 {
+		return
+	}
+
+	paths := make([]string, 0, len(leaks))
+	for path := range leaks {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
 
+	fmt.Fprintln(w, "Warning: the following secrets were found in the output of the process and have been masked:")
+	for _, path := range paths {
+		fmt.Fprintf(w, "  %s (%s)\n", path, pluralize("time", "times", leaks[path]))
+	}
+}
+
+// containsString returns whether the list contains the given string.
+func containsString(list []string, s string) bool {
+	for _, elem := range list {
+		if elem == s {
+			return true
 		}
-		return commandErr
 	}
+	return false
+}
 
-	return nil
+// parseSignal returns the signal with the given name. The SIG prefix is optional.
+func parseSignal(name string) (os.Signal, error) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+
+	sig, ok := watchSignals[name]
+	if !ok {
+		return nil, ErrUnknownSignal(name)
+	}
+	return sig, nil
 }
 
 // mapToKeyValueStrings converts a map to a slice of key=value pairs.
@@ -357,9 +1017,13 @@ type envTemplate struct {
 }
 
 type envvarTpls struct {
+	name   string
 	key    tpl.Template
 	value  tpl.Template
 	lineNo int
+	// file is the path of the included env-file the variable is defined in.
+	// It is empty for variables that are not included.
+	file string
 }
 
 type secretReaderNotAllowed struct{}
@@ -369,11 +1033,18 @@ func (sr secretReaderNotAllowed) ReadSecret(path string) (string, error) {
 }
 
 // Env injects the given secrets in the environment values and returns
-// a map of the resulting environment.
+// a map of the resulting environment. Variables that are defined earlier
+// in the environment can be referenced as template variables, e.g. ${OTHER}.
 func (t envTemplate) Env(secrets map[string]string, sr tpl.SecretReader) (map[string]string, error) {
+	err := t.prefetch(sr)
+	if err != nil {
+		return nil, err
+	}
+
+	varReader := t.varReader()
 	result := make(map[string]string)
 	for _, tpls := range t.envVars {
-		key, err := tpls.key.Evaluate(t.templateVarReader, secretReaderNotAllowed{})
+		key, err := tpls.key.Evaluate(varReader, secretReaderNotAllowed{})
 		if err != nil {
 			return nil, err
 		}
@@ -383,16 +1054,117 @@ func (t envTemplate) Env(secrets map[string]string, sr tpl.SecretReader) (map[st
 			return nil, templateError(tpls.lineNo, err)
 		}
 
-		value, err := tpls.value.Evaluate(t.templateVarReader, sr)
+		value, err := tpls.value.Evaluate(varReader, sr)
 		if err != nil {
 			return nil, err
 		}
 
 		result[key] = value
+		varReader.vars[strings.ToLower(key)] = value
 	}
 	return result, nil
 }
 
+// secretVars returns the names of the variables whose values are resolved from secrets,
+// either by reading them or by referencing variables of the environment that do.
+func (t envTemplate) secretVars(secrets map[string]string, sr tpl.SecretReader) (map[string]struct{}, error) {
+	vars, err := t.explain(secrets, sr)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]struct{})
+	// referenced contains the lower-cased names of the variables that can be referenced.
+	referenced := make(map[string]struct{})
+	for i, v := range vars {
+		// When a variable is defined more than once, the last definition is used.
+		if len(v.Secrets) > 0 || referencesVariable(t.envVars[i].value, referenced) {
+			names[v.Name] = struct{}{}
+			referenced[strings.ToLower(v.Name)] = struct{}{}
+		} else {
+			delete(names, v.Name)
+			delete(referenced, strings.ToLower(v.Name))
+		}
+	}
+	return names, nil
+}
+
+// prefetch reads all secrets used in the environment at once, instead of one variable at a time.
+// Secrets in values that reference other variables of the environment are only read when
+// evaluating them, as these values are not known yet.
+func (t envTemplate) prefetch(sr tpl.SecretReader) error {
+	defined := make(map[string]struct{}, len(t.envVars))
+	values := make([]tpl.Template, 0, len(t.envVars))
+	for _, tpls := range t.envVars {
+		if !referencesVariable(tpls.value, defined) {
+			values = append(values, tpls.value)
+		}
+		defined[strings.ToLower(tpls.name)] = struct{}{}
+	}
+
+	return tpl.Prefetch(t.templateVarReader, sr, values...)
+}
+
+// varReader returns the variable reader with which the keys and values of the environment
+// are evaluated. Every evaluated variable should be added to it, so that it can be
+// referenced by the variables that are defined after it.
+func (t envTemplate) varReader() *envVariableReader {
+	return &envVariableReader{
+		vars:   make(map[string]string, len(t.envVars)),
+		reader: t.templateVarReader,
+	}
+}
+
+// referencesVariable returns whether the template references any of the given template variables.
+func referencesVariable(t tpl.Template, names map[string]struct{}) bool {
+	refs, ok := tpl.References(t)
+	if !ok {
+		return false
+	}
+
+	for _, ref := range refs {
+		if ref.Type != tpl.ReferenceVariable {
+			continue
+		}
+		_, ok := names[ref.Name]
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// envVariableReader reads the variables that are defined earlier in an environment
+// as template variables. Other template variables are read with the underlying reader.
+type envVariableReader struct {
+	vars   map[string]string
+	reader tpl.VariableReader
+}
+
+// ReadVariable implements tpl.VariableReader.
+func (r *envVariableReader) ReadVariable(name string) (string, error) {
+	value, ok := r.vars[name]
+	if ok {
+		return value, nil
+	}
+	if r.reader == nil {
+		return "", tpl.ErrTemplateVarNotFound(name)
+	}
+	return r.reader.ReadVariable(name)
+}
+
+// LookupVariable implements tpl.VariableLookupReader.
+func (r *envVariableReader) LookupVariable(name string) (string, bool, error) {
+	value, ok := r.vars[name]
+	if ok {
+		return value, true, nil
+	}
+	if r.reader == nil {
+		return "", false, nil
+	}
+	return tpl.LookupVariable(r.reader, name)
+}
+
 func templateError(lineNo int, err error) error {
 	if lineNo > 0 {
 		return ErrTemplate(lineNo, err)
@@ -406,13 +1178,77 @@ func (t envTemplate) Secrets() []string {
 	return []string{}
 }
 
+// fileTemplates returns the templates of the keys and values in the environment in the
+// order in which they occur. Every template is given a variable reader that reads the keys
+// defined before it, which are evaluated with the given secret reader. Keys that cannot be
+// evaluated are only listed as defined, so that references to them cannot be resolved.
+// Only the keys that are referenced in the environment are evaluated.
+func (t envTemplate) fileTemplates(sr tpl.SecretReader) []fileTemplate {
+	referenced := make(map[string]struct{})
+	for _, tpls := range t.envVars {
+		refs, _ := tpl.References(tpls.value)
+		for _, ref := range refs {
+			referenced[ref.Name] = struct{}{}
+		}
+	}
+
+	varReader := t.varReader()
+	keys := make(map[string]struct{}, len(t.envVars))
+	defined := make([]fileTemplate, len(t.envVars))
+	for i, tpls := range t.envVars {
+		reader := &envVariableReader{
+			vars:   make(map[string]string, len(varReader.vars)),
+			reader: t.templateVarReader,
+		}
+		for name, value := range varReader.vars {
+			reader.vars[name] = value
+		}
+		envKeys := make(map[string]struct{}, len(keys))
+		for name := range keys {
+			envKeys[name] = struct{}{}
+		}
+		defined[i] = fileTemplate{
+			varReader: reader,
+			envKeys:   envKeys,
+			file:      tpls.file,
+		}
+
+		name := strings.ToLower(tpls.name)
+		keys[name] = struct{}{}
+		if _, ok := referenced[name]; !ok {
+			continue
+		}
+		value, err := tpls.value.Evaluate(varReader, sr)
+		if err == nil {
+			varReader.vars[name] = value
+		}
+	}
+
+	order := make([]int, len(t.envVars))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return t.envVars[order[i]].lineNo < t.envVars[order[j]].lineNo
+	})
+
+	res := make([]fileTemplate, 0, 2*len(t.envVars))
+	for _, i := range order {
+		key, value := defined[i], defined[i]
+		key.template = t.envVars[i].key
+		value.template = t.envVars[i].value
+		res = append(res, key, value)
+	}
+	return res
+}
+
 // ReadEnvFile reads and parses a .env file.
 func ReadEnvFile(filepath string, varReader tpl.VariableReader, parser tpl.Parser) (EnvFile, error) {
 	r, err := os.Open(filepath)
 	if err != nil {
 		return EnvFile{}, ErrCannotReadFile(filepath, err)
 	}
-	env, err := NewEnv(r, varReader, parser)
+	env, err := newEnvFile(r, filepath, varReader, parser)
 	if err != nil {
 		return EnvFile{}, ErrParsingTemplate(filepath, err)
 	}
@@ -443,34 +1279,58 @@ func (e EnvFile) Secrets() []string {
 }
 
 // NewEnv loads an environment of key-value pairs from a string.
-// The format of the string can be `key: value` or `key=value` pairs.
+// The format of the string can be `key=value` pairs as used in .env files,
+// or a yml or JSON document in which nested objects are flattened.
 func NewEnv(r io.Reader, varReader tpl.VariableReader, parser tpl.Parser) (EnvSource, error) {
+	return newEnvFile(r, "", varReader, parser)
+}
+
+// newEnvFile loads an environment of key-value pairs from the env-file at the given path,
+// which is read from the given reader. Other env-files included in the env-file with
+// `{{ include "path/to/file.env" }}` lines are read relative to its directory.
+func newEnvFile(r io.Reader, path string, varReader tpl.VariableReader, parser tpl.Parser) (EnvSource, error) {
 	env, err := parseEnvironment(r)
 	if err != nil {
 		return nil, err
 	}
 
+	env, err = expandIncludes(generictpl.NewIncluder(path), env)
+	if err != nil {
+		return nil, err
+	}
+
 	secretTemplates := make([]envvarTpls, len(env))
 	for i, envvar := range env {
-		keyTpl, err := parser.Parse(envvar.key, envvar.lineNumber, envvar.columnNumberKey)
+		file := path
+		if envvar.file != "" {
+			file = envvar.file
+		}
+		p := parser
+		if file != "" {
+			p = tpl.ForFile(parser, file)
+		}
+
+		keyTpl, err := p.Parse(envvar.key, envvar.lineNumber, envvar.columnNumberKey)
 		if err != nil {
-			return nil, err
+			return nil, envvar.includeError(err)
 		}
 
 		err = validation.ValidateEnvarName(envvar.key)
 		if err != nil {
-			return nil, err
+			return nil, envvar.includeError(err)
 		}
 
-		valTpl, err := parser.Parse(envvar.value, envvar.lineNumber, envvar.columnNumberValue)
+		valTpl, err := p.Parse(envvar.value, envvar.lineNumber, envvar.columnNumberValue)
 		if err != nil {
-			return nil, err
+			return nil, envvar.includeError(err)
 		}
 
 		secretTemplates[i] = envvarTpls{
+			name:   envvar.key,
 			key:    keyTpl,
 			value:  valTpl,
-			lineNo: envvar.lineNumber,
+			lineNo: envvar.outermostLineNumber(),
+			file:   envvar.file,
 		}
 	}
 
@@ -486,15 +1346,118 @@ type envvar struct {
 	lineNumber        int
 	columnNumberKey   int
 	columnNumberValue int
+
+	// include is the path of the env-file that is included on the line, if the
+	// line is an include tag instead of a key-value pair.
+	include string
+	// file is the path of the included env-file the variable is defined in.
+	// It is empty for variables that are not included.
+	file string
+	// includedBy is the include tag with which the variable is included.
+	// It is nil for variables that are not included.
+	includedBy *envvar
+}
+
+// includeError returns the given error of the variable, wrapped in the errors
+// of the include tags through which the variable is included.
+func (v envvar) includeError(err error) error {
+	for tag := v.includedBy; tag != nil; tag = tag.includedBy {
+		err = tpl.ErrIncludeFailed(tag.lineNumber, tag.columnNumberKey, tag.include, err)
+	}
+	return err
+}
+
+// outermostLineNumber returns the line number of the variable in the env-file that is
+// read, which is the line of the outermost include tag for variables that are included.
+func (v envvar) outermostLineNumber() int {
+	lineNumber := v.lineNumber
+	for tag := v.includedBy; tag != nil; tag = tag.includedBy {
+		lineNumber = tag.lineNumber
+	}
+	return lineNumber
+}
+
+// envIncludeTag matches a line of an env-file that includes another env-file.
+var envIncludeTag = regexp.MustCompile(`^{{\s*include\s+"([^"]*)"\s*}}$`)
+
+// expandIncludes replaces the include tags in the given variables with the variables
+// defined in the included env-files, which are read with the given includer. Keys can
+// only be defined once across an env-file and the env-files it includes.
+func expandIncludes(includer generictpl.Includer, vars []envvar) ([]envvar, error) {
+	var res []envvar
+	definedOn := map[string]int{}
+	for _, v := range vars {
+		if v.include == "" {
+			if prev, ok := definedOn[v.key]; ok {
+				return nil, ErrTemplate(v.lineNumber, fmt.Errorf("%s is already defined on line %d", v.key, prev))
+			}
+			definedOn[v.key] = v.lineNumber
+			res = append(res, v)
+			continue
+		}
+
+		included, ok := includer.Include(v.include)
+		if !ok {
+			return nil, tpl.ErrIncludeCycle(v.lineNumber, v.columnNumberKey, included.File())
+		}
+		v.include = included.File()
+
+		raw, err := included.Read()
+		if err != nil {
+			return nil, tpl.ErrCannotInclude(v.lineNumber, v.columnNumberKey, v.include, err)
+		}
+
+		partial, err := parseDotEnv(bytes.NewReader(raw))
+		if err == nil {
+			partial, err = expandIncludes(included, partial)
+		}
+		if err != nil {
+			return nil, tpl.ErrIncludeFailed(v.lineNumber, v.columnNumberKey, v.include, err)
+		}
+
+		tag := v
+		for _, p := range partial {
+			if prev, ok := definedOn[p.key]; ok {
+				return nil, ErrTemplate(v.lineNumber, fmt.Errorf("%s is already defined on line %d", p.key, prev))
+			}
+			definedOn[p.key] = v.lineNumber
+
+			if p.file == "" {
+				p.file = v.include
+			}
+
+			// The tag is added as the outermost include tag of the variable.
+			if p.includedBy == nil {
+				p.includedBy = &tag
+			} else {
+				inner := p.includedBy
+				for inner.includedBy != nil && inner.includedBy != &tag {
+					inner = inner.includedBy
+				}
+				inner.includedBy = &tag
+			}
+			res = append(res, p)
+		}
+	}
+	return res, nil
 }
 
 // parseEnvironment parses envvars from a string.
 // It first tries the key=value format. When that returns an error,
-// the yml format is tried.
-// The default parser to be used with the format is also returned.
+// the yml format is tried. Documents that start with a { are JSON
+// objects, which are parsed as yml.
 func parseEnvironment(r io.Reader) ([]envvar, error) {
 	var ymlReader bytes.Buffer
-	env, err := parseDotEnv(io.TeeReader(r, &ymlReader))
+	contents := bufio.NewReader(io.TeeReader(r, &ymlReader))
+	if isJSONObject(contents) {
+		_, err := ioutil.ReadAll(contents)
+		if err != nil {
+			return nil, err
+		}
+		return parseYML(&ymlReader)
+	}
+
+	env, err := parseDotEnv(contents)
 	if err != nil {
 		var ymlErr error
 		env, ymlErr = parseYML(&ymlReader)
@@ -505,21 +1468,57 @@ func parseEnvironment(r io.Reader) ([]envvar, error) {
 	return env, nil
 }
 
+// isJSONObject returns whether the reader starts with a JSON object, i.e. whether its first
+// non-whitespace characters are a { followed by a key or a }. This distinguishes JSON objects
+// from templates in keys, which also start with a {.
+func isJSONObject(r *bufio.Reader) bool {
+	var token []byte
+	for n := 1; len(token) < 2; n++ {
+		peeked, _ := r.Peek(n)
+		if len(peeked) < n {
+			return false
+		}
+		c := peeked[n-1]
+		if !unicode.IsSpace(rune(c)) {
+			token = append(token, c)
+		}
+	}
+	return token[0] == '{' && (token[1] == '"' || token[1] == '}')
+}
+
 // parseDotEnv parses key-value pairs in the .env syntax (key=value).
+// Keys can be prefixed with export and every key can only be defined once.
+// Values can be wrapped in single or double quotes, in which case they can span
+// multiple lines. A quoted value ends at the first closing quote that is followed
+// by nothing but whitespace or a comment. In double quoted values, \n, \" and \\
+// are replaced by a newline, a quote and a backslash. Lines starting with a # are
+// ignored and in unquoted values, a # preceded by whitespace starts a comment.
+// A line can also include another env-file: {{ include "path/to/file.env" }}.
 func parseDotEnv(r io.Reader) ([]envvar, error) {
-	vars := map[string]envvar{}
+	var vars []envvar
+	definedOn := map[string]int{}
 	scanner := bufio.NewScanner(r)
 
 	i := 0
 	for scanner.Scan() {
 		i++
 		line := scanner.Text()
+		lineNumber := i
 
 		trimmed := strings.TrimSpace(line)
 		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
 			continue
 		}
 
+		if match := envIncludeTag.FindStringSubmatch(trimmed); match != nil {
+			vars = append(vars, envvar{
+				include:         match[1],
+				lineNumber:      lineNumber,
+				columnNumberKey: strings.Index(line, "{{") + 1,
+			})
+			continue
+		}
+
 		parts := strings.SplitN(line, "=", 2)
 		if len(parts) != 2 {
 			return nil, ErrTemplate(i, errors.New("template is not formatted as key=value pairs"))
@@ -542,29 +1541,94 @@ func parseDotEnv(r io.Reader) ([]envvar, error) {
 		}
 
 		key := strings.TrimSpace(parts[0])
+		if strings.HasPrefix(key, "export") {
+			unexported := strings.TrimLeftFunc(strings.TrimPrefix(key, "export"), unicode.IsSpace)
+			if len(unexported) < len(key)-len("export") {
+				columnNumberKey += len(key) - len(unexported)
+				key = unexported
+			}
+		}
+
+		value := strings.TrimSpace(parts[1])
+		if value != "" && (value[0] == doubleQuoteChar || value[0] == singleQuoteChar) {
+			quote := value[0]
+			quoted := value
+			for {
+				end := closingQuote(quoted, quote)
+				if end > 0 {
+					quoted = quoted[:end+1]
+					break
+				}
+
+				if !scanner.Scan() {
+					return nil, ErrTemplate(lineNumber, fmt.Errorf("the value of %s is not closed with a %c", key, quote))
+				}
+				i++
+				quoted += "\n" + scanner.Text()
+			}
 
-		value, isTrimmed := trimQuotes(strings.TrimSpace(parts[1]))
-		if isTrimmed {
+			value, _ = trimQuotes(quoted)
+			if quote == doubleQuoteChar {
+				value = unescapeDoubleQuoted(value)
+			}
 			columnNumberValue++
+		} else {
+			value = stripComment(value)
+		}
+
+		if prev, ok := definedOn[key]; ok {
+			return nil, ErrTemplate(lineNumber, fmt.Errorf("%s is already defined on line %d", key, prev))
 		}
+		definedOn[key] = lineNumber
 
-		vars[key] = envvar{
+		vars = append(vars, envvar{
 			key:               key,
 			value:             value,
-			lineNumber:        i,
+			lineNumber:        lineNumber,
 			columnNumberValue: columnNumberValue,
 			columnNumberKey:   columnNumberKey,
-		}
+		})
 	}
 
-	i = 0
-	res := make([]envvar, len(vars))
-	for _, envvar := range vars {
-		res[i] = envvar
-		i++
+	return vars, nil
+}
+
+// closingQuote returns the index of the quote that closes the quoted value at the start
+// of the given string, or -1 if the value is not closed. A quote only closes the value
+// when it is followed by nothing but whitespace or a comment. In double quoted values,
+// quotes can be escaped with a backslash.
+func closingQuote(s string, quote byte) int {
+	for i := 1; i < len(s); i++ {
+		if quote == doubleQuoteChar && s[i] == '\\' {
+			i++
+			continue
+		}
+		if s[i] != quote {
+			continue
+		}
+
+		rest := strings.TrimSpace(s[i+1:])
+		if rest == "" || strings.HasPrefix(rest, "#") && s[i+1] != '#' {
+			return i
+		}
 	}
+	return -1
+}
 
-	return res, nil
+// unescapeDoubleQuoted replaces the escape sequences in a double quoted value.
+func unescapeDoubleQuoted(s string) string {
+	return strings.NewReplacer(`\n`, "\n", `\"`, `"`, `\\`, `\`).Replace(s)
+}
+
+// stripComment removes a comment at the end of an unquoted value.
+// A comment starts with a # that is preceded by whitespace.
+func stripComment(s string) string {
+	for i := 1; i < len(s); i++ {
+		if s[i] == '#' && unicode.IsSpace(rune(s[i-1])) {
+			return strings.TrimSpace(s[:i])
+		}
+	}
+	return s
 }
 
 const (
@@ -593,29 +1657,117 @@ func trimQuotes(s string) (string, bool) {
 	return s, false
 }
 
+// parseYML parses key-value pairs from a yml or JSON document. Nested objects are flattened
+// by joining the keys with underscores, e.g. {"A": {"B": {"C": "value"}}} defines A_B_C.
+// The positions of the keys and values are looked up in the document, so that errors can
+// be reported with the line on which they occur.
 func parseYML(r io.Reader) ([]envvar, error) {
 	contents, err := ioutil.ReadAll(r)
 	if err != nil {
 		return nil, err
 	}
 
-	pairs := make(map[string]string)
-	err = yaml.Unmarshal(contents, pairs)
+	var doc yaml.MapSlice
+	err = yaml.Unmarshal(contents, &doc)
 	if err != nil {
 		return nil, err
 	}
 
-	vars := make([]envvar, len(pairs))
-	i := 0
-	for key, value := range pairs {
-		vars[i] = envvar{
-			key:        key,
-			value:      value,
-			lineNumber: -1,
+	env := ymlEnv{
+		contents:  string(contents),
+		definedOn: make(map[string]int),
+	}
+	err = env.flatten(doc, "")
+	if err != nil {
+		return nil, err
+	}
+	return env.vars, nil
+}
+
+// ymlEnv flattens a yml document into environment variables.
+type ymlEnv struct {
+	contents string
+	// offset is the position in the contents after the last key that was located.
+	offset    int
+	vars      []envvar
+	definedOn map[string]int
+}
+
+// flatten adds the values in the given object to the environment variables.
+// The keys of the variables are prefixed with the given prefix.
+func (e *ymlEnv) flatten(obj yaml.MapSlice, prefix string) error {
+	for _, item := range obj {
+		name := fmt.Sprint(item.Key)
+		key := prefix + name
+		lineNumber, columnNumberKey, columnNumberValue := e.locate(name)
+
+		var value string
+		switch v := item.Value.(type) {
+		case yaml.MapSlice:
+			err := e.flatten(v, key+"_")
+			if err != nil {
+				return err
+			}
+			continue
+		case []interface{}:
+			return templateError(lineNumber, fmt.Errorf("the value of %s is a list, which cannot be used as the value of an environment variable", key))
+		case nil:
+			value = ""
+		case string:
+			value = v
+		default:
+			value = fmt.Sprint(v)
 		}
-		i++
+
+		prev, ok := e.definedOn[key]
+		if ok && prev > 0 {
+			return templateError(lineNumber, fmt.Errorf("%s is already defined on line %d", key, prev))
+		} else if ok {
+			return fmt.Errorf("%s is defined more than once", key)
+		}
+		e.definedOn[key] = lineNumber
+
+		e.vars = append(e.vars, envvar{
+			key:               key,
+			value:             value,
+			lineNumber:        lineNumber,
+			columnNumberKey:   columnNumberKey,
+			columnNumberValue: columnNumberValue,
+		})
 	}
-	return vars, nil
+	return nil
+}
+
+// locate returns the line of the given key together with the columns of the key and its value.
+// As the keys are located in the order in which they occur in the document, the document is
+// searched from the previously located key onwards. When the key cannot be found, for example
+// because it contains escape sequences, the line is -1.
+func (e *ymlEnv) locate(key string) (int, int, int) {
+	pattern := regexp.MustCompile(`(?:^|[\s{,])(["']?)` + regexp.QuoteMeta(key) + `["']?[ \t]*:`)
+	match := pattern.FindStringSubmatchIndex(e.contents[e.offset:])
+	if match == nil {
+		return -1, 0, 0
+	}
+
+	keyStart := e.offset + match[2]
+	valueStart := e.offset + match[1]
+	e.offset = valueStart
+
+	for valueStart < len(e.contents) && (e.contents[valueStart] == ' ' || e.contents[valueStart] == '\t') {
+		valueStart++
+	}
+	if valueStart < len(e.contents) && (e.contents[valueStart] == doubleQuoteChar || e.contents[valueStart] == singleQuoteChar) {
+		valueStart++
+	}
+
+	lineNumber := strings.Count(e.contents[:keyStart], "\n") + 1
+	return lineNumber, e.column(keyStart), e.column(valueStart)
+}
+
+// column returns the column of the given position in the contents.
+func (e *ymlEnv) column(pos int) int {
+	lineStart := strings.LastIndex(e.contents[:pos], "\n") + 1
+	return utf8.RuneCountInString(e.contents[lineStart:pos]) + 1
 }
 
 // EnvDir defines environment variables sourced from files in a directory.
@@ -662,6 +1814,147 @@ func (dir EnvDir) Secrets() []string {
 	return []string{}
 }
 
+// EnvSecretDir defines environment variables sourced from the secrets in a SecretHub directory.
+type EnvSecretDir struct {
+	path      api.DirPath
+	prefix    string
+	recursive bool
+	newClient newClientFunc
+}
+
+// NewEnvSecretDir creates a source of environment variables for the secrets in the directory at
+// the given path. The names of the variables are derived from the names of the secrets and
+// prefixed with the given prefix. When recursive is true, the secrets in all subdirectories are
+// included as well.
+func NewEnvSecretDir(path string, prefix string, recursive bool, newClient newClientFunc) (EnvSecretDir, error) {
+	dirPath, err := api.NewDirPath(path)
+	if err != nil {
+		return EnvSecretDir{}, err
+	}
+
+	return EnvSecretDir{
+		path:      dirPath,
+		prefix:    prefix,
+		recursive: recursive,
+		newClient: newClient,
+	}, nil
+}
+
+// Env returns a map of environment variables sourced from the secrets in the directory.
+func (d EnvSecretDir) Env(secrets map[string]string, sr tpl.SecretReader) (map[string]string, error) {
+	paths, err := d.list()
+	if err != nil {
+		return nil, err
+	}
+
+	err = prefetchSecretDir(sr, paths)
+	if err != nil {
+		return nil, err
+	}
+
+	env := make(map[string]string, len(paths))
+	for name, path := range paths {
+		secret, err := sr.ReadSecret(path)
+		if err != nil {
+			return nil, err
+		}
+		env[name] = secret
+	}
+	return env, nil
+}
+
+// prefetchSecretDir reads the secrets at the given paths ahead of time when the
+// secret reader is a tpl.SecretPrefetcher.
+func prefetchSecretDir(sr tpl.SecretReader, paths map[string]string) error {
+	prefetcher, ok := sr.(tpl.SecretPrefetcher)
+	if !ok {
+		return nil
+	}
+
+	secretPaths := make([]string, 0, len(paths))
+	for _, path := range paths {
+		secretPaths = append(secretPaths, path)
+	}
+	sort.Strings(secretPaths)
+
+	return prefetcher.Prefetch(secretPaths)
+}
+
+// Secrets returns an empty list, as the secrets in the directory are only known after listing it.
+// The secrets are read with the tpl.SecretReader given to Env instead.
+func (d EnvSecretDir) Secrets() []string {
+	return []string{}
+}
+
+// list lists the directory and returns the paths of the secrets in it by the names
+// of the environment variables they are sourced into.
+func (d EnvSecretDir) list() (map[string]string, error) {
+	client, err := d.newClient()
+	if err != nil {
+		return nil, err
+	}
+
+	depth := 1
+	if d.recursive {
+		depth = -1
+	}
+
+	tree, err := client.Dirs().GetTree(d.path.Value(), depth, false)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make(map[string]string)
+	err = d.addSecrets(paths, tree.RootDir, d.path.Value(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return paths, nil
+}
+
+// addSecrets adds the paths of the secrets in the given directory to the paths by the names
+// of their environment variables, recursing into subdirectories when configured to.
+// The segments are the names of the directories between the source directory and the given directory.
+func (d EnvSecretDir) addSecrets(paths map[string]string, dir *api.Dir, dirPath string, segments []string) error {
+	for _, secret := range dir.Secrets {
+		name := d.envarName(append(segments, secret.Name))
+		path := dirPath + "/" + secret.Name
+
+		err := validation.ValidateEnvarName(name)
+		if err != nil {
+			return ErrInvalidSecretDirEnvarName(path, name)
+		}
+
+		existing, found := paths[name]
+		if found {
+			return ErrSecretDirEnvarConflict(existing, path, name)
+		}
+		paths[name] = path
+	}
+
+	if !d.recursive {
+		return nil
+	}
+
+	for _, subDir := range dir.SubDirs {
+		subSegments := append(append([]string{}, segments...), subDir.Name)
+		err := d.addSecrets(paths, subDir, dirPath+"/"+subDir.Name, subSegments)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// envarName returns the name of the environment variable for a secret with the given
+// path segments relative to the directory. The segments are upper-cased and joined with
+// underscores, dashes and dots are replaced by underscores and the prefix is prepended.
+func (d EnvSecretDir) envarName(segments []string) string {
+	name := strings.ToUpper(strings.Join(segments, "_"))
+	name = strings.NewReplacer("-", "_", ".", "_").Replace(name)
+	return d.prefix + name
+}
+
 // EnvFlags defines environment variables sourced from command-line flags.
 type EnvFlags map[string]string
 
@@ -673,7 +1966,7 @@ func NewEnvFlags(flags map[string]string) (EnvFlags, error) {
 			return nil, err
 		}
 
-		err = api.ValidateSecretPath(path)
+		err = validateSecretFieldPath(path)
 		if err != nil {
 			return nil, err
 		}
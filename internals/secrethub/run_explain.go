@@ -0,0 +1,324 @@
+package secrethub
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/secrethub/secrethub-cli/internals/secrethub/tpl"
+)
+
+// Sources of environment variables, as shown by run --explain.
+const (
+	explainSourceFlag   = "flag"
+	explainSourceFile   = "file"
+	explainSourceEnvDir = "env dir"
+	// explainSourceSecretDir is used for variables sourced from a SecretHub directory.
+	explainSourceSecretDir = "secret dir"
+	explainSourceOS        = "os"
+	// explainSourceUnknown is used for sources that cannot explain their variables.
+	explainSourceUnknown = "unknown"
+)
+
+// explainedVar describes where the value of an environment variable is defined.
+// It never contains the value itself.
+type explainedVar struct {
+	Name   string `json:"name"`
+	Source string `json:"source"`
+	File   string `json:"file,omitempty"`
+	Line   int    `json:"line,omitempty"`
+	// Dir is the path of the SecretHub directory the variable is sourced from.
+	Dir string `json:"dir,omitempty"`
+	// Secrets contains the secrets that are used in the value of the variable.
+	Secrets []explainedSecret `json:"secrets"`
+	// Overridden is true when the variable is also defined by a source with a higher precedence.
+	Overridden bool `json:"overridden"`
+}
+
+// explainedSecret is a secret used in the value of an environment variable.
+type explainedSecret struct {
+	Path string `json:"path"`
+	// Version is the version the path resolved to, or 0 when the secret does not exist.
+	Version int `json:"version,omitempty"`
+}
+
+// location returns a description of where the variable is defined.
+func (v explainedVar) location() string {
+	if v.Dir != "" {
+		return v.Dir
+	}
+	if v.File == "" {
+		return v.Source
+	}
+	if v.Line > 0 {
+		return fmt.Sprintf("%s:%d", v.File, v.Line)
+	}
+	return v.File
+}
+
+// envExplainer is implemented by environment sources that can explain where their variables come from.
+type envExplainer interface {
+	// explain returns the variables of the source in the order in which they are defined.
+	explain(secrets map[string]string, sr tpl.SecretReader) ([]explainedVar, error)
+}
+
+// explain implements envExplainer.
+func (ef EnvFlags) explain(secrets map[string]string, _ tpl.SecretReader) ([]explainedVar, error) {
+	names := make([]string, 0, len(ef))
+	for name := range ef {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := make([]explainedVar, len(names))
+	for i, name := range names {
+		result[i] = explainedVar{
+			Name:    name,
+			Source:  explainSourceFlag,
+			Secrets: []explainedSecret{{Path: ef[name]}},
+		}
+	}
+	return result, nil
+}
+
+// explain implements envExplainer.
+func (e EnvFile) explain(secrets map[string]string, sr tpl.SecretReader) ([]explainedVar, error) {
+	var result []explainedVar
+	var err error
+	explainer, ok := e.env.(envExplainer)
+	if ok {
+		result, err = explainer.explain(secrets, sr)
+	} else {
+		result, err = explainEnv(e.env, explainSourceFile, secrets, sr)
+	}
+	if err != nil {
+		return nil, ErrParsingTemplate(e.path, err)
+	}
+
+	for i := range result {
+		result[i].Source = explainSourceFile
+		result[i].File = e.path
+	}
+	return result, nil
+}
+
+// explain implements envExplainer.
+func (t envTemplate) explain(secrets map[string]string, sr tpl.SecretReader) ([]explainedVar, error) {
+	err := t.prefetch(sr)
+	if err != nil {
+		return nil, err
+	}
+
+	varReader := t.varReader()
+	result := make([]explainedVar, len(t.envVars))
+	for i, tpls := range t.envVars {
+		key, err := tpls.key.Evaluate(varReader, secretReaderNotAllowed{})
+		if err != nil {
+			return nil, err
+		}
+
+		recorder := newRecordingSecretReader(sr)
+		value, err := tpls.value.Evaluate(varReader, recorder)
+		if err != nil {
+			return nil, err
+		}
+		varReader.vars[strings.ToLower(key)] = value
+
+		result[i] = explainedVar{
+			Name:    key,
+			Line:    tpls.lineNo,
+			Secrets: []explainedSecret{},
+		}
+		for _, path := range recorder.Paths() {
+			result[i].Secrets = append(result[i].Secrets, explainedSecret{Path: path})
+		}
+	}
+	return result, nil
+}
+
+// explain implements envExplainer.
+func (dir EnvDir) explain(secrets map[string]string, sr tpl.SecretReader) ([]explainedVar, error) {
+	return explainEnv(dir, explainSourceEnvDir, secrets, sr)
+}
+
+// explain implements envExplainer.
+func (d EnvSecretDir) explain(secrets map[string]string, sr tpl.SecretReader) ([]explainedVar, error) {
+	paths, err := d.list()
+	if err != nil {
+		return nil, err
+	}
+
+	err = prefetchSecretDir(sr, paths)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(paths))
+	for name := range paths {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := make([]explainedVar, len(names))
+	for i, name := range names {
+		// The secret is read to resolve its version.
+		_, err := sr.ReadSecret(paths[name])
+		if err != nil {
+			return nil, err
+		}
+
+		result[i] = explainedVar{
+			Name:    name,
+			Source:  explainSourceSecretDir,
+			Dir:     d.path.Value(),
+			Secrets: []explainedSecret{{Path: paths[name]}},
+		}
+	}
+	return result, nil
+}
+
+// explainEnv explains the variables of any environment source, without the secrets used in them.
+func explainEnv(source EnvSource, sourceName string, secrets map[string]string, sr tpl.SecretReader) ([]explainedVar, error) {
+	env, err := source.Env(secrets, sr)
+	if err != nil {
+		return nil, err
+	}
+	return explainMap(env, sourceName), nil
+}
+
+// explainMap explains the variables in the given map as sourced from the given source.
+func explainMap(env map[string]string, sourceName string) []explainedVar {
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := make([]explainedVar, len(names))
+	for i, name := range names {
+		result[i] = explainedVar{
+			Name:    name,
+			Source:  sourceName,
+			Secrets: []explainedSecret{},
+		}
+	}
+	return result
+}
+
+// explainEnvironment returns where all environment variables passed to the child process are
+// defined, in the same order of precedence as resolveEnvironment, without starting the process.
+// The returned variables are sorted by name and then by precedence.
+func (cmd *RunCommand) explainEnvironment(envSources []EnvSource, osEnv map[string]string) ([]explainedVar, error) {
+	secretReader, baseReader := cmd.newSecretReader()
+
+	var paths []string
+	for _, source := range envSources {
+		paths = append(paths, source.Secrets()...)
+	}
+
+	err := secretReader.Prefetch(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	secrets := make(map[string]string)
+	for _, source := range envSources {
+		for _, path := range source.Secrets() {
+			secret, err := secretReader.ReadSecret(path)
+			if err != nil {
+				return nil, err
+			}
+			secrets[path] = secret
+		}
+	}
+
+	var result []explainedVar
+	defined := make(map[string]struct{})
+	explained := func(vars []explainedVar) {
+		for i := range vars {
+			_, found := defined[vars[i].Name]
+			vars[i].Overridden = found
+		}
+		for _, v := range vars {
+			defined[v.Name] = struct{}{}
+		}
+		result = append(result, vars...)
+	}
+
+	for _, source := range envSources {
+		var vars []explainedVar
+		var err error
+		explainer, ok := source.(envExplainer)
+		if ok {
+			vars, err = explainer.explain(secrets, secretReader)
+		} else {
+			vars, err = explainEnv(source, explainSourceUnknown, secrets, secretReader)
+		}
+		if err != nil {
+			return nil, err
+		}
+		explained(vars)
+	}
+	explained(explainMap(osEnv, explainSourceOS))
+
+	versions := baseReader.Versions()
+	for _, v := range result {
+		for j, secret := range v.Secrets {
+			// Versions are read for the secret as a whole, not for the fields selected from it.
+			path, _ := splitSecretField(secret.Path)
+			if !cmd.updateLock {
+				path = cmd.lock.pin(path)
+			}
+			v.Secrets[j].Version = versions[path]
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result, nil
+}
+
+// printExplainedVars prints a table of the explained variables.
+func printExplainedVars(w io.Writer, vars []explainedVar) error {
+	tabWriter := tabwriter.NewWriter(w, 0, 4, 4, ' ', 0)
+	fmt.Fprintf(tabWriter, "%s\t%s\t%s\t%s\n", "NAME", "SOURCE", "SECRETS", "OVERRIDDEN")
+
+	for _, v := range vars {
+		secrets := make([]string, len(v.Secrets))
+		for i, secret := range v.Secrets {
+			if secret.Version == 0 {
+				secrets[i] = fmt.Sprintf("%s (missing)", secret.Path)
+			} else {
+				secrets[i] = fmt.Sprintf("%s (version %d)", secret.Path, secret.Version)
+			}
+		}
+		if len(secrets) == 0 {
+			secrets = []string{"-"}
+		}
+
+		overridden := "no"
+		if v.Overridden {
+			overridden = "yes"
+		}
+
+		fmt.Fprintf(tabWriter, "%s\t%s\t%s\t%s\n", v.Name, v.location(), strings.Join(secrets, ", "), overridden)
+	}
+
+	return tabWriter.Flush()
+}
+
+// printExplainedVarsJSON prints the explained variables as a JSON array.
+func printExplainedVarsJSON(w io.Writer, vars []explainedVar) error {
+	if vars == nil {
+		vars = []explainedVar{}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(vars)
+}
@@ -0,0 +1,159 @@
+package secrethub
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/secrethub/secrethub-go/internals/api"
+	"github.com/secrethub/secrethub-go/internals/assert"
+	"github.com/secrethub/secrethub-go/pkg/secrethub"
+	"github.com/secrethub/secrethub-go/pkg/secrethub/fakeclient"
+)
+
+func TestRunCommand_explainEnvironment(t *testing.T) {
+	raw := "DB_USER=admin\nDB_PASSWORD={{ company/app/db/password }}\n" +
+		"DB_HOST={{ company/app/${DB_USER}/host }}\nDB_URL=postgres://${DB_USER}@${DB_HOST}"
+	parser, err := getTemplateParser([]byte(raw), "auto")
+	assert.OK(t, err)
+
+	env, err := NewEnv(strings.NewReader(raw), nil, parser)
+	assert.OK(t, err)
+
+	flags, err := NewEnvFlags(map[string]string{
+		"DB_PASSWORD": "company/app/db/password",
+	})
+	assert.OK(t, err)
+
+	cmd := RunCommand{
+		newClient: func() (secrethub.ClientInterface, error) {
+			return fakeclient.Client{
+				SecretService: &fakeclient.SecretService{
+					VersionService: &fakeclient.SecretVersionService{
+						WithDataGetter: fakeclient.WithDataGetter{
+							ReturnsVersion: &api.SecretVersion{
+								Version: 3,
+								Data:    []byte("secret"),
+							},
+						},
+					},
+				},
+			}, nil
+		},
+	}
+
+	sources := []EnvSource{
+		flags,
+		EnvFile{path: "secrethub.env", env: env},
+		EnvDir{"API_KEY": "key"},
+	}
+	osEnv := map[string]string{
+		"API_KEY": "other",
+		"HOME":    "/home/user",
+	}
+
+	actual, err := cmd.explainEnvironment(sources, osEnv)
+	assert.OK(t, err)
+
+	secret := []explainedSecret{{Path: "company/app/db/password", Version: 3}}
+	expected := []explainedVar{
+		{Name: "API_KEY", Source: explainSourceEnvDir, Secrets: []explainedSecret{}},
+		{Name: "API_KEY", Source: explainSourceOS, Secrets: []explainedSecret{}, Overridden: true},
+		{Name: "DB_HOST", Source: explainSourceFile, File: "secrethub.env", Line: 3, Secrets: []explainedSecret{{Path: "company/app/admin/host", Version: 3}}},
+		{Name: "DB_PASSWORD", Source: explainSourceFlag, Secrets: secret},
+		{Name: "DB_PASSWORD", Source: explainSourceFile, File: "secrethub.env", Line: 2, Secrets: secret, Overridden: true},
+		{Name: "DB_URL", Source: explainSourceFile, File: "secrethub.env", Line: 4, Secrets: []explainedSecret{}},
+		{Name: "DB_USER", Source: explainSourceFile, File: "secrethub.env", Line: 1, Secrets: []explainedSecret{}},
+		{Name: "HOME", Source: explainSourceOS, Secrets: []explainedSecret{}},
+	}
+	assert.Equal(t, actual, expected)
+}
+
+func TestRunCommand_explainEnvironment_field(t *testing.T) {
+	raw := "DB_HOST={{ company/app/db#host }}"
+	parser, err := getTemplateParser([]byte(raw), "auto")
+	assert.OK(t, err)
+
+	env, err := NewEnv(strings.NewReader(raw), nil, parser)
+	assert.OK(t, err)
+
+	flags, err := NewEnvFlags(map[string]string{
+		"DB_USER": "company/app/db#user",
+	})
+	assert.OK(t, err)
+
+	cmd := RunCommand{
+		newClient: func() (secrethub.ClientInterface, error) {
+			return fakeclient.Client{
+				SecretService: &fakeclient.SecretService{
+					VersionService: &fakeclient.SecretVersionService{
+						WithDataGetter: fakeclient.WithDataGetter{
+							ReturnsVersion: &api.SecretVersion{
+								Version: 3,
+								Data:    []byte(`{"host": "localhost", "user": "admin"}`),
+							},
+						},
+					},
+				},
+			}, nil
+		},
+		lock: &lockFile{
+			Secrets: map[string]int{"company/app/db": 3},
+		},
+	}
+
+	sources := []EnvSource{
+		flags,
+		EnvFile{path: "secrethub.env", env: env},
+	}
+
+	actual, err := cmd.explainEnvironment(sources, nil)
+	assert.OK(t, err)
+
+	expected := []explainedVar{
+		{Name: "DB_HOST", Source: explainSourceFile, File: "secrethub.env", Line: 1, Secrets: []explainedSecret{{Path: "company/app/db#host", Version: 3}}},
+		{Name: "DB_USER", Source: explainSourceFlag, Secrets: []explainedSecret{{Path: "company/app/db#user", Version: 3}}},
+	}
+	assert.Equal(t, actual, expected)
+}
+
+func TestPrintExplainedVars(t *testing.T) {
+	vars := []explainedVar{
+		{Name: "DB_PASSWORD", Source: explainSourceFile, File: "secrethub.env", Line: 2, Secrets: []explainedSecret{{Path: "company/app/db/password", Version: 3}}},
+		{Name: "HOME", Source: explainSourceOS, Secrets: []explainedSecret{}, Overridden: true},
+		{Name: "MISSING", Source: explainSourceFlag, Secrets: []explainedSecret{{Path: "company/app/missing"}}},
+	}
+
+	var buf bytes.Buffer
+	err := printExplainedVars(&buf, vars)
+	assert.OK(t, err)
+
+	expected := "" +
+		"NAME           SOURCE             SECRETS                                OVERRIDDEN\n" +
+		"DB_PASSWORD    secrethub.env:2    company/app/db/password (version 3)    no\n" +
+		"HOME           os                 -                                      yes\n" +
+		"MISSING        flag               company/app/missing (missing)          no\n"
+	assert.Equal(t, buf.String(), expected)
+
+	buf.Reset()
+	err = printExplainedVarsJSON(&buf, vars[:1])
+	assert.OK(t, err)
+
+	expected = `[
+  {
+    "name": "DB_PASSWORD",
+    "source": "file",
+    "file": "secrethub.env",
+    "line": 2,
+    "secrets": [
+      {
+        "path": "company/app/db/password",
+        "version": 3
+      }
+    ],
+    "overridden": false
+  }
+]
+`
+	assert.Equal(t, buf.String(), expected)
+}
@@ -0,0 +1,144 @@
+package secrethub
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// secretFileMode is the file mode of the files secrets are written to.
+	secretFileMode os.FileMode = 0400
+	// secretFileVarSuffix is appended to the name of a variable containing
+	// a secret to get the name of the variable containing the path to its file.
+	secretFileVarSuffix = "_FILE"
+)
+
+// secretFiles is a private directory that secrets are written to, so that
+// they do not have to be passed to a process in its environment.
+type secretFiles struct {
+	dir string
+	// written contains the names of the variables that have been written to the directory.
+	written map[string]struct{}
+}
+
+// newSecretFiles creates a new directory for secret files that is only accessible by the current user.
+// The directory is created in $XDG_RUNTIME_DIR when set, or on a tmpfs when available, so that
+// the secrets are never written to disk.
+func newSecretFiles() (*secretFiles, error) {
+	dir, err := ioutil.TempDir(secretFilesBaseDir(), "secrethub-run-")
+	if err != nil {
+		return nil, ErrCannotCreateSecretDir(err)
+	}
+
+	// Make sure the permissions are correct, regardless of how the directory was created.
+	err = os.Chmod(dir, 0700)
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, ErrCannotCreateSecretDir(err)
+	}
+
+	return &secretFiles{
+		dir:     dir,
+		written: make(map[string]struct{}),
+	}, nil
+}
+
+// secretFilesBaseDir returns the directory in which the directory for secret files is created.
+func secretFilesBaseDir() string {
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir != "" {
+		return runtimeDir
+	}
+
+	const shm = "/dev/shm"
+	info, err := os.Stat(shm)
+	if err == nil && info.IsDir() {
+		return shm
+	}
+
+	return os.TempDir()
+}
+
+// write writes the value of every variable containing a secret in the environment to a file
+// in the directory. It returns the environment variables with the variables containing
+// secrets replaced by variables with the suffix _FILE containing the path to their file.
+// Files of variables that no longer contain a secret are removed.
+func (f *secretFiles) write(environment *runEnvironment) (map[string]string, error) {
+	result := make(map[string]string, len(environment.vars))
+	for key, value := range environment.vars {
+		_, isSecret := environment.secretVars[key]
+		if !isSecret {
+			result[key] = value
+		}
+	}
+
+	written := make(map[string]struct{}, len(environment.secretVars))
+	for key := range environment.secretVars {
+		path, err := f.writeFile(key, environment.vars[key])
+		if err != nil {
+			return nil, err
+		}
+		result[key+secretFileVarSuffix] = path
+		written[key] = struct{}{}
+	}
+
+	for key := range f.written {
+		_, found := written[key]
+		if !found {
+			err := os.Remove(filepath.Join(f.dir, key))
+			if err != nil && !os.IsNotExist(err) {
+				return nil, ErrCannotWriteSecretFile(key, err)
+			}
+		}
+	}
+	f.written = written
+
+	return result, nil
+}
+
+// writeFile writes the value of the variable with the given name to a file
+// that is only readable by the current user and returns the path to it.
+// The file is replaced atomically, so a process never reads a partially written value.
+func (f *secretFiles) writeFile(name string, value string) (string, error) {
+	if name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return "", ErrInvalidSecretFileName(name)
+	}
+
+	tmp, err := ioutil.TempFile(f.dir, ".tmp-")
+	if err != nil {
+		return "", ErrCannotWriteSecretFile(name, err)
+	}
+
+	_, err = tmp.WriteString(value)
+	if err == nil {
+		err = tmp.Chmod(secretFileMode)
+	}
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return "", ErrCannotWriteSecretFile(name, err)
+	}
+
+	path := filepath.Join(f.dir, name)
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return "", ErrCannotWriteSecretFile(name, err)
+	}
+
+	return path, nil
+}
+
+// remove removes the directory and all secret files in it.
+func (f *secretFiles) remove() error {
+	err := os.RemoveAll(f.dir)
+	if err != nil {
+		return ErrCannotRemoveSecretDir(f.dir, err)
+	}
+	return nil
+}
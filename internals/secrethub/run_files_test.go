@@ -0,0 +1,89 @@
+package secrethub
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/secrethub/secrethub-go/internals/assert"
+)
+
+func TestSecretFiles(t *testing.T) {
+	files, err := newSecretFiles()
+	assert.OK(t, err)
+	defer func() {
+		err := files.remove()
+		assert.OK(t, err)
+	}()
+
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(files.dir)
+		assert.OK(t, err)
+		assert.Equal(t, info.Mode().Perm(), os.FileMode(0700))
+	}
+
+	env, err := files.write(&runEnvironment{
+		vars: map[string]string{
+			"DB_PASSWORD": "secret",
+			"API_KEY":     "key",
+			"LOG_LEVEL":   "debug",
+		},
+		secretVars: map[string]struct{}{
+			"DB_PASSWORD": {},
+			"API_KEY":     {},
+		},
+	})
+	assert.OK(t, err)
+	assert.Equal(t, env, map[string]string{
+		"DB_PASSWORD_FILE": filepath.Join(files.dir, "DB_PASSWORD"),
+		"API_KEY_FILE":     filepath.Join(files.dir, "API_KEY"),
+		"LOG_LEVEL":        "debug",
+	})
+
+	value, err := ioutil.ReadFile(env["DB_PASSWORD_FILE"])
+	assert.OK(t, err)
+	assert.Equal(t, string(value), "secret")
+
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(env["DB_PASSWORD_FILE"])
+		assert.OK(t, err)
+		assert.Equal(t, info.Mode().Perm(), secretFileMode)
+	}
+
+	// Writing again updates the values and removes the files that are no longer needed.
+	env, err = files.write(&runEnvironment{
+		vars: map[string]string{
+			"DB_PASSWORD": "new secret",
+		},
+		secretVars: map[string]struct{}{
+			"DB_PASSWORD": {},
+		},
+	})
+	assert.OK(t, err)
+
+	value, err = ioutil.ReadFile(env["DB_PASSWORD_FILE"])
+	assert.OK(t, err)
+	assert.Equal(t, string(value), "new secret")
+
+	_, err = os.Stat(filepath.Join(files.dir, "API_KEY"))
+	assert.Equal(t, os.IsNotExist(err), true)
+
+	// Names that cannot be used as a file name are rejected.
+	_, err = files.write(&runEnvironment{
+		vars: map[string]string{
+			"../FOO": "secret",
+		},
+		secretVars: map[string]struct{}{
+			"../FOO": {},
+		},
+	})
+	assert.Equal(t, err, ErrInvalidSecretFileName("../FOO"))
+
+	err = files.remove()
+	assert.OK(t, err)
+
+	_, err = os.Stat(files.dir)
+	assert.Equal(t, os.IsNotExist(err), true)
+}
@@ -0,0 +1,24 @@
+// +build !windows
+
+package secrethub
+
+import (
+	"os"
+	"syscall"
+)
+
+// watchSignals are the signals that can be sent to a process when its secrets change.
+var watchSignals = map[string]os.Signal{
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGINT":  syscall.SIGINT,
+	"SIGKILL": syscall.SIGKILL,
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGTERM": syscall.SIGTERM,
+	"SIGUSR1": syscall.SIGUSR1,
+	"SIGUSR2": syscall.SIGUSR2,
+}
+
+// stopProcess asks the process to terminate gracefully.
+func stopProcess(p *os.Process) error {
+	return p.Signal(syscall.SIGTERM)
+}
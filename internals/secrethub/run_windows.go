@@ -0,0 +1,17 @@
+package secrethub
+
+import (
+	"os"
+)
+
+// watchSignals are the signals that can be sent to a process when its secrets change.
+// Windows does not support sending signals other than kill to a process.
+var watchSignals = map[string]os.Signal{
+	"SIGKILL": os.Kill,
+}
+
+// stopProcess terminates the process. As Windows does not support
+// signaling a process, it cannot be stopped gracefully.
+func stopProcess(p *os.Process) error {
+	return p.Kill()
+}
@@ -1,39 +1,216 @@
 package secrethub
 
 import (
+	"math/rand"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
 	"github.com/secrethub/secrethub-cli/internals/secrethub/tpl"
+
+	"github.com/secrethub/secrethub-go/internals/api"
 	"github.com/secrethub/secrethub-go/internals/errio"
+	"github.com/secrethub/secrethub-go/pkg/secrethub"
+)
+
+const (
+	// secretReadAttempts is the number of times a secret is tried to be read
+	// when reading it fails because of a temporary failure.
+	secretReadAttempts = 4
+	// secretReadBackoff is the time waited before retrying to read a secret
+	// for the first time. It is doubled on every following attempt.
+	secretReadBackoff = 200 * time.Millisecond
+	// maxConcurrentSecretReads is the maximum number of secrets that are read concurrently when prefetching.
+	maxConcurrentSecretReads = 8
 )
 
 type secretReader struct {
 	newClient newClientFunc
+	mutex     sync.Mutex
+	// versions contains the secret versions that are read, without their data.
+	versions map[string]api.SecretVersion
+	// primedRepos contains the repositories of which a secret has been read.
+	// The client caches keys for every repository it reads from and is not
+	// safe for concurrent use until these are cached. Therefore, the first
+	// secret of every repository is read while holding the mutex.
+	primedRepos map[string]struct{}
+	randomMutex sync.Mutex
+	random      *rand.Rand
+	sleep       func(time.Duration)
 }
 
 // newSecretReader wraps a client to implement tpl.SecretReader.
+// The secret reader can be used concurrently and retries reading secrets
+// when this fails because of a temporary failure.
 func newSecretReader(newClient newClientFunc) *secretReader {
 	return &secretReader{
-		newClient: newClient,
+		newClient:   newClient,
+		versions:    make(map[string]api.SecretVersion),
+		primedRepos: make(map[string]struct{}),
+		random:      rand.New(rand.NewSource(time.Now().UnixNano())),
+		sleep:       time.Sleep,
 	}
 }
 
-// ReadSecret reads the secret using the provided client.
-func (sr secretReader) ReadSecret(path string) (string, error) {
+// ReadSecret reads the secret using the provided client. When the path selects
+// a field, only that field of the value of the secret is returned.
+func (sr *secretReader) ReadSecret(path string) (string, error) {
+	path, field := splitSecretField(path)
+	repo := repoOfSecretPath(path)
+
+	sr.mutex.Lock()
 	client, err := sr.newClient()
+	_, primed := sr.primedRepos[repo]
+	if err != nil || primed {
+		sr.mutex.Unlock()
+	}
 	if err != nil {
 		return "", err
 	}
 
-	secret, err := client.Secrets().Versions().GetWithData(path)
+	secret, err := sr.readWithRetries(client, path)
+	if !primed {
+		if err == nil {
+			sr.primedRepos[repo] = struct{}{}
+		}
+		sr.mutex.Unlock()
+	}
 	if err != nil {
 		return "", err
 	}
 
+	sr.mutex.Lock()
+	version := *secret
+	version.Data = nil
+	sr.versions[path] = version
+	sr.mutex.Unlock()
+
+	if field != "" {
+		value, err := selectSecretField(path, field, secret.Data)
+		return string(value), err
+	}
 	return string(secret.Data), nil
 }
 
+// LookupSecret implements tpl.SecretLookupReader.
+func (sr *secretReader) LookupSecret(path string) (string, bool, error) {
+	secret, err := sr.ReadSecret(path)
+	if isErrNotFound(err) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return secret, true, nil
+}
+
+// ListSecrets implements tpl.SecretDirReader.
+func (sr *secretReader) ListSecrets(dirPath string) ([]string, error) {
+	// The client is not used concurrently, as listing a directory decrypts its contents.
+	sr.mutex.Lock()
+	defer sr.mutex.Unlock()
+
+	client, err := sr.newClient()
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := client.Dirs().GetTree(dirPath, 1, false)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(tree.RootDir.Secrets))
+	for i, secret := range tree.RootDir.Secrets {
+		names[i] = secret.Name
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// readWithRetries reads the secret and retries with an exponential backoff
+// with jitter when reading fails because of a temporary failure.
+func (sr *secretReader) readWithRetries(client secrethub.ClientInterface, path string) (*api.SecretVersion, error) {
+	backoff := secretReadBackoff
+	for attempt := 1; ; attempt++ {
+		secret, err := client.Secrets().Versions().GetWithData(path)
+		if err == nil || attempt >= secretReadAttempts || !isErrTransient(err) {
+			return secret, err
+		}
+
+		sr.sleep(backoff/2 + sr.jitter(backoff/2))
+		backoff *= 2
+	}
+}
+
+// jitter returns a random duration between 0 and max.
+func (sr *secretReader) jitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+
+	sr.randomMutex.Lock()
+	defer sr.randomMutex.Unlock()
+	return time.Duration(sr.random.Int63n(int64(max)))
+}
+
+// Versions returns a copy of the versions of the secrets read with this secret reader by their path.
+func (sr *secretReader) Versions() map[string]int {
+	sr.mutex.Lock()
+	defer sr.mutex.Unlock()
+
+	versions := make(map[string]int, len(sr.versions))
+	for path, version := range sr.versions {
+		versions[path] = version.Version
+	}
+	return versions
+}
+
+// Version returns the version of the secret at the given path that is read.
+func (sr *secretReader) Version(path string) int {
+	sr.mutex.Lock()
+	defer sr.mutex.Unlock()
+	return sr.versions[path].Version
+}
+
+// SecretVersion returns the secret version at the given path that is read, without its data.
+func (sr *secretReader) SecretVersion(path string) api.SecretVersion {
+	sr.mutex.Lock()
+	defer sr.mutex.Unlock()
+	return sr.versions[path]
+}
+
+// repoOfSecretPath returns the path of the repository of the secret at the given path.
+// If the path is not a valid secret path, the path itself is returned.
+func repoOfSecretPath(path string) string {
+	secretPath, err := api.NewSecretPath(path)
+	if err != nil {
+		return path
+	}
+	return secretPath.GetRepoPath().Value()
+}
+
+// isErrTransient returns whether the given error is caused by a temporary failure,
+// so that the request that caused it can be retried.
+func isErrTransient(err error) bool {
+	switch e := err.(type) {
+	case errio.PublicStatusError:
+		return e.StatusCode >= http.StatusInternalServerError || e.StatusCode == http.StatusTooManyRequests
+	case errio.PublicError:
+		// These are the errors returned by the client when a request could not be completed.
+		return e.Namespace == "http" && (e.Code == "timeout" || e.Code == "request_failed")
+	}
+	return false
+}
+
+// bufferedSecretReader caches the secrets read with the underlying secret reader,
+// so that every secret is only read once. It can be used concurrently.
 type bufferedSecretReader struct {
 	secretReader tpl.SecretReader
+	mutex        sync.Mutex
 	secretsRead  []string
+	secrets      map[string]string
 }
 
 // newBufferedSecretReader wraps a secret reader and stores the retrieved
@@ -42,26 +219,123 @@ func newBufferedSecretReader(sr tpl.SecretReader) *bufferedSecretReader {
 	return &bufferedSecretReader{
 		secretReader: sr,
 		secretsRead:  []string{},
+		secrets:      make(map[string]string),
 	}
 }
 
-// ReadSecret uses the underlying secret reader to read the secret
+// ReadSecret returns the secret from the cache when it has been read before.
+// Otherwise, it uses the underlying secret reader to read the secret
 // and stores the result for retrieval with the Values function.
 func (sr *bufferedSecretReader) ReadSecret(path string) (string, error) {
+	sr.mutex.Lock()
+	secret, cached := sr.secrets[path]
+	sr.mutex.Unlock()
+	if cached {
+		return secret, nil
+	}
+
 	secret, err := sr.secretReader.ReadSecret(path)
+	if err != nil {
+		return "", err
+	}
+
+	sr.store(path, secret)
+	return secret, nil
+}
+
+// LookupSecret implements tpl.SecretLookupReader. Secrets that exist are stored
+// in the same way as they are by ReadSecret.
+func (sr *bufferedSecretReader) LookupSecret(path string) (string, bool, error) {
+	sr.mutex.Lock()
+	secret, cached := sr.secrets[path]
+	sr.mutex.Unlock()
+	if cached {
+		return secret, true, nil
+	}
+
+	secret, ok, err := tpl.LookupSecret(sr.secretReader, path)
+	if err != nil || !ok {
+		return "", false, err
+	}
+
+	sr.store(path, secret)
+	return secret, true, nil
+}
 
-	if err == nil {
+// ListSecrets implements tpl.SecretDirReader.
+func (sr *bufferedSecretReader) ListSecrets(dirPath string) ([]string, error) {
+	return tpl.ListSecrets(sr.secretReader, dirPath)
+}
+
+// store adds the secret to the cache if it is not in there yet.
+func (sr *bufferedSecretReader) store(path string, secret string) {
+	sr.mutex.Lock()
+	defer sr.mutex.Unlock()
+	_, cached := sr.secrets[path]
+	if !cached {
 		sr.secretsRead = append(sr.secretsRead, secret)
+		sr.secrets[path] = secret
+	}
+}
+
+// Prefetch implements tpl.SecretPrefetcher. It reads all given secrets that have
+// not been read yet concurrently with a bounded number of workers. If reading any
+// of the secrets fails, the error of the first of these in the given order is returned.
+func (sr *bufferedSecretReader) Prefetch(paths []string) error {
+	seen := make(map[string]struct{}, len(paths))
+	var todo []string
+	sr.mutex.Lock()
+	for _, path := range paths {
+		_, cached := sr.secrets[path]
+		_, duplicate := seen[path]
+		if !cached && !duplicate {
+			todo = append(todo, path)
+			seen[path] = struct{}{}
+		}
 	}
+	sr.mutex.Unlock()
 
-	return secret, err
+	errs := make([]error, len(todo))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < maxConcurrentSecretReads && i < len(todo); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				_, errs[j] = sr.ReadSecret(todo[j])
+			}
+		}()
+	}
+
+	for j := range todo {
+		jobs <- j
+	}
+	close(jobs)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // Values returns a list of values read with this secret reader.
-func (sr bufferedSecretReader) Values() []string {
+func (sr *bufferedSecretReader) Values() []string {
+	sr.mutex.Lock()
+	defer sr.mutex.Unlock()
 	return sr.secretsRead
 }
 
+// Secrets returns the values read with this secret reader by their path.
+func (sr *bufferedSecretReader) Secrets() map[string]string {
+	sr.mutex.Lock()
+	defer sr.mutex.Unlock()
+	return sr.secrets
+}
+
 type ignoreMissingSecretReader struct {
 	secretReader tpl.SecretReader
 }
@@ -82,6 +356,17 @@ func (sr *ignoreMissingSecretReader) ReadSecret(path string) (string, error) {
 	return secret, err
 }
 
+// LookupSecret implements tpl.SecretLookupReader. Secrets that do not exist are
+// reported as such, so that fallbacks for them are used instead of the empty string.
+func (sr *ignoreMissingSecretReader) LookupSecret(path string) (string, bool, error) {
+	return tpl.LookupSecret(sr.secretReader, path)
+}
+
+// ListSecrets implements tpl.SecretDirReader.
+func (sr *ignoreMissingSecretReader) ListSecrets(dirPath string) ([]string, error) {
+	return tpl.ListSecrets(sr.secretReader, dirPath)
+}
+
 // isErrNotFound returns whether the given error is caused by a un-existing resource.
 // TODO: Replace this function with github.com/secrethub/secrethub-go/blob/develop/internals/api.IsErrNotFound once that is released.
 func isErrNotFound(err error) bool {
@@ -91,3 +376,39 @@ func isErrNotFound(err error) bool {
 	}
 	return statusError.StatusCode == 404
 }
+
+// recordingSecretReader wraps a secret reader and records the paths of the secrets that are read.
+type recordingSecretReader struct {
+	secretReader tpl.SecretReader
+	paths        []string
+}
+
+// newRecordingSecretReader wraps a secret reader to record the paths of the secrets that are read.
+func newRecordingSecretReader(sr tpl.SecretReader) *recordingSecretReader {
+	return &recordingSecretReader{
+		secretReader: sr,
+	}
+}
+
+// ReadSecret uses the underlying secret reader to read the secret and records its path.
+func (sr *recordingSecretReader) ReadSecret(path string) (string, error) {
+	sr.paths = append(sr.paths, path)
+	return sr.secretReader.ReadSecret(path)
+}
+
+// LookupSecret implements tpl.SecretLookupReader. It also records the paths of
+// secrets that do not exist.
+func (sr *recordingSecretReader) LookupSecret(path string) (string, bool, error) {
+	sr.paths = append(sr.paths, path)
+	return tpl.LookupSecret(sr.secretReader, path)
+}
+
+// ListSecrets implements tpl.SecretDirReader.
+func (sr *recordingSecretReader) ListSecrets(dirPath string) ([]string, error) {
+	return tpl.ListSecrets(sr.secretReader, dirPath)
+}
+
+// Paths returns the paths of the secrets read with this secret reader, in the order in which they were read.
+func (sr recordingSecretReader) Paths() []string {
+	return sr.paths
+}
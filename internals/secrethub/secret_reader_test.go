@@ -0,0 +1,310 @@
+package secrethub
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/secrethub/secrethub-cli/internals/secrethub/tpl"
+
+	"github.com/secrethub/secrethub-go/internals/api"
+	"github.com/secrethub/secrethub-go/internals/assert"
+	"github.com/secrethub/secrethub-go/internals/errio"
+	"github.com/secrethub/secrethub-go/pkg/secrethub"
+	"github.com/secrethub/secrethub-go/pkg/secrethub/fakeclient"
+)
+
+var (
+	errTestTransient = errio.Namespace("test").Code("unavailable").StatusError("service unavailable", http.StatusServiceUnavailable)
+	errTestNotFound  = errio.Namespace("test").Code("not_found").StatusError("not found", http.StatusNotFound)
+)
+
+// countingSecretReader is a tpl.SecretReader that counts the number of reads of every
+// secret and the maximum number of reads in progress at the same time.
+type countingSecretReader struct {
+	mutex         sync.Mutex
+	reads         map[string]int
+	inProgress    int
+	maxInProgress int
+	errs          map[string]error
+}
+
+func (sr *countingSecretReader) ReadSecret(path string) (string, error) {
+	sr.mutex.Lock()
+	sr.reads[path]++
+	sr.inProgress++
+	if sr.inProgress > sr.maxInProgress {
+		sr.maxInProgress = sr.inProgress
+	}
+	sr.mutex.Unlock()
+
+	time.Sleep(time.Millisecond)
+
+	sr.mutex.Lock()
+	sr.inProgress--
+	sr.mutex.Unlock()
+
+	err := sr.errs[path]
+	if err != nil {
+		return "", err
+	}
+	return "value of " + path, nil
+}
+
+func TestBufferedSecretReader_Prefetch(t *testing.T) {
+	var paths []string
+	for i := 0; i < 20; i++ {
+		paths = append(paths, "company/app/secret"+string(rune('a'+i)))
+	}
+
+	sr := &countingSecretReader{
+		reads: make(map[string]int),
+	}
+	buffered := newBufferedSecretReader(sr)
+
+	err := buffered.Prefetch(append(paths, paths...))
+	assert.OK(t, err)
+
+	for _, path := range paths {
+		secret, err := buffered.ReadSecret(path)
+		assert.OK(t, err)
+		assert.Equal(t, secret, "value of "+path)
+		assert.Equal(t, sr.reads[path], 1)
+	}
+
+	if sr.maxInProgress > maxConcurrentSecretReads {
+		t.Errorf("read %d secrets concurrently, expected at most %d", sr.maxInProgress, maxConcurrentSecretReads)
+	}
+	assert.Equal(t, len(buffered.Secrets()), len(paths))
+}
+
+func TestBufferedSecretReader_Prefetch_Error(t *testing.T) {
+	sr := &countingSecretReader{
+		reads: make(map[string]int),
+		errs: map[string]error{
+			"company/app/b": errors.New("b"),
+			"company/app/c": errors.New("c"),
+		},
+	}
+	buffered := newBufferedSecretReader(sr)
+
+	err := buffered.Prefetch([]string{"company/app/a", "company/app/b", "company/app/c"})
+	assert.Equal(t, err, errors.New("b"))
+
+	// Secrets that could be read are cached.
+	_, err = buffered.ReadSecret("company/app/a")
+	assert.OK(t, err)
+	assert.Equal(t, sr.reads["company/app/a"], 1)
+}
+
+// sequenceVersionService returns the errors in order on every call to GetWithData,
+// after which it returns the version.
+type sequenceVersionService struct {
+	mutex   sync.Mutex
+	errs    []error
+	version *api.SecretVersion
+	calls   int
+	secrethub.SecretVersionService
+}
+
+func (s *sequenceVersionService) GetWithData(path string) (*api.SecretVersion, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.calls++
+	if s.calls <= len(s.errs) {
+		return nil, s.errs[s.calls-1]
+	}
+	return s.version, nil
+}
+
+func TestSecretReader_ReadSecret_Retries(t *testing.T) {
+	cases := map[string]struct {
+		errs          []error
+		expectedCalls int
+		expectedErr   error
+	}{
+		"success": {
+			expectedCalls: 1,
+		},
+		"transient error": {
+			errs:          []error{errTestTransient, errTestTransient},
+			expectedCalls: 3,
+		},
+		"too many transient errors": {
+			errs:          []error{errTestTransient, errTestTransient, errTestTransient, errTestTransient},
+			expectedCalls: secretReadAttempts,
+			expectedErr:   errTestTransient,
+		},
+		"permanent error": {
+			errs:          []error{errTestNotFound},
+			expectedCalls: 1,
+			expectedErr:   errTestNotFound,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			versionService := &sequenceVersionService{
+				errs: tc.errs,
+				version: &api.SecretVersion{
+					Version: 2,
+					Data:    []byte("secret"),
+				},
+			}
+
+			sr := newSecretReader(func() (secrethub.ClientInterface, error) {
+				return fakeclient.Client{
+					SecretService: &fakeclient.SecretService{
+						VersionService: versionService,
+					},
+				}, nil
+			})
+
+			var sleeps []time.Duration
+			sr.sleep = func(d time.Duration) {
+				sleeps = append(sleeps, d)
+			}
+
+			secret, err := sr.ReadSecret("company/app/secret")
+			assert.Equal(t, err, tc.expectedErr)
+			assert.Equal(t, versionService.calls, tc.expectedCalls)
+			if err == nil {
+				assert.Equal(t, secret, "secret")
+				assert.Equal(t, sr.Versions()["company/app/secret"], 2)
+			}
+
+			// Every retry waits between half and the full backoff, which doubles every time.
+			backoff := secretReadBackoff
+			for _, sleep := range sleeps {
+				if sleep < backoff/2 || sleep > backoff {
+					t.Errorf("slept %s, expected between %s and %s", sleep, backoff/2, backoff)
+				}
+				backoff *= 2
+			}
+			assert.Equal(t, len(sleeps), tc.expectedCalls-1)
+		})
+	}
+}
+
+func TestIsErrTransient(t *testing.T) {
+	cases := map[string]struct {
+		err      error
+		expected bool
+	}{
+		"server error": {
+			err:      errTestTransient,
+			expected: true,
+		},
+		"too many requests": {
+			err:      errio.Namespace("test").Code("rate_limited").StatusError("too many requests", http.StatusTooManyRequests),
+			expected: true,
+		},
+		"client timeout": {
+			err:      errio.Namespace("http").Code("timeout").Error("client timed out during request"),
+			expected: true,
+		},
+		"not found": {
+			err:      errTestNotFound,
+			expected: false,
+		},
+		"other error": {
+			err:      errors.New("test"),
+			expected: false,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, isErrTransient(tc.err), tc.expected)
+		})
+	}
+}
+
+func TestLookupSecret(t *testing.T) {
+	cases := map[string]struct {
+		err           error
+		ignoreMissing bool
+		expectedOK    bool
+		expectedErr   error
+	}{
+		"exists": {
+			expectedOK: true,
+		},
+		"not found": {
+			err:        api.ErrSecretNotFound,
+			expectedOK: false,
+		},
+		"not found with ignore missing secrets": {
+			err:           api.ErrSecretNotFound,
+			ignoreMissing: true,
+			expectedOK:    false,
+		},
+		"other error": {
+			err:         errTestTransient,
+			expectedErr: errTestTransient,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			baseReader := newSecretReader(func() (secrethub.ClientInterface, error) {
+				return fakeclient.Client{
+					SecretService: &fakeclient.SecretService{
+						VersionService: &fakeclient.SecretVersionService{
+							WithDataGetter: fakeclient.WithDataGetter{
+								ReturnsVersion: &api.SecretVersion{Data: []byte("secret")},
+								Err:            tc.err,
+							},
+						},
+					},
+				}, nil
+			})
+			baseReader.sleep = func(time.Duration) {}
+
+			var sr tpl.SecretReader = baseReader
+			if tc.ignoreMissing {
+				sr = newIgnoreMissingSecretReader(sr)
+			}
+			buffered := newBufferedSecretReader(sr)
+
+			secret, ok, err := tpl.LookupSecret(buffered, "company/app/secret")
+			assert.Equal(t, err, tc.expectedErr)
+			assert.Equal(t, ok, tc.expectedOK)
+			if ok {
+				assert.Equal(t, secret, "secret")
+				assert.Equal(t, buffered.Secrets(), map[string]string{"company/app/secret": "secret"})
+			}
+		})
+	}
+}
+
+func TestSecretReader_ListSecrets(t *testing.T) {
+	dirService := &fakeclient.DirService{
+		TreeGetter: fakeclient.TreeGetter{
+			ReturnsTree: &api.Tree{
+				RootDir: &api.Dir{
+					Name: "partners",
+					Secrets: []*api.Secret{
+						{Name: "initech"},
+						{Name: "acme"},
+					},
+				},
+			},
+		},
+	}
+
+	sr := newBufferedSecretReader(newSecretReader(func() (secrethub.ClientInterface, error) {
+		return fakeclient.Client{
+			DirService: dirService,
+		}, nil
+	}))
+
+	names, err := tpl.ListSecrets(sr, "company/app/partners")
+	assert.OK(t, err)
+	assert.Equal(t, names, []string{"acme", "initech"})
+	assert.Equal(t, dirService.TreeGetter.ArgPath, "company/app/partners")
+	assert.Equal(t, dirService.TreeGetter.ArgDepth, 1)
+}
@@ -0,0 +1,129 @@
+package secrethub
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/secrethub/secrethub-go/internals/api"
+
+	"github.com/secrethub/secrethub-cli/internals/cli/ui"
+	"github.com/secrethub/secrethub-cli/internals/secrethub/command"
+	"github.com/secrethub/secrethub-cli/internals/secretspec"
+)
+
+// statusExitCode is the exit code of the status command when any of the secrets is not up to date.
+const statusExitCode = 2
+
+// StatusCommand compares the secrets presented on the system with the secrets they are sourced from.
+type StatusCommand struct {
+	in        string
+	io        ui.IO
+	newClient newClientFunc
+}
+
+// NewStatusCommand creates a new StatusCommand.
+func NewStatusCommand(io ui.IO, newClient newClientFunc) *StatusCommand {
+	return &StatusCommand{
+		io:        io,
+		newClient: newClient,
+	}
+}
+
+// Register registers the command, arguments and flags on the provided Registerer.
+func (cmd *StatusCommand) Register(r command.Registerer) {
+	clause := r.Command("status", fmt.Sprintf("Check whether the secrets set in your local environment are still up to date. This reads and parses the secrets.yml file in the current working directory. Exits with code %d when any of the secrets is stale, missing or modified locally.", statusExitCode))
+	clause.Flag("in", "The path to a secrets.yml file to read").Short('i').Default("secrets.yml").ExistingFileVar(&cmd.in)
+
+	command.BindAction(clause, cmd.Run)
+}
+
+// Run prints the status of the secrets on the system and returns an ExitError
+// with statusExitCode when any of them is not up to date.
+func (cmd *StatusCommand) Run() error {
+	upToDate, err := cmd.status()
+	if err != nil {
+		return err
+	}
+
+	if !upToDate {
+		return ExitError{Code: statusExitCode}
+	}
+	return nil
+}
+
+// status prints the status of every consumable in the spec file compared to the latest
+// or pinned versions of its secrets. It returns whether all consumables are up to date.
+func (cmd *StatusCommand) status() (bool, error) {
+	presenter, err := secretspec.NewPresenter("", true, secretspec.DefaultParsers...)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = os.Stat(cmd.in)
+	if os.IsNotExist(err) {
+		return false, ErrFileNotFound(cmd.in)
+	}
+
+	spec, err := ioutil.ReadFile(cmd.in)
+	if err != nil {
+		return false, ErrCannotReadFile(cmd.in, err)
+	}
+
+	err = presenter.Parse(spec)
+	if err != nil {
+		return false, err
+	}
+
+	sources := presenter.Sources()
+	if len(sources) == 0 {
+		return false, ErrNoSourcesInSpec
+	}
+
+	paths := make([]string, 0, len(sources))
+	for path := range sources {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	baseReader := newSecretReader(cmd.newClient)
+	secretReader := newBufferedSecretReader(baseReader)
+	err = secretReader.Prefetch(paths)
+	if err != nil {
+		return false, err
+	}
+
+	secrets := make(map[string]api.SecretVersion, len(paths))
+	for _, path := range paths {
+		value, err := secretReader.ReadSecret(path)
+		if err != nil {
+			return false, err
+		}
+		secret := baseReader.SecretVersion(path)
+		secret.Data = []byte(value)
+		secrets[path] = secret
+	}
+
+	statuses, err := presenter.Status(secrets)
+	if err != nil {
+		return false, err
+	}
+
+	upToDate := true
+	tabWriter := tabwriter.NewWriter(cmd.io.Stdout(), 0, 4, 4, ' ', 0)
+	fmt.Fprintf(tabWriter, "%s\t%s\n", "CONSUMABLE", "STATUS")
+	for _, s := range statuses {
+		fmt.Fprintf(tabWriter, "%s\t%s\n", s.Consumable, s.Status)
+		if s.Status != secretspec.StatusUpToDate {
+			upToDate = false
+		}
+	}
+
+	err = tabWriter.Flush()
+	if err != nil {
+		return false, err
+	}
+	return upToDate, nil
+}
@@ -0,0 +1,96 @@
+package secrethub
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/secrethub/secrethub-cli/internals/cli/ui"
+
+	"github.com/secrethub/secrethub-go/internals/api"
+	"github.com/secrethub/secrethub-go/internals/assert"
+	"github.com/secrethub/secrethub-go/pkg/secrethub"
+	"github.com/secrethub/secrethub-go/pkg/secrethub/fakeclient"
+)
+
+func TestStatusCommand_status(t *testing.T) {
+	dir, cleanup := testdata.tempDir(t)
+	defer cleanup()
+
+	written := time.Now().Add(-time.Hour)
+	files := map[string]string{
+		"up-to-date": "hunter2\n",
+		"stale":      "hunter1\n",
+		"modified":   "hunter1\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		err := ioutil.WriteFile(path, []byte(content), 0400)
+		assert.OK(t, err)
+		err = os.Chtimes(path, written, written)
+		assert.OK(t, err)
+	}
+
+	modified := time.Now()
+	err := os.Chtimes(filepath.Join(dir, "modified"), modified, modified)
+	assert.OK(t, err)
+
+	spec := "secrets:\n"
+	for _, name := range []string{"up-to-date", "stale", "modified", "missing"} {
+		spec += "    - file:\n" +
+			"        source: company/app/" + name + "\n" +
+			"        target: " + filepath.Join(dir, name) + "\n"
+	}
+	in := filepath.Join(dir, "secrets.yml")
+	err = ioutil.WriteFile(in, []byte(spec), 0600)
+	assert.OK(t, err)
+
+	io := ui.NewFakeIO()
+	cmd := StatusCommand{
+		in: in,
+		io: io,
+		newClient: func() (secrethub.ClientInterface, error) {
+			return fakeclient.Client{
+				SecretService: &fakeclient.SecretService{
+					VersionService: &fakeclient.SecretVersionService{
+						WithDataGetter: fakeclient.WithDataGetter{
+							ReturnsVersion: &api.SecretVersion{
+								Version:   2,
+								Data:      []byte("hunter2"),
+								CreatedAt: written.Add(time.Minute),
+							},
+						},
+					},
+				},
+			}, nil
+		},
+	}
+
+	upToDate, err := cmd.status()
+	assert.OK(t, err)
+	assert.Equal(t, upToDate, false)
+
+	expected := "CONSUMABLE" + pad(len("file:"+filepath.Join(dir, "up-to-date"))-len("CONSUMABLE")) + "STATUS\n" +
+		"file:" + filepath.Join(dir, "up-to-date") + "    up to date\n" +
+		"file:" + filepath.Join(dir, "stale") + pad(len("up-to-date")-len("stale")) + "stale\n" +
+		"file:" + filepath.Join(dir, "modified") + pad(len("up-to-date")-len("modified")) + "modified locally\n" +
+		"file:" + filepath.Join(dir, "missing") + pad(len("up-to-date")-len("missing")) + "missing\n"
+	assert.Equal(t, io.StdOut.String(), expected)
+
+	// The command succeeds, but reports with its exit code that not all secrets are up to date.
+	cmd.io = ui.NewFakeIO()
+	err = cmd.Run()
+	assert.Equal(t, err, ExitError{Code: statusExitCode})
+}
+
+// pad returns the padding of a column of the status table that is n characters
+// narrower than the widest cell of the column.
+func pad(n int) string {
+	s := "    "
+	for i := 0; i < n; i++ {
+		s += " "
+	}
+	return s
+}
@@ -1,23 +1,110 @@
 package secrethub
 
 import (
+	"bytes"
+	"io/ioutil"
+
+	"github.com/secrethub/secrethub-cli/internals/cli/ui"
+	"github.com/secrethub/secrethub-cli/internals/secrethub/command"
 	"github.com/secrethub/secrethub-cli/internals/secrethub/tpl"
 )
 
+// TemplateCommand handles operations on templates.
+type TemplateCommand struct {
+	io        ui.IO
+	newClient newClientFunc
+}
+
+// NewTemplateCommand creates a new TemplateCommand.
+func NewTemplateCommand(io ui.IO, newClient newClientFunc) *TemplateCommand {
+	return &TemplateCommand{
+		io:        io,
+		newClient: newClient,
+	}
+}
+
+// Register registers the command and its sub-commands on the provided Registerer.
+func (cmd *TemplateCommand) Register(r command.Registerer) {
+	clause := r.Command("template", "Work with templates and env-files.")
+	NewTemplateCheckCommand(cmd.io, cmd.newClient).Register(clause)
+	NewTemplateLockCommand(cmd.io, cmd.newClient).Register(clause)
+	NewTemplateVarsCommand(cmd.io).Register(clause)
+}
+
 func getTemplateParser(raw []byte, version string) (tpl.Parser, error) {
 	switch version {
 	case "auto":
 		if tpl.IsV1Template(raw) {
 			return tpl.NewV1Parser(), nil
 		}
-		return tpl.NewParser(), nil
+		if tpl.IsV3Template(raw) {
+			return tpl.NewV3Parser(), nil
+		}
+		return tpl.NewV2Parser(), nil
 	case "1", "v1":
 		return tpl.NewV1Parser(), nil
 	case "2", "v2":
 		return tpl.NewV2Parser(), nil
+	case "3", "v3":
+		return tpl.NewV3Parser(), nil
 	case "latest":
 		return tpl.NewParser(), nil
 	default:
 		return nil, ErrUnknownTemplateVersion(version)
 	}
 }
+
+// fileTemplate is a template that is parsed from a file, together with the
+// variable reader with which the references in it are resolved.
+type fileTemplate struct {
+	template  tpl.Template
+	varReader tpl.VariableReader
+	// envKeys contains the lowercased keys that are defined before the template in
+	// an env-file. These can be referenced as template variables in the template.
+	envKeys map[string]struct{}
+	// file is the path of the included env-file the template is defined in.
+	// It is empty for templates that are not included.
+	file string
+}
+
+// parseTemplateFile parses the template file at the given path in the same way
+// as the inject command does.
+func parseTemplateFile(file string, templateVersion string, varReader tpl.VariableReader) ([]fileTemplate, error) {
+	raw, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, ErrReadFile(file, err)
+	}
+
+	parser, err := getTemplateParser(raw, templateVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	template, err := tpl.ForFile(parser, file).Parse(string(raw), 1, 1)
+	if err != nil {
+		return nil, ErrParsingTemplate(file, err)
+	}
+	return []fileTemplate{{template: template, varReader: varReader}}, nil
+}
+
+// parseEnvFileTemplates parses the env-file at the given path in the same way as the
+// run command does and returns the templates of its keys and values. The keys of the
+// env-file are evaluated with the given secret reader, so that references to them in
+// the templates after them can be resolved.
+func parseEnvFileTemplates(file string, templateVersion string, varReader tpl.VariableReader, sr tpl.SecretReader) ([]fileTemplate, error) {
+	raw, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, ErrCannotReadFile(file, err)
+	}
+
+	parser, err := getTemplateParser(raw, templateVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	env, err := newEnvFile(bytes.NewReader(raw), file, varReader, parser)
+	if err != nil {
+		return nil, ErrParsingTemplate(file, err)
+	}
+	return env.(envTemplate).fileTemplates(sr), nil
+}
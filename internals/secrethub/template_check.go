@@ -0,0 +1,405 @@
+package secrethub
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"text/tabwriter"
+
+	"github.com/secrethub/secrethub-cli/internals/cli"
+	"github.com/secrethub/secrethub-cli/internals/cli/ui"
+	"github.com/secrethub/secrethub-cli/internals/secrethub/command"
+	"github.com/secrethub/secrethub-cli/internals/secrethub/tpl"
+
+	"github.com/secrethub/secrethub-go/internals/api"
+	"github.com/secrethub/secrethub-go/internals/errio"
+	"github.com/secrethub/secrethub-go/pkg/secrethub"
+	"github.com/secrethub/secrethub-go/pkg/secretpath"
+)
+
+// Errors
+var (
+	errTemplate              = errio.Namespace("template")
+	ErrNoTemplatesToCheck    = errTemplate.Code("no_templates").Error("no templates to check: provide the path to a template or use --env-file")
+	ErrCannotCheckTemplate   = errTemplate.Code("check_not_supported").ErrorPref("cannot check template file '%s': checking v1 templates is not supported")
+	ErrTemplateProblemsFound = errTemplate.Code("problems_found").ErrorPref("found %d problem(s) in the checked templates")
+)
+
+// Statuses of the references in a template.
+const (
+	referenceStatusOK          = "ok"
+	referenceStatusMissing     = "missing"
+	referenceStatusNotReadable = "not readable"
+	referenceStatusNotSet      = "not set"
+	referenceStatusUnresolved  = "unresolved"
+	referenceStatusInvalid     = "invalid"
+	referenceStatusDynamic     = "dynamic"
+)
+
+// TemplateCheckCommand checks the secrets and variables referenced in templates and env-files
+// without reading any secrets.
+type TemplateCheckCommand struct {
+	io              ui.IO
+	newClient       newClientFunc
+	templates       []string
+	envFiles        []string
+	templateVars    map[string]string
+	varFiles        []string
+	environment     string
+	templateVersion string
+	useJSON         bool
+
+	client secrethub.ClientInterface
+	exists map[string]string
+	// readable contains for every checked directory whether the account can read it.
+	readable map[string]bool
+	// account is the name of the account the secrets are read with. It is
+	// empty when it is not known yet or when the account is not a user.
+	account       string
+	accountLoaded bool
+}
+
+// NewTemplateCheckCommand creates a new TemplateCheckCommand.
+func NewTemplateCheckCommand(io ui.IO, newClient newClientFunc) *TemplateCheckCommand {
+	return &TemplateCheckCommand{
+		io:           io,
+		newClient:    newClient,
+		templateVars: make(map[string]string),
+	}
+}
+
+// Register registers the command, arguments and flags on the provided Registerer.
+func (cmd *TemplateCheckCommand) Register(r command.Registerer) {
+	clause := r.Command("check", "Check that the secrets referenced in templates and env-files exist and are readable and that all template variables are set, without reading any secrets.")
+	clause.Arg("template", "The paths to the template files to check.").StringsVar(&cmd.templates)
+	clause.Flag("env-file", "The path to an env-file as used by `secrethub run` to check. Can be used multiple times.").StringsVar(&cmd.envFiles)
+	clause.Flag("var", "Define the value for a template variable with `VAR=VALUE`, e.g. --var env=prod").Short('v').StringMapVar(&cmd.templateVars)
+	clause.Flag("var-file", "Read template variables from a YAML file with `VAR: VALUE` mappings. Can be used multiple times, in which case later files take precedence. Variables defined with --var or SECRETHUB_VAR_ environment variables take precedence over variable files.").StringsVar(&cmd.varFiles)
+	clause.Flag("environment", "Read template variables from the file secrethub.<environment>.vars.yml, e.g. --environment prod reads secrethub.prod.vars.yml. Variables from files given with --var-file take precedence.").StringVar(&cmd.environment)
+	clause.Flag("template-version", "The template syntax version to be used. The options are v1, v2, v3, latest or auto to automatically detect the version.").Default("auto").StringVar(&cmd.templateVersion)
+	clause.Flag("json", "Output the references in JSON format.").BoolVar(&cmd.useJSON)
+
+	command.BindAction(clause, cmd.Run)
+}
+
+// checkedReference is a reference in a template together with the result of checking it.
+type checkedReference struct {
+	File      string
+	Line      int
+	Column    int
+	Type      string
+	Reference string
+	Path      string `json:",omitempty"`
+	Status    string
+	Optional  bool
+}
+
+// isProblem returns whether the checked reference would make the evaluation of the template fail.
+func (r checkedReference) isProblem() bool {
+	switch r.Status {
+	case referenceStatusOK, referenceStatusDynamic, referenceStatusUnresolved:
+		// Unresolved paths are reported by the variables in them.
+		return false
+	case referenceStatusMissing, referenceStatusNotSet:
+		return !r.Optional
+	default:
+		return true
+	}
+}
+
+// Run checks the references in the templates and env-files and prints the results.
+func (cmd *TemplateCheckCommand) Run() error {
+	if len(cmd.templates) == 0 && len(cmd.envFiles) == 0 {
+		return ErrNoTemplatesToCheck
+	}
+
+	osEnv, _ := parseKeyValueStringsToMap(os.Environ())
+	varReader, err := newVariableReader(osEnv, cmd.templateVars, templateVarFiles(cmd.environment, cmd.varFiles)...)
+	if err != nil {
+		return err
+	}
+
+	cmd.exists = make(map[string]string)
+	cmd.readable = make(map[string]bool)
+
+	var checked []checkedReference
+	for _, file := range cmd.templates {
+		templates, err := parseTemplateFile(file, cmd.templateVersion, varReader)
+		if err != nil {
+			return err
+		}
+
+		res, err := cmd.checkReferences(file, templates)
+		if err != nil {
+			return err
+		}
+		checked = append(checked, res...)
+	}
+
+	for _, file := range cmd.envFiles {
+		// No secrets are read, so keys of which the value contains secrets cannot be resolved.
+		templates, err := parseEnvFileTemplates(file, cmd.templateVersion, varReader, secretReaderNotAllowed{})
+		if err != nil {
+			return err
+		}
+
+		res, err := cmd.checkReferences(file, templates)
+		if err != nil {
+			return err
+		}
+		checked = append(checked, res...)
+	}
+
+	err = cmd.print(checked)
+	if err != nil {
+		return err
+	}
+
+	problems := 0
+	for _, ref := range checked {
+		if ref.isProblem() {
+			problems++
+		}
+	}
+	if problems > 0 {
+		return ErrTemplateProblemsFound(problems)
+	}
+	return nil
+}
+
+// checkReferences checks all references in the given templates of the given file.
+func (cmd *TemplateCheckCommand) checkReferences(file string, templates []fileTemplate) ([]checkedReference, error) {
+	var res []checkedReference
+	for _, template := range templates {
+		refs, ok := tpl.References(template.template)
+		if !ok {
+			return nil, ErrCannotCheckTemplate(file)
+		}
+
+		refFile := file
+		if template.file != "" {
+			refFile = template.file
+		}
+
+		for _, ref := range refs {
+			checked := checkedReference{
+				File:      refFile,
+				Line:      ref.LineNo,
+				Column:    ref.ColumnNo,
+				Type:      ref.Type,
+				Reference: ref.Name,
+				Optional:  ref.Optional,
+			}
+
+			var err error
+			if ref.Type == tpl.ReferenceVariable {
+				checked.Status, err = cmd.checkVariable(ref, template)
+			} else {
+				checked.Path, checked.Status, err = cmd.checkPath(ref, template.varReader)
+			}
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, checked)
+		}
+	}
+	return res, nil
+}
+
+// checkVariable returns the status of a referenced template variable.
+// Keys that are defined earlier in an env-file are always set.
+func (cmd *TemplateCheckCommand) checkVariable(ref tpl.Reference, template fileTemplate) (string, error) {
+	if _, ok := template.envKeys[ref.Name]; ok {
+		return referenceStatusOK, nil
+	}
+
+	_, ok, err := tpl.LookupVariable(template.varReader, ref.Name)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return referenceStatusNotSet, nil
+	}
+	return referenceStatusOK, nil
+}
+
+// checkPath resolves the path of a referenced secret or directory and returns it
+// together with its status.
+func (cmd *TemplateCheckCommand) checkPath(ref tpl.Reference, varReader tpl.VariableReader) (string, string, error) {
+	if ref.Dynamic {
+		return "", referenceStatusDynamic, nil
+	}
+
+	path, ok, err := ref.Resolve(varReader)
+	if err != nil {
+		return "", "", err
+	}
+	if !ok {
+		return "", referenceStatusUnresolved, nil
+	}
+
+	if ref.Type == tpl.ReferenceDir {
+		_, err = api.NewDirPath(path)
+	} else {
+		err = validateSecretFieldPath(path)
+	}
+	if err != nil {
+		return path, referenceStatusInvalid, nil
+	}
+
+	// Whether the selected field of a secret exists is only known once the secret is read.
+	secretPath, _ := splitSecretField(path)
+	status, err := cmd.checkExists(ref.Type, secretPath)
+	if err != nil {
+		return "", "", err
+	}
+	return path, status, nil
+}
+
+// checkExists returns whether the secret or directory with the given path exists and
+// is readable. The results are cached, so that every path is only checked once.
+func (cmd *TemplateCheckCommand) checkExists(refType string, path string) (string, error) {
+	key := refType + ":" + path
+	status, ok := cmd.exists[key]
+	if ok {
+		return status, nil
+	}
+
+	if cmd.client == nil {
+		client, err := cmd.newClient()
+		if err != nil {
+			return "", err
+		}
+		cmd.client = client
+	}
+
+	var exists bool
+	var err error
+	if refType == tpl.ReferenceDir {
+		exists, err = cmd.client.Dirs().Exists(path)
+	} else {
+		exists, err = cmd.client.Secrets().Exists(path)
+	}
+
+	statusErr, isStatusErr := err.(errio.PublicStatusError)
+	switch {
+	case isStatusErr && statusErr.StatusCode == http.StatusForbidden:
+		status = referenceStatusNotReadable
+	case isErrNotFound(err):
+		status = referenceStatusMissing
+	case err != nil:
+		return "", err
+	case exists:
+		status, err = cmd.checkReadable(refType, path)
+		if err != nil {
+			return "", err
+		}
+	default:
+		status = referenceStatusMissing
+	}
+
+	cmd.exists[key] = status
+	return status, nil
+}
+
+// checkReadable returns whether the existing secret or directory with the given path is readable.
+// Secrets and directories can be visible to accounts that cannot read them, so this is determined
+// by the access level of the account on the directory. The access levels are only checked for users,
+// as the name of other accounts cannot be retrieved.
+func (cmd *TemplateCheckCommand) checkReadable(refType string, path string) (string, error) {
+	account, err := cmd.accountName()
+	if err != nil {
+		return "", err
+	}
+	if account == "" {
+		return referenceStatusOK, nil
+	}
+
+	dirPath := path
+	if refType != tpl.ReferenceDir {
+		dirPath = secretpath.Parent(path)
+	}
+
+	readable, ok := cmd.readable[dirPath]
+	if !ok {
+		levels, err := cmd.client.AccessRules().ListLevels(dirPath)
+		statusErr, isStatusErr := err.(errio.PublicStatusError)
+		if err != nil && !(isStatusErr && statusErr.StatusCode == http.StatusForbidden) {
+			return "", err
+		}
+
+		for _, level := range levels {
+			if level.Account != nil && level.Account.Name.Value() == account && level.Permission >= api.PermissionRead {
+				readable = true
+			}
+		}
+		cmd.readable[dirPath] = readable
+	}
+
+	if !readable {
+		return referenceStatusNotReadable, nil
+	}
+	return referenceStatusOK, nil
+}
+
+// accountName returns the name of the account the secrets are read with, or an empty
+// name when the account is not a user.
+func (cmd *TemplateCheckCommand) accountName() (string, error) {
+	if cmd.accountLoaded {
+		return cmd.account, nil
+	}
+
+	me, err := cmd.client.Users().Me()
+	_, isStatusErr := err.(errio.PublicStatusError)
+	if err != nil && !isStatusErr {
+		return "", err
+	}
+	if err == nil {
+		cmd.account = me.Username
+	}
+	cmd.accountLoaded = true
+	return cmd.account, nil
+}
+
+// print writes the checked references to the output in the format requested by the user.
+func (cmd *TemplateCheckCommand) print(checked []checkedReference) error {
+	if cmd.useJSON {
+		if checked == nil {
+			checked = []checkedReference{}
+		}
+
+		output, err := cli.PrettyJSON(checked)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(cmd.io.Stdout(), output)
+		return nil
+	}
+
+	tabWriter := tabwriter.NewWriter(cmd.io.Stdout(), 0, 4, 4, ' ', 0)
+	fmt.Fprintf(tabWriter, "%s\t%s\t%s\t%s\n", "LOCATION", "TYPE", "REFERENCE", "STATUS")
+
+	for _, ref := range checked {
+		reference := ref.Reference
+		if ref.Path != "" && ref.Path != ref.Reference {
+			reference += " -> " + ref.Path
+		}
+
+		status := ref.Status
+		if ref.Optional {
+			status += " (optional)"
+		}
+
+		fmt.Fprintf(tabWriter, "%s:%d:%d\t%s\t%s\t%s\n",
+			ref.File,
+			ref.Line,
+			ref.Column,
+			ref.Type,
+			reference,
+			status,
+		)
+	}
+
+	return tabWriter.Flush()
+}
@@ -0,0 +1,268 @@
+package secrethub
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/secrethub/secrethub-cli/internals/cli/ui"
+
+	"github.com/secrethub/secrethub-go/internals/api"
+	"github.com/secrethub/secrethub-go/internals/assert"
+	"github.com/secrethub/secrethub-go/internals/errio"
+	"github.com/secrethub/secrethub-go/pkg/secrethub"
+	"github.com/secrethub/secrethub-go/pkg/secrethub/fakeclient"
+)
+
+// existsClient is a fake client of which the Exists function of the SecretService
+// and the ListLevels function of the AccessRuleService can be set.
+type existsClient struct {
+	fakeclient.Client
+	secretExistsFunc func(path string) (bool, error)
+	listLevelsFunc   func(path string) ([]*api.AccessLevel, error)
+}
+
+func (c existsClient) Secrets() secrethub.SecretService {
+	return existsSecretService{existsFunc: c.secretExistsFunc}
+}
+
+func (c existsClient) AccessRules() secrethub.AccessRuleService {
+	return listLevelsAccessRuleService{listLevelsFunc: c.listLevelsFunc}
+}
+
+type listLevelsAccessRuleService struct {
+	secrethub.AccessRuleService
+	listLevelsFunc func(path string) ([]*api.AccessLevel, error)
+}
+
+func (s listLevelsAccessRuleService) ListLevels(path string) ([]*api.AccessLevel, error) {
+	return s.listLevelsFunc(path)
+}
+
+type existsSecretService struct {
+	secrethub.SecretService
+	existsFunc func(path string) (bool, error)
+}
+
+func (s existsSecretService) Exists(path string) (bool, error) {
+	return s.existsFunc(path)
+}
+
+func TestTemplateCheckCommand_Run(t *testing.T) {
+	errForbidden := errio.Namespace("test").Code("forbidden").StatusError("forbidden", http.StatusForbidden)
+
+	dir := filepath.Join("testdata", "template_check")
+	err := os.MkdirAll(dir, 0770)
+	assert.OK(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		assert.OK(t, err)
+	}()
+
+	cases := map[string]struct {
+		template string
+		envFile  string
+		partials map[string]string
+		version  string
+		vars     map[string]string
+		secrets  map[string]error
+		dirs     map[string]bool
+		// noRead contains the directories the account cannot read.
+		noRead  map[string]bool
+		useJSON bool
+		out     string
+		err     error
+	}{
+		"success": {
+			template: "db: {{ company/${env}/db }}\n",
+			vars: map[string]string{
+				"env": "prd",
+			},
+			secrets: map[string]error{
+				"company/prd/db": nil,
+			},
+			out: "LOCATION                                 TYPE        REFERENCE                              STATUS\n" +
+				"testdata/template_check/template:1:8     secret      company/${env}/db -> company/prd/db    ok\n" +
+				"testdata/template_check/template:1:16    variable    env                                    ok\n",
+		},
+		"missing secret and variable": {
+			template: "{{ company/app/db }}\n${env}",
+			out: "LOCATION                                TYPE        REFERENCE         STATUS\n" +
+				"testdata/template_check/template:1:4    secret      company/app/db    missing\n" +
+				"testdata/template_check/template:2:1    variable    env               not set\n",
+			err: ErrTemplateProblemsFound(2),
+		},
+		"optional references": {
+			template: "{{ company/app/db || \"localhost\" }}:${port:-80}",
+			out: "LOCATION                                 TYPE        REFERENCE         STATUS\n" +
+				"testdata/template_check/template:1:4     secret      company/app/db    missing (optional)\n" +
+				"testdata/template_check/template:1:37    variable    port              not set (optional)\n",
+		},
+		"not readable": {
+			template: "{{ company/app/db }}",
+			secrets: map[string]error{
+				"company/app/db": errForbidden,
+			},
+			out: "LOCATION                                TYPE      REFERENCE         STATUS\n" +
+				"testdata/template_check/template:1:4    secret    company/app/db    not readable\n",
+			err: ErrTemplateProblemsFound(1),
+		},
+		"not readable by access rules": {
+			template: "{{ company/app/db }}\n{{ company/other/db }}",
+			secrets: map[string]error{
+				"company/app/db":   nil,
+				"company/other/db": nil,
+			},
+			noRead: map[string]bool{
+				"company/other": true,
+			},
+			out: "LOCATION                                TYPE      REFERENCE           STATUS\n" +
+				"testdata/template_check/template:1:4    secret    company/app/db      ok\n" +
+				"testdata/template_check/template:2:4    secret    company/other/db    not readable\n",
+			err: ErrTemplateProblemsFound(1),
+		},
+		"range": {
+			template: "{{ range $name := company/app }}{{ company/app/${name} }}{{ end }}",
+			dirs: map[string]bool{
+				"company/app": true,
+			},
+			out: "LOCATION                                 TYPE      REFERENCE              STATUS\n" +
+				"testdata/template_check/template:1:19    dir       company/app            ok\n" +
+				"testdata/template_check/template:1:36    secret    company/app/${name}    dynamic\n",
+		},
+		"env-file json": {
+			envFile: "DB_HOST=${host}\nDB_PASSWORD={{ company/app/db }}\n",
+			useJSON: true,
+			out: `[
+    {
+        "File": "testdata/template_check/env",
+        "Line": 1,
+        "Column": 9,
+        "Type": "variable",
+        "Reference": "host",
+        "Status": "not set",
+        "Optional": false
+    },
+    {
+        "File": "testdata/template_check/env",
+        "Line": 2,
+        "Column": 16,
+        "Type": "secret",
+        "Reference": "company/app/db",
+        "Path": "company/app/db",
+        "Status": "missing",
+        "Optional": false
+    }
+]
+`,
+			err: ErrTemplateProblemsFound(2),
+		},
+		"env-file with earlier keys": {
+			envFile: "APP=billing\nDB_HOST={{ company/${APP}/db_host }}\nDB_PASSWORD={{ company/${DB_HOST}/password }}\n",
+			secrets: map[string]error{
+				"company/billing/db_host": nil,
+			},
+			// The value of DB_HOST is not known without reading its secret.
+			out: "LOCATION                            TYPE        REFERENCE                                            STATUS\n" +
+				"testdata/template_check/env:2:12    secret      company/${app}/db_host -> company/billing/db_host    ok\n" +
+				"testdata/template_check/env:2:20    variable    app                                                  ok\n" +
+				"testdata/template_check/env:3:16    secret      company/${db_host}/password                          unresolved\n" +
+				"testdata/template_check/env:3:24    variable    db_host                                              ok\n",
+		},
+		"env-file with include": {
+			envFile: "{{ include \"db.env\" }}\nAPP=${app}\n",
+			partials: map[string]string{
+				"db.env": "DB_HOST=${host:-localhost}\nDB_PASSWORD={{ company/app/db }}\n",
+			},
+			vars: map[string]string{
+				"app": "billing",
+			},
+			secrets: map[string]error{
+				"company/app/db": nil,
+			},
+			out: "LOCATION                               TYPE        REFERENCE         STATUS\n" +
+				"testdata/template_check/db.env:1:9     variable    host              not set (optional)\n" +
+				"testdata/template_check/db.env:2:16    secret      company/app/db    ok\n" +
+				"testdata/template_check/env:2:5        variable    app               ok\n",
+		},
+		"v1 template": {
+			template: "{{ company/app/db }}",
+			version:  "v1",
+			err:      ErrCannotCheckTemplate("testdata/template_check/template"),
+		},
+		"no templates": {
+			err: ErrNoTemplatesToCheck,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			// Setup
+			io := ui.NewFakeIO()
+			cmd := NewTemplateCheckCommand(io, func() (secrethub.ClientInterface, error) {
+				return existsClient{
+					Client: fakeclient.Client{
+						DirService: &fakeclient.DirService{
+							ExistsFunc: func(path string) (bool, error) {
+								return tc.dirs[path], nil
+							},
+						},
+						UserService: &fakeclient.UserService{
+							MeGetter: fakeclient.MeGetter{
+								ReturnsUser: &api.User{Username: "dev1"},
+							},
+						},
+					},
+					secretExistsFunc: func(path string) (bool, error) {
+						err, ok := tc.secrets[path]
+						return ok && err == nil, err
+					},
+					listLevelsFunc: func(path string) ([]*api.AccessLevel, error) {
+						permission := api.PermissionRead
+						if tc.noRead[path] {
+							permission = api.PermissionNone
+						}
+						return []*api.AccessLevel{
+							{Account: &api.Account{Name: "dev1"}, Permission: permission},
+							{Account: &api.Account{Name: "dev2"}, Permission: api.PermissionAdmin},
+						}, nil
+					},
+				}, nil
+			})
+			cmd.templateVersion = "auto"
+			if tc.version != "" {
+				cmd.templateVersion = tc.version
+			}
+			cmd.useJSON = tc.useJSON
+			for k, v := range tc.vars {
+				cmd.templateVars[k] = v
+			}
+
+			if tc.template != "" {
+				path := filepath.Join(dir, "template")
+				err := ioutil.WriteFile(path, []byte(tc.template), 0600)
+				assert.OK(t, err)
+				cmd.templates = []string{path}
+			}
+			for name, partial := range tc.partials {
+				err := ioutil.WriteFile(filepath.Join(dir, name), []byte(partial), 0600)
+				assert.OK(t, err)
+			}
+			if tc.envFile != "" {
+				path := filepath.Join(dir, "env")
+				err := ioutil.WriteFile(path, []byte(tc.envFile), 0600)
+				assert.OK(t, err)
+				cmd.envFiles = []string{path}
+			}
+
+			// Act
+			err := cmd.Run()
+
+			// Assert
+			assert.Equal(t, err, tc.err)
+			assert.Equal(t, io.StdOut.String(), tc.out)
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package secrethub
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/secrethub/secrethub-cli/internals/cli/ui"
+	"github.com/secrethub/secrethub-cli/internals/secrethub/command"
+	"github.com/secrethub/secrethub-cli/internals/secrethub/tpl"
+
+	"github.com/secrethub/secrethub-go/pkg/secrethub"
+	"github.com/secrethub/secrethub-go/pkg/secretpath"
+)
+
+// Errors
+var (
+	ErrCannotLockReference = errTemplate.Code("cannot_lock").ErrorPref("cannot lock %s at %s:%d:%d: %s")
+)
+
+// TemplateLockCommand pins the secrets referenced in templates and env-files
+// at their current version in a lockfile.
+type TemplateLockCommand struct {
+	io              ui.IO
+	newClient       newClientFunc
+	templates       []string
+	envFiles        []string
+	templateVars    map[string]string
+	varFiles        []string
+	environment     string
+	templateVersion string
+	lockFile        string
+
+	client secrethub.ClientInterface
+}
+
+// NewTemplateLockCommand creates a new TemplateLockCommand.
+func NewTemplateLockCommand(io ui.IO, newClient newClientFunc) *TemplateLockCommand {
+	return &TemplateLockCommand{
+		io:           io,
+		newClient:    newClient,
+		templateVars: make(map[string]string),
+	}
+}
+
+// Register registers the command, arguments and flags on the provided Registerer.
+func (cmd *TemplateLockCommand) Register(r command.Registerer) {
+	clause := r.Command("lock", "Write a lockfile that pins every secret referenced in templates and env-files at its current version. The run and inject commands read secrets at the pinned versions when the lockfile exists.")
+	clause.Arg("template", "The paths to the template files to lock.").StringsVar(&cmd.templates)
+	clause.Flag("env-file", "The path to an env-file as used by `secrethub run` to lock. Can be used multiple times.").StringsVar(&cmd.envFiles)
+	clause.Flag("var", "Define the value for a template variable with `VAR=VALUE`, e.g. --var env=prod").Short('v').StringMapVar(&cmd.templateVars)
+	clause.Flag("var-file", "Read template variables from a YAML file with `VAR: VALUE` mappings. Can be used multiple times, in which case later files take precedence. Variables defined with --var or SECRETHUB_VAR_ environment variables take precedence over variable files.").StringsVar(&cmd.varFiles)
+	clause.Flag("environment", "Read template variables from the file secrethub.<environment>.vars.yml, e.g. --environment prod reads secrethub.prod.vars.yml. Variables from files given with --var-file take precedence.").StringVar(&cmd.environment)
+	clause.Flag("template-version", "The template syntax version to be used. The options are v1, v2, v3, latest or auto to automatically detect the version.").Default("auto").StringVar(&cmd.templateVersion)
+	clause.Flag("lock-file", "The path of the lockfile to write.").Default(defaultLockFile).StringVar(&cmd.lockFile)
+
+	command.BindAction(clause, cmd.Run)
+}
+
+// Run resolves the versions of all referenced secrets and writes them to the lockfile.
+// Secrets in directories that are ranged over are locked as well.
+func (cmd *TemplateLockCommand) Run() error {
+	if len(cmd.templates) == 0 && len(cmd.envFiles) == 0 {
+		return ErrNoTemplatesToCheck
+	}
+
+	osEnv, _ := parseKeyValueStringsToMap(os.Environ())
+	varReader, err := newVariableReader(osEnv, cmd.templateVars, templateVarFiles(cmd.environment, cmd.varFiles)...)
+	if err != nil {
+		return err
+	}
+
+	lock := newLockFile(cmd.lockFile)
+
+	for _, file := range cmd.templates {
+		templates, err := parseTemplateFile(file, cmd.templateVersion, varReader)
+		if err != nil {
+			return err
+		}
+
+		err = cmd.lockReferences(lock, file, templates)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, file := range cmd.envFiles {
+		// Keys that are referenced in the paths of secrets are resolved in the same way as
+		// the run command does, which reads the secrets used in their values.
+		templates, err := parseEnvFileTemplates(file, cmd.templateVersion, varReader, newSecretReader(cmd.getClient))
+		if err != nil {
+			return err
+		}
+
+		err = cmd.lockReferences(lock, file, templates)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = lock.write()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(cmd.io.Stdout(), "Locked %d secrets in %s\n", len(lock.Secrets), cmd.lockFile)
+	return nil
+}
+
+// lockReferences adds the secrets referenced in the given templates of the given file to the lockfile.
+func (cmd *TemplateLockCommand) lockReferences(lock *lockFile, file string, templates []fileTemplate) error {
+	for _, template := range templates {
+		refs, ok := tpl.References(template.template)
+		if !ok {
+			return ErrCannotCheckTemplate(file)
+		}
+
+		refFile := file
+		if template.file != "" {
+			refFile = template.file
+		}
+
+		for _, ref := range refs {
+			// Variables do not have versions and the paths of dynamic references
+			// are in the directories they range over, which are locked instead.
+			if ref.Type == tpl.ReferenceVariable || ref.Dynamic {
+				continue
+			}
+
+			path, ok, err := ref.Resolve(template.varReader)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return ErrCannotLockReference(ref.Name, refFile, ref.LineNo, ref.ColumnNo, "not all template variables in the path are set")
+			}
+
+			if ref.Type == tpl.ReferenceDir {
+				err = cmd.lockDir(lock, path)
+			} else {
+				// The version of a secret is locked for all fields selected from it.
+				path, _ = splitSecretField(path)
+				err = cmd.lockSecret(lock, path, ref.Optional)
+			}
+			if err != nil {
+				return ErrCannotLockReference(ref.Name, refFile, ref.LineNo, ref.ColumnNo, err)
+			}
+		}
+	}
+	return nil
+}
+
+// lockSecret adds the secret at the given path to the lockfile. Optional secrets that do not exist are skipped.
+func (cmd *TemplateLockCommand) lockSecret(lock *lockFile, path string, optional bool) error {
+	if hasVersion(path) {
+		return nil
+	}
+
+	client, err := cmd.getClient()
+	if err != nil {
+		return err
+	}
+
+	version, err := client.Secrets().Versions().GetWithoutData(path)
+	if isErrNotFound(err) && optional {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	lock.Secrets[path] = version.Version
+	return nil
+}
+
+// lockDir adds the secrets directly in the directory at the given path to the lockfile.
+func (cmd *TemplateLockCommand) lockDir(lock *lockFile, path string) error {
+	client, err := cmd.getClient()
+	if err != nil {
+		return err
+	}
+
+	tree, err := client.Dirs().GetTree(path, 1, false)
+	if err != nil {
+		return err
+	}
+
+	for _, secret := range tree.RootDir.Secrets {
+		lock.Secrets[secretpath.Join(path, secret.Name)] = secret.LatestVersion
+	}
+	return nil
+}
+
+// getClient returns the client, creating it when it is used for the first time.
+func (cmd *TemplateLockCommand) getClient() (secrethub.ClientInterface, error) {
+	if cmd.client == nil {
+		client, err := cmd.newClient()
+		if err != nil {
+			return nil, err
+		}
+		cmd.client = client
+	}
+	return cmd.client, nil
+}
@@ -0,0 +1,157 @@
+package secrethub
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/secrethub/secrethub-cli/internals/cli/ui"
+
+	"github.com/secrethub/secrethub-go/internals/api"
+	"github.com/secrethub/secrethub-go/internals/assert"
+	"github.com/secrethub/secrethub-go/pkg/secrethub"
+	"github.com/secrethub/secrethub-go/pkg/secrethub/fakeclient"
+)
+
+// latestVersionService returns the latest versions of the secrets by their path.
+type latestVersionService struct {
+	versions map[string]int
+	values   map[string]string
+	secrethub.SecretVersionService
+}
+
+func (s latestVersionService) GetWithData(path string) (*api.SecretVersion, error) {
+	version, err := s.GetWithoutData(path)
+	if err != nil {
+		return nil, err
+	}
+	version.Data = []byte(s.values[path])
+	return version, nil
+}
+
+func (s latestVersionService) GetWithoutData(path string) (*api.SecretVersion, error) {
+	version, ok := s.versions[path]
+	if !ok {
+		return nil, errTestNotFound
+	}
+	return &api.SecretVersion{Version: version}, nil
+}
+
+func TestTemplateLockCommand_Run(t *testing.T) {
+	cases := map[string]struct {
+		template string
+		envFile  string
+		vars     map[string]string
+		versions map[string]int
+		values   map[string]string
+		tree     *api.Tree
+		expected map[string]int
+		err      func(file string) error
+	}{
+		"success": {
+			template: "db: {{ company/${env}/db }}\n" +
+				"key: {{ company/app/key:1 }}\n" +
+				"host: {{ company/app/host || \"localhost\" }}\n" +
+				"{{ range $name := company/app/partners }}{{ company/app/partners/${name} }}{{ end }}",
+			vars: map[string]string{
+				"env": "prd",
+			},
+			versions: map[string]int{
+				"company/prd/db": 4,
+			},
+			tree: &api.Tree{
+				RootDir: &api.Dir{
+					Secrets: []*api.Secret{
+						{Name: "acme", LatestVersion: 2},
+						{Name: "initech", LatestVersion: 1},
+					},
+				},
+			},
+			expected: map[string]int{
+				"company/prd/db":               4,
+				"company/app/partners/acme":    2,
+				"company/app/partners/initech": 1,
+			},
+		},
+		"env-file with earlier keys": {
+			envFile: "APP=billing\nDB_HOST={{ company/${APP}/db_host }}\nDB_PASSWORD={{ company/${DB_HOST}/password }}\n",
+			versions: map[string]int{
+				"company/billing/db_host": 2,
+				"company/db1/password":    5,
+			},
+			values: map[string]string{
+				"company/billing/db_host": "db1",
+			},
+			expected: map[string]int{
+				"company/billing/db_host": 2,
+				"company/db1/password":    5,
+			},
+		},
+		"secret not found": {
+			template: "{{ company/app/db }}",
+			err: func(file string) error {
+				return ErrCannotLockReference("company/app/db", file, 1, 4, errTestNotFound)
+			},
+		},
+		"variable not set": {
+			template: "{{ company/${env}/db }}",
+			err: func(file string) error {
+				return ErrCannotLockReference("company/${env}/db", file, 1, 4, "not all template variables in the path are set")
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			dir, cleanup := testdata.tempDir(t)
+			defer cleanup()
+
+			// Setup
+			io := ui.NewFakeIO()
+			cmd := NewTemplateLockCommand(io, func() (secrethub.ClientInterface, error) {
+				return fakeclient.Client{
+					SecretService: &fakeclient.SecretService{
+						VersionService: latestVersionService{versions: tc.versions, values: tc.values},
+					},
+					DirService: &fakeclient.DirService{
+						TreeGetter: fakeclient.TreeGetter{
+							ReturnsTree: tc.tree,
+						},
+					},
+				}, nil
+			})
+			cmd.templateVersion = "auto"
+			cmd.lockFile = filepath.Join(dir, defaultLockFile)
+			for k, v := range tc.vars {
+				cmd.templateVars[k] = v
+			}
+
+			template := filepath.Join(dir, "template")
+			if tc.envFile != "" {
+				err := ioutil.WriteFile(template, []byte(tc.envFile), 0600)
+				assert.OK(t, err)
+				cmd.envFiles = []string{template}
+			} else {
+				err := ioutil.WriteFile(template, []byte(tc.template), 0600)
+				assert.OK(t, err)
+				cmd.templates = []string{template}
+			}
+
+			// Act
+			err := cmd.Run()
+
+			// Assert
+			if tc.err != nil {
+				assert.Equal(t, err, tc.err(template))
+			} else {
+				assert.OK(t, err)
+
+				lock, err := readLockFile(cmd.lockFile)
+				assert.OK(t, err)
+				assert.Equal(t, lock.Secrets, tc.expected)
+				assert.Equal(t, io.StdOut.String(), fmt.Sprintf("Locked %d secrets in %s\n", len(tc.expected), cmd.lockFile))
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package secrethub
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/secrethub/secrethub-cli/internals/cli"
+	"github.com/secrethub/secrethub-cli/internals/cli/ui"
+	"github.com/secrethub/secrethub-cli/internals/secrethub/command"
+)
+
+// TemplateVarsCommand lists the template variables that are used by run and inject
+// with the given flags, together with where they are defined.
+type TemplateVarsCommand struct {
+	io           ui.IO
+	templateVars map[string]string
+	varFiles     []string
+	environment  string
+	useJSON      bool
+}
+
+// NewTemplateVarsCommand creates a new TemplateVarsCommand.
+func NewTemplateVarsCommand(io ui.IO) *TemplateVarsCommand {
+	return &TemplateVarsCommand{
+		io:           io,
+		templateVars: make(map[string]string),
+	}
+}
+
+// Register registers the command, arguments and flags on the provided Registerer.
+func (cmd *TemplateVarsCommand) Register(r command.Registerer) {
+	clause := r.Command("vars", "List the values of the template variables and where they are defined.")
+	clause.Flag("var", "Define the value for a template variable with `VAR=VALUE`, e.g. --var env=prod").Short('v').StringMapVar(&cmd.templateVars)
+	clause.Flag("var-file", "Read template variables from a YAML file with `VAR: VALUE` mappings. Can be used multiple times, in which case later files take precedence. Variables defined with --var or SECRETHUB_VAR_ environment variables take precedence over variable files.").StringsVar(&cmd.varFiles)
+	clause.Flag("environment", "Read template variables from the file secrethub.<environment>.vars.yml, e.g. --environment prod reads secrethub.prod.vars.yml. Variables from files given with --var-file take precedence.").StringVar(&cmd.environment)
+	clause.Flag("json", "Output the variables in JSON format.").BoolVar(&cmd.useJSON)
+
+	command.BindAction(clause, cmd.Run)
+}
+
+// Run prints the resolved template variables sorted by name.
+func (cmd *TemplateVarsCommand) Run() error {
+	osEnv, _ := parseKeyValueStringsToMap(os.Environ())
+	templateVars, err := readTemplateVars(osEnv, cmd.templateVars, templateVarFiles(cmd.environment, cmd.varFiles))
+	if err != nil {
+		return err
+	}
+
+	vars := make([]templateVar, 0, len(templateVars))
+	for _, v := range templateVars {
+		vars = append(vars, v)
+	}
+	sort.Slice(vars, func(i, j int) bool {
+		return vars[i].Name < vars[j].Name
+	})
+
+	if cmd.useJSON {
+		output, err := cli.PrettyJSON(vars)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(cmd.io.Stdout(), output)
+		return nil
+	}
+
+	tabWriter := tabwriter.NewWriter(cmd.io.Stdout(), 0, 4, 4, ' ', 0)
+	fmt.Fprintf(tabWriter, "%s\t%s\t%s\n", "NAME", "VALUE", "SOURCE")
+	for _, v := range vars {
+		fmt.Fprintf(tabWriter, "%s\t%s\t%s\n", v.Name, v.Value, v.Source)
+	}
+	return tabWriter.Flush()
+}
@@ -0,0 +1,33 @@
+package secrethub
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/secrethub/secrethub-cli/internals/cli/ui"
+
+	"github.com/secrethub/secrethub-go/internals/assert"
+)
+
+func TestTemplateVarsCommand_Run(t *testing.T) {
+	dir, cleanup := testdata.tempDir(t)
+	defer cleanup()
+
+	varFile := filepath.Join(dir, "vars.yml")
+	err := ioutil.WriteFile(varFile, []byte("env: prd\napp: billing\n"), 0600)
+	assert.OK(t, err)
+
+	io := ui.NewFakeIO()
+	cmd := NewTemplateVarsCommand(io)
+	cmd.varFiles = []string{varFile}
+	cmd.templateVars["app"] = "invoicing"
+
+	err = cmd.Run()
+	assert.OK(t, err)
+
+	expected := "NAME    VALUE        SOURCE\n" +
+		"app     invoicing    --var\n" +
+		"env     prd          " + varFile + "\n"
+	assert.Equal(t, io.StdOut.String(), expected)
+}
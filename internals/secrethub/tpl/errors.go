@@ -2,11 +2,14 @@ package tpl
 
 import (
 	"fmt"
+	"strings"
 )
 
 // Evaluate errors
 var (
 	ErrTemplateVarNotFound = tplError.Code("template_var_not_found").ErrorPref("no value was supplied for template variable '%s'")
+	ErrFunctionFailed      = tplError.Code("function_failed").ErrorPref("cannot apply function %s to the secret at %s: %s")
+	ErrCannotListSecrets   = tplError.Code("cannot_list_secrets").ErrorPref("cannot list the secrets in directory %s: ranging over directories is not supported here")
 )
 
 // Parse errors
@@ -73,3 +76,98 @@ func ErrVariableTagNotClosed(lineNo, colNo int) error {
 		msg:    "expected the closing of a variable tag `}`, but reached the end of the template.",
 	}
 }
+
+// ErrIllegalFunctionCharacter is returned when a function name in a pipeline contains a character that is not allowed.
+func ErrIllegalFunctionCharacter(lineNo, colNo int, char rune) error {
+	return templateSyntaxError{
+		lineNo: lineNo,
+		colNo:  colNo,
+		code:   "illegal_function_character",
+		msg:    fmt.Sprintf("illegal character '%c'. Function names can only contain letters, digits and underscores.", char),
+	}
+}
+
+// ErrUnknownFunction is returned when a pipeline contains a function that does not exist.
+func ErrUnknownFunction(lineNo, colNo int, name string) error {
+	return templateSyntaxError{
+		lineNo: lineNo,
+		colNo:  colNo,
+		code:   "unknown_function",
+		msg:    fmt.Sprintf("unknown function '%s'. Available functions are: %s.", name, strings.Join(functionNames(), ", ")),
+	}
+}
+
+// ErrWrongNumberOfArguments is returned when a function in a pipeline is given the wrong number of arguments.
+func ErrWrongNumberOfArguments(lineNo, colNo int, name string, expected, actual int) error {
+	return templateSyntaxError{
+		lineNo: lineNo,
+		colNo:  colNo,
+		code:   "wrong_number_of_arguments",
+		msg:    fmt.Sprintf("function '%s' takes %d argument(s), but %d were given.", name, expected, actual),
+	}
+}
+
+// ErrInvalidFunctionArgument is returned when a function in a pipeline is given an argument it does not accept.
+func ErrInvalidFunctionArgument(lineNo, colNo int, name string, arg string, err error) error {
+	return templateSyntaxError{
+		lineNo: lineNo,
+		colNo:  colNo,
+		code:   "invalid_function_argument",
+		msg:    fmt.Sprintf("invalid argument '%s' for function '%s': %s.", arg, name, err),
+	}
+}
+
+// ErrBlockNotClosed is returned when an if or range block is opened, but never closed with an end tag.
+func ErrBlockNotClosed(lineNo, colNo int, keyword string) error {
+	return templateSyntaxError{
+		lineNo: lineNo,
+		colNo:  colNo,
+		code:   "block_not_closed",
+		msg:    fmt.Sprintf("the %s block is never closed with `{{ end }}`.", keyword),
+	}
+}
+
+// ErrUnexpectedBlockTag is returned when an else or end tag does not belong to a block.
+func ErrUnexpectedBlockTag(lineNo, colNo int, keyword string) error {
+	blocks := "`{{ if ... }}`"
+	if keyword == "end" {
+		blocks = "`{{ if ... }}` or `{{ range ... }}`"
+	}
+
+	return templateSyntaxError{
+		lineNo: lineNo,
+		colNo:  colNo,
+		code:   "unexpected_block_tag",
+		msg:    fmt.Sprintf("unexpected `{{ %s }}`. It can only be used to close a block opened with %s.", keyword, blocks),
+	}
+}
+
+// ErrCannotInclude is returned when the template in an include tag cannot be read.
+func ErrCannotInclude(lineNo, colNo int, path string, err error) error {
+	return templateSyntaxError{
+		lineNo: lineNo,
+		colNo:  colNo,
+		code:   "cannot_include",
+		msg:    fmt.Sprintf("cannot include template %s: %s", path, err),
+	}
+}
+
+// ErrIncludeCycle is returned when a template includes itself, directly or through other templates.
+func ErrIncludeCycle(lineNo, colNo int, path string) error {
+	return templateSyntaxError{
+		lineNo: lineNo,
+		colNo:  colNo,
+		code:   "include_cycle",
+		msg:    fmt.Sprintf("cannot include template %s: it includes itself.", path),
+	}
+}
+
+// ErrIncludeFailed is returned when an included template contains an error.
+func ErrIncludeFailed(lineNo, colNo int, path string, err error) error {
+	return templateSyntaxError{
+		lineNo: lineNo,
+		colNo:  colNo,
+		code:   "include_failed",
+		msg:    fmt.Sprintf("in included template %s: %s", path, err),
+	}
+}
@@ -1,6 +1,10 @@
 package fakes
 
-import "errors"
+import (
+	"errors"
+	"sort"
+	"strings"
+)
 
 // FakeSecretReader implements tpl.SecretReader.
 type FakeSecretReader struct {
@@ -15,3 +19,22 @@ func (fsr FakeSecretReader) ReadSecret(path string) (string, error) {
 	}
 	return "", errors.New("secret not found")
 }
+
+// LookupSecret implements tpl.SecretLookupReader.LookupSecret.
+func (fsr FakeSecretReader) LookupSecret(path string) (string, bool, error) {
+	secret, ok := fsr.Secrets[path]
+	return secret, ok, nil
+}
+
+// ListSecrets implements tpl.SecretDirReader.ListSecrets.
+func (fsr FakeSecretReader) ListSecrets(dirPath string) ([]string, error) {
+	var names []string
+	for path := range fsr.Secrets {
+		name := strings.TrimPrefix(path, dirPath+"/")
+		if name != path && !strings.Contains(name, "/") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -13,3 +13,8 @@ func (r FakeVariableReader) ReadVariable(name string) (string, error) {
 	}
 	return variable, nil
 }
+
+func (r FakeVariableReader) LookupVariable(name string) (string, bool, error) {
+	variable, ok := r.Variables[name]
+	return variable, ok, nil
+}
@@ -0,0 +1,165 @@
+package tpl
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// function is a function that can be applied to the value of a secret in a pipeline,
+// e.g. {{ path/to/secret | base64 }}.
+type function struct {
+	// args is the number of arguments the function takes.
+	args int
+	// checkArgs validates the arguments of the function when parsing.
+	// It can be nil when any arguments are valid.
+	checkArgs func(args []string) error
+	// apply applies the function to the value with the given arguments.
+	apply func(value string, args []string) (string, error)
+}
+
+// functions contains the functions that can be used in pipelines by name.
+var functions = map[string]function{
+	"base64": {
+		apply: func(value string, _ []string) (string, error) {
+			return base64.StdEncoding.EncodeToString([]byte(value)), nil
+		},
+	},
+	"base64decode": {
+		apply: func(value string, _ []string) (string, error) {
+			decoded, err := base64.StdEncoding.DecodeString(value)
+			if err != nil {
+				return "", fmt.Errorf("the value is not valid base64")
+			}
+			return string(decoded), nil
+		},
+	},
+	"json": {
+		apply: func(value string, _ []string) (string, error) {
+			return quoteJSON(value)
+		},
+	},
+	"yaml": {
+		apply: func(value string, _ []string) (string, error) {
+			return quoteYAML(value)
+		},
+	},
+	"indent": {
+		args: 1,
+		checkArgs: func(args []string) error {
+			_, err := parseIndent(args[0])
+			return err
+		},
+		apply: func(value string, args []string) (string, error) {
+			n, err := parseIndent(args[0])
+			if err != nil {
+				return "", err
+			}
+			prefix := strings.Repeat(" ", n)
+			return prefix + strings.Replace(value, "\n", "\n"+prefix, -1), nil
+		},
+	},
+	"trim": {
+		apply: func(value string, _ []string) (string, error) {
+			return strings.TrimSpace(value), nil
+		},
+	},
+	"upper": {
+		apply: func(value string, _ []string) (string, error) {
+			return strings.ToUpper(value), nil
+		},
+	},
+	"lower": {
+		apply: func(value string, _ []string) (string, error) {
+			return strings.ToLower(value), nil
+		},
+	},
+	"sha256": {
+		apply: func(value string, _ []string) (string, error) {
+			sum := sha256.Sum256([]byte(value))
+			return hex.EncodeToString(sum[:]), nil
+		},
+	},
+	"urlquery": {
+		apply: func(value string, _ []string) (string, error) {
+			return url.QueryEscape(value), nil
+		},
+	},
+}
+
+// functionNames returns the names of all functions in alphabetical order.
+func functionNames() []string {
+	names := make([]string, 0, len(functions))
+	for name := range functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// quoteJSON returns the value as a JSON string, including the surrounding quotes.
+func quoteJSON(value string) (string, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	err := encoder.Encode(value)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// quoteYAML returns the value as a YAML scalar, which is quoted when needed.
+// Values that span multiple lines are double-quoted instead of written as a block
+// scalar, so that the result can be used anywhere a scalar is expected.
+func quoteYAML(value string) (string, error) {
+	if strings.ContainsAny(value, "\r\n") {
+		// A JSON string is also a valid double-quoted YAML string.
+		return quoteJSON(value)
+	}
+
+	raw, err := yaml.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(raw), "\n"), nil
+}
+
+// parseIndent parses the number of spaces to indent with.
+func parseIndent(arg string) (int, error) {
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("the number of spaces must be a non-negative integer")
+	}
+	return n, nil
+}
+
+// functionCall is the application of a function in a pipeline.
+type functionCall struct {
+	name string
+	args []string
+}
+
+// apply applies the function to the value of the secret at the given path.
+func (c functionCall) apply(path string, value string) (string, error) {
+	fn, ok := functions[c.name]
+	if !ok {
+		// This cannot happen for parsed templates, as unknown functions are rejected when parsing.
+		return "", ErrFunctionFailed(c.name, path, "unknown function")
+	}
+
+	res, err := fn.apply(value, c.args)
+	if err != nil {
+		return "", ErrFunctionFailed(c.name, path, err)
+	}
+	return res, nil
+}
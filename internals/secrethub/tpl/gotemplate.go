@@ -0,0 +1,162 @@
+package tpl
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// Go template errors
+var (
+	ErrGoTemplateSyntax = tplError.Code("gotemplate_syntax_error").ErrorPref("template syntax error: %s")
+	ErrGoTemplateFailed = tplError.Code("gotemplate_execution_failed").ErrorPref("cannot render template: %s")
+)
+
+// goTemplateName is the name given to Go templates. It is stripped from the errors of the engine.
+const goTemplateName = "template"
+
+// NewGoTemplateParser returns a parser for templates written in the syntax of Go's text/template package.
+//
+// Secrets are read with the secret function, e.g. {{ secret "path/to/secret" }}, and template
+// variables with the var function, e.g. {{ var "env" }}. The names of the secrets in a directory
+// are listed with the ls function. The functions that can be used in pipelines of v2 templates
+// are available as well, together with default and replace. The template has no access to the
+// environment or the filesystem.
+func NewGoTemplateParser() Parser {
+	return goTemplateParser{}
+}
+
+type goTemplateParser struct{}
+
+// Parse parses a Go template. As Go templates are always parsed as a whole,
+// the given line and column are ignored.
+func (p goTemplateParser) Parse(raw string, line, column int) (Template, error) {
+	t, err := template.New(goTemplateName).
+		Option("missingkey=error").
+		Funcs(goTemplateFuncs(nil, nil, nil)).
+		Parse(raw)
+	if err != nil {
+		return nil, ErrGoTemplateSyntax(goTemplateErrorMessage(err))
+	}
+	return goTemplate{template: t}, nil
+}
+
+type goTemplate struct {
+	template *template.Template
+}
+
+// Evaluate renders the template, reading secrets with the secret reader and
+// template variables with the variable reader.
+func (t goTemplate) Evaluate(varReader VariableReader, sr SecretReader) (string, error) {
+	// Errors returned by the secret and variable readers are returned as is,
+	// instead of being wrapped in an error of the template engine.
+	var readErr readError
+
+	clone, err := t.template.Clone()
+	if err != nil {
+		return "", ErrGoTemplateFailed(goTemplateErrorMessage(err))
+	}
+	clone.Funcs(goTemplateFuncs(varReader, sr, &readErr))
+
+	var buf bytes.Buffer
+	err = clone.Execute(&buf, nil)
+	if err != nil {
+		if readErr.get() != nil {
+			return "", readErr.get()
+		}
+		return "", ErrGoTemplateFailed(goTemplateErrorMessage(err))
+	}
+	return buf.String(), nil
+}
+
+// readError stores the first error returned by a secret or variable reader.
+type readError struct {
+	mutex sync.Mutex
+	err   error
+}
+
+func (e *readError) set(err error) error {
+	if e == nil || err == nil {
+		return err
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.err == nil {
+		e.err = err
+	}
+	return err
+}
+
+func (e *readError) get() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.err
+}
+
+// goTemplateFuncs returns the functions that can be used in Go templates. The secret,
+// var and ls functions use the given readers and store their errors in readErr.
+func goTemplateFuncs(varReader VariableReader, sr SecretReader, readErr *readError) template.FuncMap {
+	funcs := template.FuncMap{
+		"secret": func(path string) (string, error) {
+			secret, err := sr.ReadSecret(path)
+			return secret, readErr.set(err)
+		},
+		"var": func(name string) (string, error) {
+			value, err := varReader.ReadVariable(strings.ToLower(name))
+			return value, readErr.set(err)
+		},
+		"ls": func(dirPath string) ([]string, error) {
+			names, err := ListSecrets(sr, dirPath)
+			return names, readErr.set(err)
+		},
+		"default": func(defaultValue string, value string) string {
+			if value == "" {
+				return defaultValue
+			}
+			return value
+		},
+		"replace": func(old string, new string, value string) string {
+			return strings.Replace(value, old, new, -1)
+		},
+	}
+
+	for name, fn := range functions {
+		funcs[name] = goTemplateFunc(name, fn)
+	}
+	return funcs
+}
+
+// goTemplateFunc converts a pipeline function to a function that can be used in Go templates.
+// The arguments of the function come first and the value it is applied to comes last, so that
+// the function can be used in pipelines, e.g. {{ secret "path/to/secret" | indent 4 }}.
+func goTemplateFunc(name string, fn function) func(args ...interface{}) (string, error) {
+	return func(args ...interface{}) (string, error) {
+		if len(args) != fn.args+1 {
+			return "", fmt.Errorf("function '%s' takes %d argument(s), but %d were given", name, fn.args, len(args)-1)
+		}
+
+		strArgs := make([]string, fn.args)
+		for i := range strArgs {
+			strArgs[i] = fmt.Sprint(args[i])
+		}
+
+		if fn.checkArgs != nil {
+			err := fn.checkArgs(strArgs)
+			if err != nil {
+				return "", err
+			}
+		}
+
+		return fn.apply(fmt.Sprint(args[fn.args]), strArgs)
+	}
+}
+
+// goTemplateErrorMessage returns the message of an error returned by the template engine
+// without the name of the template it is prefixed with.
+func goTemplateErrorMessage(err error) string {
+	msg := strings.TrimPrefix(err.Error(), "template: ")
+	return strings.TrimPrefix(msg, goTemplateName+":")
+}
@@ -0,0 +1,93 @@
+package tpl
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/secrethub/secrethub-cli/internals/secrethub/tpl/fakes"
+
+	"github.com/secrethub/secrethub-go/internals/assert"
+)
+
+func TestGoTemplate(t *testing.T) {
+	cases := map[string]struct {
+		raw      string
+		vars     map[string]string
+		secrets  map[string]string
+		expected string
+		parseErr error
+		err      error
+	}{
+		"secret and variable": {
+			raw:      `{{ var "env" }}: {{ secret "company/app/db" }}`,
+			vars:     map[string]string{"env": "prd"},
+			secrets:  map[string]string{"company/app/db": "password"},
+			expected: "prd: password",
+		},
+		"logic": {
+			raw: `{{ if eq (var "env") "prd" }}{{ secret (printf "company/%s/db" (var "env")) }}{{ else }}localhost{{ end }}`,
+			vars: map[string]string{
+				"env": "prd",
+			},
+			secrets: map[string]string{
+				"company/prd/db": "db.example.com",
+			},
+			expected: "db.example.com",
+		},
+		"functions": {
+			raw: "key:\n{{ secret \"company/app/key\" | indent 2 }}\n" +
+				`token: {{ secret "company/app/token" | trim | base64 }}` + "\n" +
+				`name: {{ var "name" | default "app" | upper | replace "P" "B" }}`,
+			vars: map[string]string{
+				"name": "",
+			},
+			secrets: map[string]string{
+				"company/app/key":   "a\nb",
+				"company/app/token": " token ",
+			},
+			expected: "key:\n  a\n  b\ntoken: dG9rZW4=\nname: ABB",
+		},
+		"range": {
+			raw: `{{ range ls "company/app" }}{{ . }}={{ secret (printf "company/app/%s" .) }};{{ end }}`,
+			secrets: map[string]string{
+				"company/app/a": "1",
+				"company/app/b": "2",
+			},
+			expected: "a=1;b=2;",
+		},
+		"secret not found": {
+			raw: `{{ secret "company/app/db" }}`,
+			err: errors.New("secret not found"),
+		},
+		"variable not found": {
+			raw: `{{ var "env" }}`,
+			err: errors.New("variable not found: env"),
+		},
+		"invalid function argument": {
+			raw: `{{ "a" | indent -1 }}`,
+			err: ErrGoTemplateFailed(`1:9: executing "template" at <indent -1>: error calling indent: the number of spaces must be a non-negative integer`),
+		},
+		"syntax error": {
+			raw:      `{{ secret "a" }`,
+			parseErr: ErrGoTemplateSyntax(`1: unexpected "}" in operand`),
+		},
+		"unknown function": {
+			raw:      `{{ env "HOME" }}`,
+			parseErr: ErrGoTemplateSyntax(`1: function "env" not defined`),
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			parsed, err := NewGoTemplateParser().Parse(tc.raw, 1, 1)
+			assert.Equal(t, err, tc.parseErr)
+			if tc.parseErr != nil {
+				return
+			}
+
+			actual, err := parsed.Evaluate(fakes.FakeVariableReader{Variables: tc.vars}, fakes.FakeSecretReader{Secrets: tc.secrets})
+			assert.Equal(t, err, tc.err)
+			assert.Equal(t, actual, tc.expected)
+		})
+	}
+}
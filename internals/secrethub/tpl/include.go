@@ -0,0 +1,163 @@
+package tpl
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/secrethub/secrethub-cli/internals/tpl"
+)
+
+// keywordInclude is the keyword of an include tag: {{ include "path/to/partial.tpl" }}
+const keywordInclude = "include"
+
+// FileParser is a Parser for templates that can include other templates.
+// The included templates are read relative to the file the template is read from.
+type FileParser interface {
+	Parser
+	// ForFile returns a parser for the template in the file at the given path.
+	ForFile(path string) Parser
+}
+
+// ForFile returns a parser for the template in the file at the given path, so that
+// templates included in it are read relative to that file. When the parser does not
+// support includes, it is returned as is.
+func ForFile(parser Parser, path string) Parser {
+	fileParser, ok := parser.(FileParser)
+	if !ok {
+		return parser
+	}
+	return fileParser.ForFile(path)
+}
+
+// ForFile implements FileParser.
+func (p parserV2) ForFile(path string) Parser {
+	p.file = path
+	return p
+}
+
+// ForFile implements FileParser.
+func (p parserV3) ForFile(path string) Parser {
+	p.file = path
+	return p
+}
+
+// partial is a template that is included in another template.
+type partial struct {
+	nodes []node
+}
+
+func (p partial) evaluate(ctx context) (string, error) {
+	return evaluateNodes(ctx, p.nodes)
+}
+
+// isIncludeTag returns whether the tag opened at the current position is an include tag.
+// The next character should be the last character of the opening delimiter ('{').
+func (p *v2Parser) isIncludeTag() bool {
+	rest := bytes.TrimLeft(p.buf.Bytes(), " \t")
+	if !bytes.HasPrefix(rest, []byte(keywordInclude)) {
+		return false
+	}
+
+	rest = rest[len(keywordInclude):]
+	arg := bytes.TrimLeft(rest, " \t")
+	return len(arg) < len(rest) && len(arg) > 0 && arg[0] == '"'
+}
+
+// parseInclude parses an include tag and the template it includes. The current character
+// should be the first character of the opening delimiter ('{') when parseInclude is called.
+//
+// When parseInclude returns, the next character in the buffer is the last character
+// of the closing delimiter of the tag ('}').
+func (p *v2Parser) parseInclude() (node, error) {
+	lineNo, columnNo := p.lineNo, p.columnNo
+
+	checkError := func(err error) error {
+		if err == io.EOF {
+			return ErrSecretTagNotClosed(p.lineNo, p.columnNo+1)
+		}
+		return err
+	}
+
+	err := p.readRune()
+	if err != nil {
+		return nil, checkError(err)
+	}
+
+	err = p.skipWhiteSpace()
+	if err != nil {
+		return nil, checkError(err)
+	}
+
+	for range keywordInclude {
+		err = p.readRune()
+		if err != nil {
+			return nil, checkError(err)
+		}
+	}
+
+	err = p.skipWhiteSpace()
+	if err != nil {
+		return nil, checkError(err)
+	}
+
+	path, err := p.parseString()
+	if err != nil {
+		return nil, checkError(err)
+	}
+
+	err = p.skipWhiteSpace()
+	if err != nil {
+		return nil, checkError(err)
+	}
+
+	err = p.parseClosingDelimiter()
+	if err != nil {
+		return nil, checkError(err)
+	}
+
+	return p.include(path, lineNo, columnNo)
+}
+
+// include parses the template in the file at the given path, relative to the directory
+// of the including template. The references in the included template are recorded at
+// the position of the include tag, so that they point to the file that is parsed.
+func (p *v2Parser) include(path string, lineNo, columnNo int) (node, error) {
+	includer := p.includer
+	if includer.File() == "" {
+		includer = tpl.NewIncluder(p.file)
+	}
+
+	included, ok := includer.Include(path)
+	if !ok {
+		return nil, ErrIncludeCycle(lineNo, columnNo, included.File())
+	}
+	path = included.File()
+
+	raw, err := included.Read()
+	if err != nil {
+		return nil, ErrCannotInclude(lineNo, columnNo, path, err)
+	}
+
+	parser := newV2Parser(bytes.NewBuffer(raw), 1, 1)
+	parser.blocks = p.blocks
+	parser.file = path
+	parser.includer = included
+	// Range blocks around the include tag set variables in the included template.
+	parser.scopes = append([][]string{}, p.scopes...)
+
+	nodes, err := parser.parse()
+	if err == nil && parser.blocks {
+		nodes, err = buildBlocks(trimStandaloneTags(nodes))
+	}
+	if err != nil {
+		return nil, ErrIncludeFailed(lineNo, columnNo, path, err)
+	}
+
+	for _, ref := range parser.refs {
+		ref.LineNo = lineNo
+		ref.ColumnNo = columnNo
+		p.refs = append(p.refs, ref)
+	}
+
+	return partial{nodes: nodes}, nil
+}
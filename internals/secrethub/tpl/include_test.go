@@ -0,0 +1,129 @@
+package tpl
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/secrethub/secrethub-cli/internals/secrethub/tpl/fakes"
+
+	"github.com/secrethub/secrethub-go/internals/assert"
+)
+
+func TestInclude(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrethub-include")
+	assert.OK(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		assert.OK(t, err)
+	}()
+
+	files := map[string]string{
+		"partials/db.tpl":       "host: {{ company/${env}/db/host }}\n{{ include \"port.tpl\" }}\n",
+		"partials/port.tpl":     "port: {{ company/${env}/db/port }}\n",
+		"partials/loop.tpl":     "{{ include \"../loop.tpl\" }}",
+		"partials/invalid.tpl":  "\n{{ company/app/db",
+		"partials/partners.tpl": "{{ company/app/partners/${name} }}",
+		"loop.tpl":              "{{ include \"partials/loop.tpl\" }}",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		err := os.MkdirAll(filepath.Dir(path), 0700)
+		assert.OK(t, err)
+		err = ioutil.WriteFile(path, []byte(content), 0600)
+		assert.OK(t, err)
+	}
+
+	file := filepath.Join(dir, "template")
+
+	cases := map[string]struct {
+		parser   Parser
+		raw      string
+		expected string
+		err      error
+	}{
+		"relative and nested": {
+			parser:   NewV2Parser(),
+			raw:      "env: ${env}\n{{ include \"partials/db.tpl\" }}\n",
+			expected: "env: prd\nhost: db.example.com\nport: 5432\n",
+		},
+		"in range block": {
+			parser:   NewV3Parser(),
+			raw:      "{{ range $name := company/app/partners }}{{ include \"partials/partners.tpl\" }};{{ end }}",
+			expected: "acme;initech;",
+		},
+		"cycle": {
+			parser: NewV2Parser(),
+			raw:    "{{ include \"loop.tpl\" }}",
+			err: ErrIncludeFailed(1, 1, filepath.Join(dir, "loop.tpl"),
+				ErrIncludeFailed(1, 1, filepath.Join(dir, "partials/loop.tpl"),
+					ErrIncludeCycle(1, 1, filepath.Join(dir, "partials/../loop.tpl")))),
+		},
+		"file does not exist": {
+			parser: NewV2Parser(),
+			raw:    "key: {{ include \"partials/missing.tpl\" }}",
+			err:    ErrCannotInclude(1, 6, filepath.Join(dir, "partials/missing.tpl"), errors.New("open "+filepath.Join(dir, "partials/missing.tpl")+": no such file or directory")),
+		},
+		"error in included template": {
+			parser: NewV2Parser(),
+			raw:    "\n  {{ include \"partials/invalid.tpl\" }}",
+			err:    ErrIncludeFailed(2, 3, filepath.Join(dir, "partials/invalid.tpl"), ErrSecretTagNotClosed(2, 18)),
+		},
+		"include not closed": {
+			parser: NewV2Parser(),
+			raw:    "{{ include \"partials/db.tpl\"",
+			err:    ErrSecretTagNotClosed(1, 29),
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			parsed, err := ForFile(tc.parser, file).Parse(tc.raw, 1, 1)
+			assert.Equal(t, err, tc.err)
+			if tc.err != nil {
+				return
+			}
+
+			varReader := fakes.FakeVariableReader{
+				Variables: map[string]string{
+					"env": "prd",
+				},
+			}
+			secretReader := fakes.FakeSecretReader{
+				Secrets: map[string]string{
+					"company/prd/db/host":          "db.example.com",
+					"company/prd/db/port":          "5432",
+					"company/app/partners/acme":    "acme",
+					"company/app/partners/initech": "initech",
+				},
+			}
+			actual, err := parsed.Evaluate(varReader, secretReader)
+			assert.OK(t, err)
+			assert.Equal(t, actual, tc.expected)
+		})
+	}
+}
+
+func TestInclude_References(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrethub-include")
+	assert.OK(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		assert.OK(t, err)
+	}()
+
+	err = ioutil.WriteFile(filepath.Join(dir, "db.tpl"), []byte("{{ company/app/db }}"), 0600)
+	assert.OK(t, err)
+
+	parsed, err := ForFile(NewV2Parser(), filepath.Join(dir, "template")).Parse("key: {{ company/app/key }}\ndb: {{ include \"db.tpl\" }}", 1, 1)
+	assert.OK(t, err)
+
+	refs, ok := References(parsed)
+	assert.Equal(t, ok, true)
+	assert.Equal(t, len(refs), 2)
+	assert.Equal(t, refs[1].Name, "company/app/db")
+	assert.Equal(t, refs[1].LineNo, 2)
+	assert.Equal(t, refs[1].ColumnNo, 5)
+}
@@ -2,10 +2,17 @@ package token
 
 // Tokens
 var (
-	Dollar    = '$'
-	LBracket  = '{'
-	RBracket  = '}'
-	Backslash = '\\'
+	Dollar      = '$'
+	LBracket    = '{'
+	RBracket    = '}'
+	Backslash   = '\\'
+	Pipe        = '|'
+	Quote       = '"'
+	Colon       = ':'
+	Dash        = '-'
+	Equals      = '='
+	Exclamation = '!'
+	Comma       = ','
 
 	tokens = []rune{Dollar, LBracket, RBracket, Backslash}
 )
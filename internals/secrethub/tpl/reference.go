@@ -0,0 +1,177 @@
+package tpl
+
+import (
+	"bytes"
+	"sort"
+)
+
+// Types of references.
+const (
+	ReferenceSecret   = "secret"
+	ReferenceDir      = "dir"
+	ReferenceVariable = "variable"
+)
+
+// Reference is a reference to a secret, a directory or a template variable in a template.
+type Reference struct {
+	// Type is the type of the referenced object: ReferenceSecret, ReferenceDir or ReferenceVariable.
+	Type string
+	// Name is the name of the variable, or the path of the secret or directory in
+	// which the variables are written as ${name}.
+	Name string
+	// Optional is true when the template can be evaluated when the secret does not exist
+	// or the variable is not set, because a fallback or default value is used instead.
+	Optional bool
+	// Dynamic is true when the path contains a variable of a range block, so that it
+	// cannot be resolved without evaluating the template.
+	Dynamic  bool
+	LineNo   int
+	ColumnNo int
+
+	path []node
+}
+
+// referenceLister is implemented by templates that can list their references.
+type referenceLister interface {
+	references() []Reference
+}
+
+// References returns the secrets, directories and variables that are referenced in the template
+// in the order in which they occur. No secrets are read. The second return value is false when the
+// template does not support listing its references.
+func References(t Template) ([]Reference, bool) {
+	lister, ok := t.(referenceLister)
+	if !ok {
+		return nil, false
+	}
+	return lister.references(), true
+}
+
+// Resolve returns the path of the referenced secret or directory with the variables in it
+// replaced. When any of these variables is not set, ok is false. Users are never asked for
+// the values of variables that are not set and no secrets are read.
+func (r Reference) Resolve(varReader VariableReader) (string, bool, error) {
+	var buffer bytes.Buffer
+	for _, n := range r.path {
+		v, isVariable := n.(variable)
+		if !isVariable {
+			buffer.WriteRune(rune(n.(character)))
+			continue
+		}
+
+		value, ok, err := LookupVariable(varReader, v.key)
+		if err != nil {
+			return "", false, err
+		}
+		if !ok && v.defaultValue == nil {
+			return "", false, nil
+		}
+		if !ok {
+			value = *v.defaultValue
+		}
+		buffer.WriteString(value)
+	}
+	return buffer.String(), true, nil
+}
+
+// formatPath returns the given path nodes as they are written in a template.
+func formatPath(path []node) string {
+	var buffer bytes.Buffer
+	for _, n := range path {
+		switch n := n.(type) {
+		case character:
+			buffer.WriteRune(rune(n))
+		case variable:
+			buffer.WriteString("${" + n.key)
+			if n.defaultValue != nil {
+				buffer.WriteString(":-" + *n.defaultValue)
+			}
+			buffer.WriteString("}")
+		}
+	}
+	return buffer.String()
+}
+
+// addVariableRef records a reference to the given variable node at the given position,
+// unless it is a variable of a range block. The reference is optional when the variable
+// has a default value or when optional is true.
+func (p *v2Parser) addVariableRef(n node, optional bool, lineNo, columnNo int) {
+	v, ok := n.(variable)
+	if !ok || p.isRangeVariable(v.key) {
+		return
+	}
+
+	p.refs = append(p.refs, Reference{
+		Type:     ReferenceVariable,
+		Name:     v.key,
+		Optional: optional || v.defaultValue != nil,
+		LineNo:   lineNo,
+		ColumnNo: columnNo,
+	})
+}
+
+// addPathRef records a reference of the given type to the secret or directory
+// with the given path at the given position.
+func (p *v2Parser) addPathRef(refType string, path []node, optional bool, lineNo, columnNo int) {
+	dynamic := false
+	for _, n := range path {
+		v, ok := n.(variable)
+		if ok && p.isRangeVariable(v.key) {
+			dynamic = true
+		}
+	}
+
+	p.refs = append(p.refs, Reference{
+		Type:     refType,
+		Name:     formatPath(path),
+		Optional: optional,
+		Dynamic:  dynamic,
+		LineNo:   lineNo,
+		ColumnNo: columnNo,
+		path:     path,
+	})
+}
+
+// position is a position in a template.
+type position struct {
+	lineNo   int
+	columnNo int
+}
+
+// addSecretRefs records references to the secret and its fallbacks at the given positions.
+// All but the last of these are optional when the secret has no default value.
+func (p *v2Parser) addSecretRefs(s secret, positions []position) {
+	paths := append([][]node{s.path}, s.fallbacks...)
+	for i, path := range paths {
+		optional := i < len(paths)-1 || s.defaultValue != nil
+		p.addPathRef(ReferenceSecret, path, optional, positions[i].lineNo, positions[i].columnNo)
+	}
+}
+
+// sortedRefs returns the recorded references in the order in which they occur in the template.
+func (p *v2Parser) sortedRefs() []Reference {
+	sort.SliceStable(p.refs, func(i, j int) bool {
+		if p.refs[i].LineNo != p.refs[j].LineNo {
+			return p.refs[i].LineNo < p.refs[j].LineNo
+		}
+		if p.refs[i].ColumnNo != p.refs[j].ColumnNo {
+			return p.refs[i].ColumnNo < p.refs[j].ColumnNo
+		}
+		// A secret that starts with a variable comes before that variable.
+		return p.refs[i].Type != ReferenceVariable && p.refs[j].Type == ReferenceVariable
+	})
+	return p.refs
+}
+
+// isRangeVariable returns whether the variable with the given name is set by a range
+// block that is open at the current position.
+func (p *v2Parser) isRangeVariable(name string) bool {
+	for _, scope := range p.scopes {
+		for _, v := range scope {
+			if v == name {
+				return true
+			}
+		}
+	}
+	return false
+}
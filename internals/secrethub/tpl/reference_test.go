@@ -0,0 +1,64 @@
+package tpl
+
+import (
+	"testing"
+
+	"github.com/secrethub/secrethub-cli/internals/secrethub/tpl/fakes"
+
+	"github.com/secrethub/secrethub-go/internals/assert"
+)
+
+func TestReferences(t *testing.T) {
+	raw := "db: {{ ${env}/db || company/db || \"localhost\" }}\n" +
+		"{{ if $debug }}\n" +
+		"{{ range $name := company/${app:-app}/partners }}\n" +
+		"${name}: {{ company/app/partners/${name} }}\n" +
+		"{{ end }}\n" +
+		"{{ end }}\n"
+
+	parsed, err := NewV3Parser().Parse(raw, 1, 1)
+	assert.OK(t, err)
+
+	refs, ok := References(parsed)
+	assert.Equal(t, ok, true)
+
+	type ref struct {
+		refType  string
+		name     string
+		optional bool
+		dynamic  bool
+		lineNo   int
+		columnNo int
+	}
+	actual := make([]ref, len(refs))
+	for i, r := range refs {
+		actual[i] = ref{r.Type, r.Name, r.Optional, r.Dynamic, r.LineNo, r.ColumnNo}
+	}
+
+	expected := []ref{
+		{ReferenceSecret, "${env}/db", true, false, 1, 8},
+		{ReferenceVariable, "env", false, false, 1, 8},
+		{ReferenceSecret, "company/db", true, false, 1, 21},
+		{ReferenceVariable, "debug", true, false, 2, 7},
+		{ReferenceDir, "company/${app:-app}/partners", false, false, 3, 19},
+		{ReferenceVariable, "app", true, false, 3, 27},
+		{ReferenceSecret, "company/app/partners/${name}", false, true, 4, 13},
+	}
+	assert.Equal(t, actual, expected)
+
+	varReader := fakes.FakeVariableReader{Variables: map[string]string{"env": "company/prd"}}
+
+	path, ok, err := refs[0].Resolve(varReader)
+	assert.OK(t, err)
+	assert.Equal(t, ok, true)
+	assert.Equal(t, path, "company/prd/db")
+
+	path, ok, err = refs[4].Resolve(varReader)
+	assert.OK(t, err)
+	assert.Equal(t, ok, true)
+	assert.Equal(t, path, "company/app/partners")
+
+	_, ok, err = refs[0].Resolve(fakes.FakeVariableReader{})
+	assert.OK(t, err)
+	assert.Equal(t, ok, false)
+}
@@ -23,9 +23,145 @@ type Template interface {
 	Evaluate(varReader VariableReader, sr SecretReader) (string, error)
 }
 
+// SecretPrefetcher is a SecretReader that can read multiple secrets ahead of time,
+// so that they can be read concurrently instead of one at a time.
+type SecretPrefetcher interface {
+	SecretReader
+	// Prefetch reads the secrets at the given paths, so that subsequent calls
+	// to ReadSecret for these paths do not have to read them again.
+	Prefetch(paths []string) error
+}
+
+// SecretLookupReader is a SecretReader that can tell a secret that does not exist apart
+// from a secret that cannot be read. It is used to fall back to an alternative for
+// secrets that do not exist.
+type SecretLookupReader interface {
+	SecretReader
+	// LookupSecret reads the secret at the given path. When the secret does not
+	// exist, ok is false and no error is returned.
+	LookupSecret(path string) (secret string, ok bool, err error)
+}
+
+// LookupSecret reads the secret at the given path. When the secret reader is a
+// SecretLookupReader, ok is false when the secret does not exist. Otherwise, any
+// error reading the secret is returned.
+func LookupSecret(sr SecretReader, path string) (string, bool, error) {
+	lookupReader, ok := sr.(SecretLookupReader)
+	if ok {
+		return lookupReader.LookupSecret(path)
+	}
+
+	secret, err := sr.ReadSecret(path)
+	if err != nil {
+		return "", false, err
+	}
+	return secret, true, nil
+}
+
+// SecretDirReader is a SecretReader that can list the secrets in a directory.
+// It is used to range over the secrets in a directory.
+type SecretDirReader interface {
+	SecretReader
+	// ListSecrets returns the names of the secrets directly in the directory
+	// at the given path in alphabetical order.
+	ListSecrets(dirPath string) ([]string, error)
+}
+
+// ListSecrets returns the names of the secrets directly in the directory at the given
+// path. An error is returned when the secret reader is not a SecretDirReader.
+func ListSecrets(sr SecretReader, dirPath string) ([]string, error) {
+	dirReader, ok := sr.(SecretDirReader)
+	if !ok {
+		return nil, ErrCannotListSecrets(dirPath)
+	}
+	return dirReader.ListSecrets(dirPath)
+}
+
+// SecretMarker is a SecretReader that marks the values of secrets in the output of a
+// template, e.g. to tell them apart from the rest of the output. Templates call MarkSecret
+// with the value of a secret as it is rendered, after any functions are applied to it,
+// and render the returned string instead.
+type SecretMarker interface {
+	SecretReader
+	// MarkSecret returns the value of the secret at the given path as it is rendered.
+	MarkSecret(path string, value string) string
+}
+
+// markSecret returns the value of the secret at the given path as it is rendered.
+// When the secret reader is not a SecretMarker, the value is returned as is.
+func markSecret(sr SecretReader, path string, value string) string {
+	marker, ok := sr.(SecretMarker)
+	if !ok {
+		return value
+	}
+	return marker.MarkSecret(path, value)
+}
+
+// VariableLookupReader is a VariableReader that can look up a variable without failing
+// or asking for its value when it is not defined. It is used for variables with a default value.
+type VariableLookupReader interface {
+	VariableReader
+	// LookupVariable returns the value of the variable with the given name.
+	// When the variable is not defined, ok is false and no error is returned.
+	LookupVariable(name string) (value string, ok bool, err error)
+}
+
+// LookupVariable returns the value of the variable with the given name. When the variable
+// reader is not a VariableLookupReader, a variable is considered not to be defined when
+// reading it returns ErrTemplateVarNotFound.
+func LookupVariable(varReader VariableReader, name string) (string, bool, error) {
+	lookupReader, ok := varReader.(VariableLookupReader)
+	if ok {
+		return lookupReader.LookupVariable(name)
+	}
+
+	value, err := varReader.ReadVariable(name)
+	if err == ErrTemplateVarNotFound(name) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+// secretLister is implemented by templates that can list the paths of the secrets
+// they use without reading them.
+type secretLister interface {
+	secretPaths(varReader VariableReader) ([]string, error)
+}
+
+// Prefetch reads all secrets used in the given templates ahead of time when the
+// secret reader is a SecretPrefetcher. Otherwise, it does nothing.
+func Prefetch(varReader VariableReader, sr SecretReader, templates ...Template) error {
+	prefetcher, ok := sr.(SecretPrefetcher)
+	if !ok {
+		return nil
+	}
+
+	var paths []string
+	for _, t := range templates {
+		lister, ok := t.(secretLister)
+		if !ok {
+			continue
+		}
+
+		templatePaths, err := lister.secretPaths(varReader)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, templatePaths...)
+	}
+
+	if len(paths) == 0 {
+		return nil
+	}
+	return prefetcher.Prefetch(paths)
+}
+
 // NewParser returns a parser for the latest template syntax.
 func NewParser() Parser {
-	return NewV2Parser()
+	return NewV3Parser()
 }
 
 var v1SecretTag = regexp.MustCompile(`\${[\t ]*[_\-\.a-zA-Z0-9]+/[_\-\.a-zA-Z0-9]+(?:/[_\-\.a-zA-Z0-9]+)+(?::(?:[0-9]{1,9}|latest))?[\t ]*}`)
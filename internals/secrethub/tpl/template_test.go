@@ -1,8 +1,11 @@
 package tpl
 
 import (
+	"sort"
 	"testing"
 
+	"github.com/secrethub/secrethub-cli/internals/secrethub/tpl/fakes"
+
 	"github.com/secrethub/secrethub-go/internals/assert"
 )
 
@@ -57,3 +60,159 @@ func TestIsV1Template(t *testing.T) {
 		})
 	}
 }
+
+func TestIsV3Template(t *testing.T) {
+	cases := map[string]struct {
+		raw      string
+		expected bool
+	}{
+		"if tag": {
+			raw:      "{{ if ${env} }}foo{{ end }}",
+			expected: true,
+		},
+		"range tag": {
+			raw:      "{{range $name := path/to/dir}}${name}{{end}}",
+			expected: true,
+		},
+		"v2 secret": {
+			raw:      "{{ path/to/secret }}",
+			expected: false,
+		},
+		"v2 secret starting with keyword": {
+			raw:      "{{ iffy/repo/secret }}",
+			expected: false,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			actual := IsV3Template([]byte(tc.raw))
+
+			assert.Equal(t, actual, tc.expected)
+		})
+	}
+}
+
+type fakePrefetcher struct {
+	fakes.FakeSecretReader
+	prefetched []string
+}
+
+func (p *fakePrefetcher) Prefetch(paths []string) error {
+	p.prefetched = append(p.prefetched, paths...)
+	return nil
+}
+
+func TestPrefetch(t *testing.T) {
+	cases := map[string]struct {
+		parser   Parser
+		raw      string
+		vars     map[string]string
+		expected []string
+	}{
+		"v1": {
+			parser:   NewV1Parser(),
+			raw:      "${ company/app/db/user } ${ company/app/db/password }",
+			expected: []string{"company/app/db/user", "company/app/db/password"},
+		},
+		"v2 with variables": {
+			parser: NewV2Parser(),
+			raw:    "{{ company/${app}/db/user }} {{ company/${app}/db/password }}",
+			vars: map[string]string{
+				"app": "app",
+			},
+			expected: []string{"company/app/db/user", "company/app/db/password"},
+		},
+		"no secrets": {
+			parser: NewV2Parser(),
+			raw:    "foo",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			template, err := tc.parser.Parse(tc.raw, 1, 1)
+			assert.OK(t, err)
+
+			prefetcher := &fakePrefetcher{}
+			err = Prefetch(fakes.FakeVariableReader{Variables: tc.vars}, prefetcher, template)
+			assert.OK(t, err)
+
+			sort.Strings(prefetcher.prefetched)
+			sort.Strings(tc.expected)
+			assert.Equal(t, prefetcher.prefetched, tc.expected)
+		})
+	}
+}
+
+type fakeMarker struct {
+	fakes.FakeSecretReader
+}
+
+func (m fakeMarker) MarkSecret(path string, value string) string {
+	return "<" + path + "=" + value + ">"
+}
+
+func TestMarkSecret(t *testing.T) {
+	cases := map[string]struct {
+		parser   Parser
+		raw      string
+		expected string
+	}{
+		"v1": {
+			parser:   NewV1Parser(),
+			raw:      "password=${ company/app/password }",
+			expected: "password=<company/app/password=secret>",
+		},
+		"v2": {
+			parser:   NewV2Parser(),
+			raw:      "password={{ company/app/password }}",
+			expected: "password=<company/app/password=secret>",
+		},
+		"functions are applied before marking": {
+			parser:   NewV2Parser(),
+			raw:      "password={{ company/app/password | base64 | upper }}",
+			expected: "password=<company/app/password=C2VJCMV0>",
+		},
+		"fallback": {
+			parser:   NewV2Parser(),
+			raw:      "password={{ company/app/missing || company/app/password }}",
+			expected: "password=<company/app/password=secret>",
+		},
+		"default value is not marked": {
+			parser:   NewV2Parser(),
+			raw:      `password={{ company/app/missing || "default" }}`,
+			expected: "password=default",
+		},
+		"range value": {
+			parser:   NewV3Parser(),
+			raw:      "{{ range $name, $value := company/app }}${name}=${value};{{ end }}",
+			expected: "password=<company/app/password=secret>;",
+		},
+		"range value used in secret path": {
+			parser:   NewV3Parser(),
+			raw:      "{{ range $name, $value := company/app }}{{ company/${value}/password }}{{ end }}",
+			expected: "<company/secret/password=nested>",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			template, err := tc.parser.Parse(tc.raw, 1, 1)
+			assert.OK(t, err)
+
+			sr := fakeMarker{
+				FakeSecretReader: fakes.FakeSecretReader{
+					Secrets: map[string]string{
+						"company/app/password":    "secret",
+						"company/secret/password": "nested",
+					},
+				},
+			}
+
+			actual, err := template.Evaluate(fakes.FakeVariableReader{}, sr)
+			assert.OK(t, err)
+			assert.Equal(t, actual, tc.expected)
+		})
+	}
+}
@@ -36,6 +36,11 @@ func (p parserV1) Parse(raw string, _, _ int) (Template, error) {
 // InjectVars takes a map of template variables with their corresponding values. It replaces
 // the template variables with their values in the template.
 func (t templateV1) Evaluate(_ VariableReader, sr SecretReader) (string, error) {
+	err := Prefetch(nil, sr, t)
+	if err != nil {
+		return "", err
+	}
+
 	keys := t.template.Keys()
 	secrets := make(map[string]string, len(keys))
 	for _, path := range keys {
@@ -43,8 +48,13 @@ func (t templateV1) Evaluate(_ VariableReader, sr SecretReader) (string, error)
 		if err != nil {
 			return "", err
 		}
-		secrets[path] = secret
+		secrets[path] = markSecret(sr, path, secret)
 	}
 
 	return t.template.Inject(secrets)
 }
+
+// secretPaths implements secretLister.
+func (t templateV1) secretPaths(_ VariableReader) ([]string, error) {
+	return t.template.Keys(), nil
+}
@@ -7,6 +7,7 @@ import (
 	"unicode"
 
 	"github.com/secrethub/secrethub-cli/internals/secrethub/tpl/internal/token"
+	"github.com/secrethub/secrethub-cli/internals/tpl"
 )
 
 // NewV2Parser returns a parser for the v2 template syntax.
@@ -23,6 +24,23 @@ import (
 // Spaces directly after opening delimiters (`{{` and `${`) and directly
 // before closing delimiters (`}}`, `}`) are ignored. They are not
 // included in the secret pahts and variable names.
+//
+// Variables can have a default value that is used when the variable
+// is not set, given after `:-`:
+// {{ ${app:-company/app}/db/secret }}
+//
+// Secrets can have fallbacks that are used when the secret does not
+// exist, separated by `||`. The last fallback can be a default value
+// between double quotes:
+// {{ ${env}/db/host || company/app/db/host || "localhost" }}
+//
+// The value of a secret can be passed through a pipeline of functions,
+// separated by `|`. Arguments of a function are separated by spaces.
+// For example:
+// {{ path/to/cert | base64 | indent 4 }}
+//
+// Other templates can be included, relative to the including template:
+// {{ include "partials/db.tpl" }}
 func NewV2Parser() Parser {
 	return parserV2{}
 }
@@ -42,11 +60,86 @@ type node interface {
 
 type secret struct {
 	path []node
+	// fallbacks contains the paths of the secrets that are used, in order,
+	// when the secret does not exist.
+	fallbacks [][]node
+	// defaultValue is used when neither the secret nor any of its fallbacks exist.
+	defaultValue *string
+	pipeline     []functionCall
 }
 
 func (s secret) evaluate(ctx context) (string, error) {
+	path, res, found, err := s.read(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	for _, call := range s.pipeline {
+		res, err = call.apply(path, res)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if !found {
+		return res, nil
+	}
+	return markSecret(ctx.secretReader, path, res), nil
+}
+
+// read returns the value of the first of the secret and its fallbacks that exists,
+// together with its path. If none of them exist, the default value is returned
+// when it is set and found is false.
+func (s secret) read(ctx context) (path string, value string, found bool, err error) {
+	path, err = evaluatePath(ctx, s.path)
+	if err != nil {
+		return "", "", false, err
+	}
+
+	if !s.hasFallback() {
+		res, err := ctx.secret(path)
+		return path, res, err == nil, err
+	}
+
+	paths := append([][]node{s.path}, s.fallbacks...)
+	for i, p := range paths {
+		fallbackPath, err := evaluatePath(ctx, p)
+		if err != nil {
+			return "", "", false, err
+		}
+
+		// The last secret is read as usual when it has no default value,
+		// so that an error is returned when it does not exist.
+		if i == len(paths)-1 && s.defaultValue == nil {
+			res, err := ctx.secret(fallbackPath)
+			return fallbackPath, res, err == nil, err
+		}
+
+		res, ok, err := LookupSecret(ctx.secretReader, fallbackPath)
+		if err != nil {
+			return "", "", false, err
+		}
+		if ok {
+			return fallbackPath, res, true, nil
+		}
+	}
+	return path, *s.defaultValue, false, nil
+}
+
+// hasFallback returns whether the secret has a fallback or a default value.
+func (s secret) hasFallback() bool {
+	return len(s.fallbacks) > 0 || s.defaultValue != nil
+}
+
+// evaluatePath returns the path of the secret, with all variables in it replaced.
+func (s secret) evaluatePath(ctx context) (string, error) {
+	return evaluatePath(ctx, s.path)
+}
+
+// evaluatePath returns the path consisting of the given nodes, with all variables in it replaced.
+func evaluatePath(ctx context, path []node) (string, error) {
 	var buffer bytes.Buffer
-	for _, p := range s.path {
+	for _, p := range path {
 		eval, err := p.evaluate(ctx)
 		if err != nil {
 			return "", err
@@ -54,14 +147,27 @@ func (s secret) evaluate(ctx context) (string, error) {
 
 		buffer.WriteString(eval)
 	}
-	return ctx.secret(buffer.String())
+	return buffer.String(), nil
 }
 
 type variable struct {
 	key string
+	// defaultValue is used when the variable is not set.
+	defaultValue *string
 }
 
 func (v variable) evaluate(ctx context) (string, error) {
+	if v.defaultValue != nil {
+		res, ok, err := LookupVariable(ctx.varReader, v.key)
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			return *v.defaultValue, nil
+		}
+		return res, nil
+	}
+
 	res, err := ctx.varReader.ReadVariable(v.key)
 	if err != nil {
 		return "", err
@@ -77,9 +183,13 @@ func (c character) evaluate(ctx context) (string, error) {
 
 type templateV2 struct {
 	nodes []node
+	refs  []Reference
 }
 
-type parserV2 struct{}
+type parserV2 struct {
+	// file is the path of the file the template is read from.
+	file string
+}
 
 // Parse parses a secret template from a raw string.
 //
@@ -95,8 +205,19 @@ type parserV2 struct{}
 // - Variable tags cannot contain secret tags.
 // - Secret tags cannot contain secret tags (they cannot be nested).
 // - Variable tags cannot contain variable tags (they cannot be nested).
+// - A variable tag can have a default value that is used when the variable is not
+//   set: `${ variable:-default }`.
+// - A secret tag can have fallbacks that are used when the secret does not exist:
+//   `{{ path/to/secret || path/to/fallback || "default" }}`. A default value between
+//   double quotes can only be the last fallback.
+// - The value of a secret tag can be passed through functions, separated by a pipe:
+//   `{{ path/to/secret | base64 | indent 4 }}`. Functions are applied from left to right.
+// - Another template can be included with an include tag: `{{ include "path/to/partial.tpl" }}`.
+//   Relative paths are relative to the directory of the including template. The newline at
+//   the end of the included file is not included.
 func (p parserV2) Parse(raw string, line, column int) (Template, error) {
 	parser := newV2Parser(bytes.NewBufferString(raw), line, column)
+	parser.file = p.file
 
 	nodes, err := parser.parse()
 	if err != nil {
@@ -105,6 +226,7 @@ func (p parserV2) Parse(raw string, line, column int) (Template, error) {
 
 	return templateV2{
 		nodes: nodes,
+		refs:  parser.sortedRefs(),
 	}, nil
 }
 
@@ -123,6 +245,20 @@ type v2Parser struct {
 	buf      *bytes.Buffer
 	lineNo   int
 	columnNo int
+	// blocks enables the block tags of the v3 syntax.
+	blocks bool
+	// file is the path of the file the template is read from. Included templates are read
+	// relative to its directory. It is empty when the template is not read from a file.
+	file string
+	// includer reads the templates included in this template when it is included
+	// in another template itself.
+	includer tpl.Includer
+
+	// refs contains the references in the template that have been parsed.
+	refs []Reference
+	// scopes contains the variables set by the blocks that are open at the current
+	// position. Only range blocks set variables.
+	scopes [][]string
 
 	current rune
 	next    rune
@@ -181,15 +317,39 @@ func (p *v2Parser) parse() ([]node, error) {
 // the current character is the last processed character.
 func (p *v2Parser) parseRoot() (node, error) {
 	if p.current == token.Dollar && p.next == token.LBracket {
+		lineNo, columnNo := p.lineNo, p.columnNo
 		variable, err := p.parseVar()
 		if err != nil {
 			return nil, err
 		}
+		p.addVariableRef(variable, false, lineNo, columnNo)
 		return variable, p.readRune()
 	}
 
 	if p.current == token.Dollar && p.isVariableStartRune(p.next) {
-		return p.parseVarWithoutBrackets()
+		lineNo, columnNo := p.lineNo, p.columnNo
+		variable, err := p.parseVarWithoutBrackets()
+		p.addVariableRef(variable, false, lineNo, columnNo)
+		return variable, err
+	}
+
+	if p.current == token.LBracket && p.next == token.LBracket && p.isIncludeTag() {
+		partial, err := p.parseInclude()
+		if err != nil {
+			return nil, err
+		}
+		return partial, p.readRune()
+	}
+
+	if p.current == token.LBracket && p.next == token.LBracket && p.blocks {
+		keyword := p.peekKeyword()
+		if keyword != "" {
+			tag, err := p.parseBlockTag(keyword)
+			if err != nil {
+				return nil, err
+			}
+			return tag, p.readRune()
+		}
 	}
 
 	if p.current == token.LBracket && p.next == token.LBracket {
@@ -289,10 +449,57 @@ func (p *v2Parser) parseVar() (node, error) {
 			continue
 		}
 
+		if p.next == token.Colon && buffer.Len() > 0 {
+			defaultValue, err := p.parseVarDefault()
+			if err != nil {
+				return nil, checkError(err)
+			}
+
+			return variable{
+				key:          strings.ToLower(buffer.String()),
+				defaultValue: &defaultValue,
+			}, nil
+		}
+
 		return nil, ErrIllegalVariableCharacter(p.lineNo, p.columnNo+1, p.next)
 	}
 }
 
+// parseVarDefault parses the default value of a template variable up to the closing
+// delimiter. The next character should be the colon of the `:-` separator when
+// parseVarDefault is called.
+//
+// When parseVarDefault returns, the next character in the buffer is the closing
+// delimiter of the template variable ('}'). Spaces around the default value are ignored.
+func (p *v2Parser) parseVarDefault() (string, error) {
+	var buffer bytes.Buffer
+
+	err := p.readRune()
+	if err != nil {
+		return "", err
+	}
+
+	if p.next != token.Dash {
+		return "", ErrUnexpectedCharacter(p.lineNo, p.columnNo+1, p.next, token.Dash)
+	}
+
+	err = p.readRune()
+	if err != nil {
+		return "", err
+	}
+
+	for p.next != token.RBracket {
+		buffer.WriteRune(p.next)
+
+		err := p.readRune()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return strings.TrimFunc(buffer.String(), p.isAllowedWhiteSpace), nil
+}
+
 // parseSecret parses the contents of a secret tag up to the closing delimiter.
 // The next character should be the last character of the opening delimiter ('{')
 // when parseSecret is called.
@@ -300,8 +507,6 @@ func (p *v2Parser) parseVar() (node, error) {
 // When parseSecret returns, the next character in the buffer is the last character
 // of the closing delimiter of the secret tag ('}').
 func (p *v2Parser) parseSecret() (node, error) {
-	path := []node{}
-
 	checkError := func(err error) error {
 		if err == io.EOF {
 			return ErrSecretTagNotClosed(p.lineNo, p.columnNo+1)
@@ -319,24 +524,119 @@ func (p *v2Parser) parseSecret() (node, error) {
 		return nil, checkError(err)
 	}
 
-	for {
+	positions := []position{{p.lineNo, p.columnNo + 1}}
+	path, err := p.parseSecretPath()
+	if err != nil {
+		return nil, checkError(err)
+	}
+
+	if len(path) == 0 && p.next == token.Pipe {
+		return nil, ErrIllegalSecretCharacter(p.lineNo, p.columnNo+1, p.next)
+	}
+
+	res := secret{
+		path: path,
+	}
+
+	for p.next == token.Pipe {
 		err = p.readRune()
 		if err != nil {
 			return nil, checkError(err)
 		}
 
-		if p.current == token.Dollar {
+		if p.next != token.Pipe {
+			res.pipeline, err = p.parsePipeline()
+			if err != nil {
+				return nil, checkError(err)
+			}
+			p.addSecretRefs(res, positions)
+			return res, nil
+		}
+
+		if res.defaultValue != nil {
+			return nil, ErrUnexpectedCharacter(p.lineNo, p.columnNo+1, p.next, token.RBracket)
+		}
+
+		err = p.readRune()
+		if err != nil {
+			return nil, checkError(err)
+		}
+
+		err = p.skipWhiteSpace()
+		if err != nil {
+			return nil, checkError(err)
+		}
+
+		if p.next == token.Quote {
+			defaultValue, err := p.parseString()
+			if err != nil {
+				return nil, checkError(err)
+			}
+			res.defaultValue = &defaultValue
+
+			err = p.skipWhiteSpace()
+			if err != nil {
+				return nil, checkError(err)
+			}
+			continue
+		}
+
+		positions = append(positions, position{p.lineNo, p.columnNo + 1})
+		fallback, err := p.parseSecretPath()
+		if err != nil {
+			return nil, checkError(err)
+		}
+		if len(fallback) == 0 {
+			return nil, ErrIllegalSecretCharacter(p.lineNo, p.columnNo+1, p.next)
+		}
+		res.fallbacks = append(res.fallbacks, fallback)
+	}
+
+	if p.next != token.RBracket {
+		return nil, ErrUnexpectedCharacter(p.lineNo, p.columnNo+1, p.next, token.RBracket)
+	}
+
+	err = p.readRune()
+	if err != nil {
+		return nil, checkError(err)
+	}
+
+	if p.next != token.RBracket {
+		return nil, ErrUnexpectedCharacter(p.lineNo, p.columnNo+1, p.next, token.RBracket)
+	}
+
+	p.addSecretRefs(res, positions)
+	return res, nil
+}
+
+// parseSecretPath parses a secret path in a secret tag. The next character should be
+// the first character of the path when parseSecretPath is called.
+//
+// When parseSecretPath returns, the whitespace after the path is skipped and the next
+// character in the buffer is the first character after the path.
+func (p *v2Parser) parseSecretPath() ([]node, error) {
+	path := []node{}
+
+	for {
+		if p.next == token.Dollar {
+			err := p.readRune()
+			if err != nil {
+				return nil, err
+			}
+
+			lineNo, columnNo := p.lineNo, p.columnNo
 			if p.next == token.LBracket {
 				variable, err := p.parseVar()
 				if err != nil {
 					return nil, err
 				}
 
+				p.addVariableRef(variable, false, lineNo, columnNo)
 				path = append(path, variable)
 
 				err = p.readRune()
 				if err != nil {
-					return nil, checkError(err)
+					return nil, err
 				}
 
 				continue
@@ -344,8 +644,9 @@ func (p *v2Parser) parseSecret() (node, error) {
 			if p.isVariableStartRune(p.next) {
 				variable, err := p.parseVarWithoutBrackets()
 				if err != nil {
-					return nil, checkError(err)
+					return nil, err
 				}
+				p.addVariableRef(variable, false, lineNo, columnNo)
 				path = append(path, variable)
 
 				continue
@@ -354,52 +655,168 @@ func (p *v2Parser) parseSecret() (node, error) {
 			return nil, ErrIllegalSecretCharacter(p.lineNo, p.columnNo, p.current)
 		}
 
-		if p.isAllowedWhiteSpace(p.current) {
-			err := p.skipWhiteSpace()
+		if p.isSecretPathRune(p.next) {
+			err := p.readRune()
 			if err != nil {
-				return nil, checkError(err)
+				return nil, err
 			}
 
-			if p.next != token.RBracket {
-				return nil, ErrUnexpectedCharacter(p.lineNo, p.columnNo+1, p.next, token.RBracket)
+			path = append(path, character(p.current))
+			continue
+		}
+
+		break
+	}
+
+	if p.isAllowedWhiteSpace(p.next) {
+		return path, p.skipWhiteSpace()
+	}
+
+	if p.next == token.Pipe || p.next == token.RBracket {
+		return path, nil
+	}
+
+	return nil, ErrIllegalSecretCharacter(p.lineNo, p.columnNo+1, p.next)
+}
+
+// parseString parses a string between double quotes. Within the string, a double
+// quote or a backslash can be escaped with a backslash. The next character should
+// be the opening quote when parseString is called.
+//
+// When parseString returns, the current character is the closing quote.
+func (p *v2Parser) parseString() (string, error) {
+	var buffer bytes.Buffer
+
+	err := p.readRune()
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		err := p.readRune()
+		if err != nil {
+			return "", err
+		}
+
+		if p.current == token.Quote {
+			return buffer.String(), nil
+		}
+
+		if p.current == token.Backslash && (p.next == token.Quote || p.next == token.Backslash) {
+			err := p.readRune()
+			if err != nil {
+				return "", err
 			}
+		}
 
-			err = p.readRune()
+		buffer.WriteRune(p.current)
+	}
+}
+
+// parsePipeline parses the functions applied to a secret up to the closing delimiter
+// of the secret tag. The current character should be the first pipe ('|') when
+// parsePipeline is called.
+//
+// When parsePipeline returns, the next character in the buffer is the last character
+// of the closing delimiter of the secret tag ('}').
+func (p *v2Parser) parsePipeline() ([]functionCall, error) {
+	var pipeline []functionCall
+
+	for {
+		err := p.skipWhiteSpace()
+		if err != nil {
+			return nil, err
+		}
+
+		lineNo, columnNo := p.lineNo, p.columnNo+1
+
+		var name bytes.Buffer
+		for p.isVariableRune(p.next) {
+			name.WriteRune(p.next)
+
+			err := p.readRune()
 			if err != nil {
-				return nil, checkError(err)
+				return nil, err
 			}
+		}
 
-			if p.next != token.RBracket {
-				return nil, ErrUnexpectedCharacter(p.lineNo, p.columnNo+1, p.next, token.RBracket)
+		if name.Len() == 0 {
+			return nil, ErrIllegalFunctionCharacter(p.lineNo, p.columnNo+1, p.next)
+		}
+		if !p.isAllowedWhiteSpace(p.next) && p.next != token.Pipe && p.next != token.RBracket {
+			return nil, ErrIllegalFunctionCharacter(p.lineNo, p.columnNo+1, p.next)
+		}
+
+		var args []string
+		for {
+			err := p.skipWhiteSpace()
+			if err != nil {
+				return nil, err
 			}
 
-			return secret{
-				path: path,
-			}, nil
+			if p.next == token.Pipe || p.next == token.RBracket {
+				break
+			}
+
+			var arg bytes.Buffer
+			for p.isFunctionArgumentRune(p.next) {
+				arg.WriteRune(p.next)
+
+				err := p.readRune()
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			if arg.Len() == 0 {
+				return nil, ErrUnexpectedCharacter(p.lineNo, p.columnNo+1, p.next, token.RBracket)
+			}
+			args = append(args, arg.String())
 		}
 
-		if p.current == token.RBracket {
-			if p.next == token.RBracket {
-				return secret{
-					path: path,
-				}, nil
+		fn, ok := functions[name.String()]
+		if !ok {
+			return nil, ErrUnknownFunction(lineNo, columnNo, name.String())
+		}
+		if len(args) != fn.args {
+			return nil, ErrWrongNumberOfArguments(lineNo, columnNo, name.String(), fn.args, len(args))
+		}
+		if fn.checkArgs != nil {
+			err := fn.checkArgs(args)
+			if err != nil {
+				return nil, ErrInvalidFunctionArgument(lineNo, columnNo, name.String(), strings.Join(args, " "), err)
 			}
-			return nil, ErrUnexpectedCharacter(p.lineNo, p.columnNo+1, p.next, token.RBracket)
 		}
 
-		if p.isSecretPathRune(p.current) {
-			path = append(path, character(p.current))
-			continue
+		pipeline = append(pipeline, functionCall{
+			name: name.String(),
+			args: args,
+		})
+
+		err = p.readRune()
+		if err != nil {
+			return nil, err
 		}
 
-		return nil, ErrIllegalSecretCharacter(p.lineNo, p.columnNo, p.current)
+		if p.current == token.RBracket {
+			if p.next != token.RBracket {
+				return nil, ErrUnexpectedCharacter(p.lineNo, p.columnNo+1, p.next, token.RBracket)
+			}
+			return pipeline, nil
+		}
 	}
 }
 
+// isFunctionArgumentRune returns whether the given rune is allowed to be used in
+// an argument of a function.
+func (p v2Parser) isFunctionArgumentRune(r rune) bool {
+	return unicode.IsPrint(r) && !unicode.IsSpace(r) && r != token.Pipe && r != token.RBracket
+}
+
 // isSecretPathRune returns whether the given rune is allowed to be used in
 // a secret path.
 func (p v2Parser) isSecretPathRune(r rune) bool {
-	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-' || r == '.' || r == '/' || r == ':'
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-' || r == '.' || r == '/' || r == ':' || r == '#'
 }
 
 // isVariableRune returns whether the given rune is allowed to be used in a template variable key.
@@ -442,20 +859,90 @@ type VariableReader interface {
 // Evaluate renders a template. It replaces all variable- and secret tags in the template.
 // The supplied variables should have lowercase keys.
 func (t templateV2) Evaluate(varReader VariableReader, sr SecretReader) (string, error) {
+	err := Prefetch(varReader, sr, t)
+	if err != nil {
+		return "", err
+	}
+
 	ctx := context{
 		varReader:    varReader,
 		secretReader: sr,
 	}
 
+	return evaluateNodes(ctx, t.nodes)
+}
+
+// evaluateNodes evaluates the given nodes and concatenates the results.
+func evaluateNodes(ctx context, nodes []node) (string, error) {
 	var buffer bytes.Buffer
-	for _, n := range t.nodes {
+	for _, n := range nodes {
 		eval, err := n.evaluate(ctx)
 		if err != nil {
 			return "", err
 		}
 
+		// Variables that are set to the value of a secret in a range block
+		// are marked in the same way as the secret itself.
+		if v, ok := n.(variable); ok {
+			if path, ok := secretOfVariable(ctx.varReader, v.key); ok {
+				eval = markSecret(ctx.secretReader, path, eval)
+			}
+		}
+
 		buffer.WriteString(eval)
 	}
 
 	return buffer.String(), nil
 }
+
+// references implements referenceLister.
+func (t templateV2) references() []Reference {
+	return t.refs
+}
+
+// secretPaths implements secretLister.
+func (t templateV2) secretPaths(varReader VariableReader) ([]string, error) {
+	ctx := context{
+		varReader: varReader,
+	}
+	return secretPaths(ctx, t.nodes)
+}
+
+// secretPaths returns the paths of the secrets in the given nodes that are read
+// when evaluating them. The secrets in range blocks are read when evaluating the block.
+func secretPaths(ctx context, nodes []node) ([]string, error) {
+	var paths []string
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case secret:
+			// Secrets with fallbacks are allowed not to exist, so they are read when evaluating.
+			if n.hasFallback() {
+				continue
+			}
+
+			path, err := n.evaluatePath(ctx)
+			if err != nil {
+				return nil, err
+			}
+			paths = append(paths, path)
+		case partial:
+			partialPaths, err := secretPaths(ctx, n.nodes)
+			if err != nil {
+				return nil, err
+			}
+			paths = append(paths, partialPaths...)
+		case ifBlock:
+			branch, err := n.branch(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			branchPaths, err := secretPaths(ctx, branch)
+			if err != nil {
+				return nil, err
+			}
+			paths = append(paths, branchPaths...)
+		}
+	}
+	return paths, nil
+}
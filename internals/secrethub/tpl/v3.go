@@ -0,0 +1,664 @@
+package tpl
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/secrethub/secrethub-cli/internals/secrethub/tpl/internal/token"
+)
+
+// Keywords of block tags.
+const (
+	keywordIf    = "if"
+	keywordElse  = "else"
+	keywordEnd   = "end"
+	keywordRange = "range"
+)
+
+// keywords contains the keywords that start a block tag instead of a secret tag.
+var keywords = []string{keywordIf, keywordElse, keywordEnd, keywordRange}
+
+var v3BlockTag = regexp.MustCompile(`{{[\t ]*(?:if|range)[\t ]`)
+
+// IsV3Template returns whether v3 block tags are used in the given raw bytes.
+func IsV3Template(raw []byte) bool {
+	return v3BlockTag.Match(raw)
+}
+
+// NewV3Parser returns a parser for the v3 template syntax.
+//
+// V3 templates support everything v2 templates support. Additionally,
+// parts of the template can be rendered conditionally:
+// {{ if ${env} == "prd" }}...{{ else }}...{{ end }}
+//
+// The condition compares a variable to a value between double quotes
+// with `==` or `!=`. When only a variable is given, the condition is
+// true when the variable is set to a non-empty value.
+//
+// Parts of the template can also be repeated for every secret in a directory:
+// {{ range $name, $value := path/to/dir }}${name}={{ path/to/dir/${name} }}{{ end }}
+//
+// Within the range block, the name of the secret and, optionally, its
+// value are available as variables.
+//
+// Block tags that are on a line of their own are removed together with
+// the line, so that they do not leave empty lines in the output.
+func NewV3Parser() Parser {
+	return parserV3{}
+}
+
+type parserV3 struct {
+	// file is the path of the file the template is read from.
+	file string
+}
+
+// Parse parses a secret template from a raw string.
+//
+// On top of the syntax rules of v2 templates (see parserV2.Parse):
+//   - `{{ if ${var} }}`, `{{ if ${var} == "value" }}` and `{{ if ${var} != "value" }}`
+//     open a block that is only rendered when the condition is true. The block can
+//     contain an `{{ else }}` tag, after which the part is rendered when the condition is false.
+//   - `{{ range $name := path/to/dir }}` and `{{ range $name, $value := path/to/dir }}`
+//     open a block that is rendered once for every secret directly in the directory.
+//   - Blocks are closed with `{{ end }}` and can be nested.
+//   - Tags starting with one of the words if, else, end or range are block tags instead of secret tags.
+func (p parserV3) Parse(raw string, line, column int) (Template, error) {
+	parser := newV2Parser(bytes.NewBufferString(raw), line, column)
+	parser.blocks = true
+	parser.file = p.file
+
+	nodes, err := parser.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	nodes, err = buildBlocks(trimStandaloneTags(nodes))
+	if err != nil {
+		return nil, err
+	}
+
+	return templateV2{
+		nodes: nodes,
+		refs:  parser.sortedRefs(),
+	}, nil
+}
+
+// blockTag is a tag that opens, continues or closes a block. It is only used
+// while parsing and is replaced by the block it belongs to afterwards.
+type blockTag struct {
+	keyword string
+	lineNo  int
+	colNo   int
+
+	// condition is set for if tags.
+	condition condition
+	// loop is set for range tags, without a body.
+	loop rangeBlock
+}
+
+func (t blockTag) evaluate(ctx context) (string, error) {
+	// Block tags are replaced by blocks when parsing, so this is never called.
+	return "", nil
+}
+
+// condition is the condition of an if block.
+type condition struct {
+	variable variable
+	// operator is "==", "!=" or empty when only the variable is given.
+	operator string
+	value    string
+}
+
+// evaluate returns whether the condition is true. Variables that are not set are
+// evaluated as the empty string, so that they can be used to enable parts of a template.
+func (c condition) evaluate(ctx context) (bool, error) {
+	var value string
+	var err error
+	if c.variable.defaultValue != nil {
+		value, err = c.variable.evaluate(ctx)
+	} else {
+		value, _, err = LookupVariable(ctx.varReader, c.variable.key)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	switch c.operator {
+	case "==":
+		return value == c.value, nil
+	case "!=":
+		return value != c.value, nil
+	default:
+		return value != "", nil
+	}
+}
+
+type ifBlock struct {
+	condition condition
+	then      []node
+	otherwise []node
+}
+
+func (b ifBlock) evaluate(ctx context) (string, error) {
+	nodes, err := b.branch(ctx)
+	if err != nil {
+		return "", err
+	}
+	return evaluateNodes(ctx, nodes)
+}
+
+// branch returns the nodes that are rendered for the current variables.
+func (b ifBlock) branch(ctx context) ([]node, error) {
+	ok, err := b.condition.evaluate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return b.then, nil
+	}
+	return b.otherwise, nil
+}
+
+type rangeBlock struct {
+	// nameVar is the variable that is set to the name of the secret.
+	nameVar string
+	// valueVar is the variable that is set to the value of the secret.
+	// It is empty when the values of the secrets are not used.
+	valueVar string
+	dir      []node
+	body     []node
+}
+
+func (b rangeBlock) evaluate(ctx context) (string, error) {
+	dir, err := evaluatePath(ctx, b.dir)
+	if err != nil {
+		return "", err
+	}
+	dir = strings.TrimSuffix(dir, "/")
+
+	names, err := ListSecrets(ctx.secretReader, dir)
+	if err != nil {
+		return "", err
+	}
+
+	paths := make([]string, len(names))
+	for i, name := range names {
+		paths[i] = dir + "/" + name
+	}
+
+	prefetcher, ok := ctx.secretReader.(SecretPrefetcher)
+	if ok && b.valueVar != "" && len(paths) > 0 {
+		err = prefetcher.Prefetch(paths)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	var buffer bytes.Buffer
+	for i, name := range names {
+		vars := map[string]string{
+			b.nameVar: name,
+		}
+		secrets := make(map[string]string)
+		if b.valueVar != "" {
+			value, err := ctx.secret(paths[i])
+			if err != nil {
+				return "", err
+			}
+			vars[b.valueVar] = value
+			secrets[b.valueVar] = paths[i]
+		}
+
+		loopCtx := context{
+			varReader: scopedVariableReader{
+				vars:    vars,
+				secrets: secrets,
+				parent:  ctx.varReader,
+			},
+			secretReader: ctx.secretReader,
+		}
+
+		eval, err := evaluateNodes(loopCtx, b.body)
+		if err != nil {
+			return "", err
+		}
+		buffer.WriteString(eval)
+	}
+	return buffer.String(), nil
+}
+
+// scopedVariableReader reads the variables of a range block, falling back to the
+// variables outside of the block.
+type scopedVariableReader struct {
+	vars map[string]string
+	// secrets contains the paths of the secrets of which the value is
+	// assigned to a variable by the name of the variable.
+	secrets map[string]string
+	parent  VariableReader
+}
+
+// ReadVariable implements VariableReader.
+func (r scopedVariableReader) ReadVariable(name string) (string, error) {
+	value, ok := r.vars[name]
+	if ok {
+		return value, nil
+	}
+	return r.parent.ReadVariable(name)
+}
+
+// LookupVariable implements VariableLookupReader.
+func (r scopedVariableReader) LookupVariable(name string) (string, bool, error) {
+	value, ok := r.vars[name]
+	if ok {
+		return value, true, nil
+	}
+	return LookupVariable(r.parent, name)
+}
+
+// secretOfVariable returns the path of the secret of which the value is assigned
+// to the variable with the given name by a range block. When the variable is not
+// set to the value of a secret, ok is false.
+func secretOfVariable(varReader VariableReader, name string) (path string, ok bool) {
+	for {
+		scoped, isScoped := varReader.(scopedVariableReader)
+		if !isScoped {
+			return "", false
+		}
+		if _, defined := scoped.vars[name]; defined {
+			path, ok = scoped.secrets[name]
+			return path, ok
+		}
+		varReader = scoped.parent
+	}
+}
+
+// peekKeyword returns the keyword of the block tag that is opened at the current
+// position, or the empty string if the current tag is not a block tag.
+// The next character should be the last character of the opening delimiter ('{').
+func (p *v2Parser) peekKeyword() string {
+	rest := bytes.TrimLeft(p.buf.Bytes(), " \t")
+	for _, keyword := range keywords {
+		if !bytes.HasPrefix(rest, []byte(keyword)) {
+			continue
+		}
+		if len(rest) == len(keyword) || bytes.ContainsRune([]byte(" \t}"), rune(rest[len(keyword)])) {
+			return keyword
+		}
+	}
+	return ""
+}
+
+// parseBlockTag parses a block tag with the given keyword up to the closing delimiter.
+// The current character should be the first character of the opening delimiter ('{')
+// when parseBlockTag is called.
+//
+// When parseBlockTag returns, the next character in the buffer is the last character
+// of the closing delimiter of the tag ('}').
+func (p *v2Parser) parseBlockTag(keyword string) (node, error) {
+	tag := blockTag{
+		keyword: keyword,
+		lineNo:  p.lineNo,
+		colNo:   p.columnNo,
+	}
+
+	checkError := func(err error) error {
+		if err == io.EOF {
+			return ErrSecretTagNotClosed(p.lineNo, p.columnNo+1)
+		}
+		return err
+	}
+
+	err := p.readRune()
+	if err != nil {
+		return nil, checkError(err)
+	}
+
+	err = p.skipWhiteSpace()
+	if err != nil {
+		return nil, checkError(err)
+	}
+
+	for range keyword {
+		err = p.readRune()
+		if err != nil {
+			return nil, checkError(err)
+		}
+	}
+
+	err = p.skipWhiteSpace()
+	if err != nil {
+		return nil, checkError(err)
+	}
+
+	switch keyword {
+	case keywordIf:
+		tag.condition, err = p.parseCondition()
+		p.scopes = append(p.scopes, nil)
+	case keywordRange:
+		tag.loop, err = p.parseRange()
+		p.scopes = append(p.scopes, []string{tag.loop.nameVar, tag.loop.valueVar})
+	case keywordEnd:
+		if len(p.scopes) > 0 {
+			p.scopes = p.scopes[:len(p.scopes)-1]
+		}
+	}
+	if err != nil {
+		return nil, checkError(err)
+	}
+
+	err = p.parseClosingDelimiter()
+	if err != nil {
+		return nil, checkError(err)
+	}
+	return tag, nil
+}
+
+// parseClosingDelimiter parses the closing delimiter of a tag ('}}'). The next character
+// should be the first character of the closing delimiter when parseClosingDelimiter is called.
+//
+// When parseClosingDelimiter returns, the next character in the buffer is the last
+// character of the closing delimiter.
+func (p *v2Parser) parseClosingDelimiter() error {
+	if p.next != token.RBracket {
+		return ErrUnexpectedCharacter(p.lineNo, p.columnNo+1, p.next, token.RBracket)
+	}
+
+	err := p.readRune()
+	if err != nil {
+		return err
+	}
+
+	if p.next != token.RBracket {
+		return ErrUnexpectedCharacter(p.lineNo, p.columnNo+1, p.next, token.RBracket)
+	}
+	return nil
+}
+
+// parseCondition parses the condition of an if tag. The next character should be the
+// first character of the condition when parseCondition is called.
+//
+// When parseCondition returns, the whitespace after the condition is skipped.
+func (p *v2Parser) parseCondition() (condition, error) {
+	var c condition
+
+	lineNo, columnNo := p.lineNo, p.columnNo+1
+	v, err := p.parseTagVariable()
+	if err != nil {
+		return c, err
+	}
+	// Variables that are not set are evaluated as an empty string in conditions.
+	p.addVariableRef(v, true, lineNo, columnNo)
+	c.variable = v
+
+	err = p.skipWhiteSpace()
+	if err != nil {
+		return c, err
+	}
+
+	if p.next != token.Equals && p.next != token.Exclamation {
+		return c, nil
+	}
+
+	err = p.readRune()
+	if err != nil {
+		return c, err
+	}
+
+	if p.next != token.Equals {
+		return c, ErrUnexpectedCharacter(p.lineNo, p.columnNo+1, p.next, token.Equals)
+	}
+	c.operator = string(p.current) + string(p.next)
+
+	err = p.readRune()
+	if err != nil {
+		return c, err
+	}
+
+	err = p.skipWhiteSpace()
+	if err != nil {
+		return c, err
+	}
+
+	if p.next != token.Quote {
+		return c, ErrUnexpectedCharacter(p.lineNo, p.columnNo+1, p.next, token.Quote)
+	}
+
+	c.value, err = p.parseString()
+	if err != nil {
+		return c, err
+	}
+
+	return c, p.skipWhiteSpace()
+}
+
+// parseRange parses the variables and the directory of a range tag. The next character
+// should be the first character after the range keyword when parseRange is called.
+//
+// When parseRange returns, the whitespace after the directory path is skipped.
+func (p *v2Parser) parseRange() (rangeBlock, error) {
+	var b rangeBlock
+
+	nameVar, err := p.parseTagVariable()
+	if err != nil {
+		return b, err
+	}
+	b.nameVar = nameVar.key
+
+	err = p.skipWhiteSpace()
+	if err != nil {
+		return b, err
+	}
+
+	if p.next == token.Comma {
+		err = p.readRune()
+		if err != nil {
+			return b, err
+		}
+
+		err = p.skipWhiteSpace()
+		if err != nil {
+			return b, err
+		}
+
+		valueVar, err := p.parseTagVariable()
+		if err != nil {
+			return b, err
+		}
+		b.valueVar = valueVar.key
+
+		err = p.skipWhiteSpace()
+		if err != nil {
+			return b, err
+		}
+	}
+
+	if p.next != token.Colon {
+		return b, ErrUnexpectedCharacter(p.lineNo, p.columnNo+1, p.next, token.Colon)
+	}
+
+	err = p.readRune()
+	if err != nil {
+		return b, err
+	}
+
+	if p.next != token.Equals {
+		return b, ErrUnexpectedCharacter(p.lineNo, p.columnNo+1, p.next, token.Equals)
+	}
+
+	err = p.readRune()
+	if err != nil {
+		return b, err
+	}
+
+	err = p.skipWhiteSpace()
+	if err != nil {
+		return b, err
+	}
+
+	lineNo, columnNo := p.lineNo, p.columnNo+1
+	b.dir, err = p.parseSecretPath()
+	if err != nil {
+		return b, err
+	}
+	if len(b.dir) == 0 {
+		return b, ErrIllegalSecretCharacter(p.lineNo, p.columnNo+1, p.next)
+	}
+	p.addPathRef(ReferenceDir, b.dir, false, lineNo, columnNo)
+	return b, nil
+}
+
+// parseTagVariable parses a variable in a block tag, either with or without brackets.
+// The next character should be the dollar sign when parseTagVariable is called.
+//
+// When parseTagVariable returns, the next character is the first character after the variable.
+func (p *v2Parser) parseTagVariable() (variable, error) {
+	if p.next != token.Dollar {
+		return variable{}, ErrUnexpectedCharacter(p.lineNo, p.columnNo+1, p.next, token.Dollar)
+	}
+
+	err := p.readRune()
+	if err != nil {
+		return variable{}, err
+	}
+
+	var n node
+	if p.next == token.LBracket {
+		n, err = p.parseVar()
+		if err == nil {
+			err = p.readRune()
+		}
+	} else if p.isVariableStartRune(p.next) {
+		n, err = p.parseVarWithoutBrackets()
+	} else {
+		return variable{}, ErrIllegalVariableCharacter(p.lineNo, p.columnNo+1, p.next)
+	}
+	if err != nil {
+		return variable{}, err
+	}
+	return n.(variable), nil
+}
+
+// trimStandaloneTags removes the whitespace around block tags that are on a line of their own,
+// together with the newline that ends the line.
+func trimStandaloneTags(nodes []node) []node {
+	remove := make([]bool, len(nodes))
+	for i, n := range nodes {
+		_, ok := n.(blockTag)
+		if !ok {
+			continue
+		}
+
+		start := i
+		for start > 0 && isInlineWhiteSpace(nodes[start-1]) {
+			start--
+		}
+		if start > 0 && nodes[start-1] != character('\n') {
+			continue
+		}
+
+		end := i + 1
+		for end < len(nodes) && isInlineWhiteSpace(nodes[end]) {
+			end++
+		}
+		if end < len(nodes) && nodes[end] != character('\n') {
+			continue
+		}
+
+		for j := start; j <= end && j < len(nodes); j++ {
+			if j != i {
+				remove[j] = true
+			}
+		}
+	}
+
+	res := []node{}
+	for i, n := range nodes {
+		if !remove[i] {
+			res = append(res, n)
+		}
+	}
+	return res
+}
+
+// isInlineWhiteSpace returns whether the node is a space or a tab.
+func isInlineWhiteSpace(n node) bool {
+	return n == character(' ') || n == character('\t')
+}
+
+// buildBlocks replaces the block tags in the given nodes by the blocks they form.
+func buildBlocks(nodes []node) ([]node, error) {
+	res, _, end, err := buildBody(nodes, 0)
+	if err != nil {
+		return nil, err
+	}
+	if end != nil {
+		return nil, ErrUnexpectedBlockTag(end.lineNo, end.colNo, end.keyword)
+	}
+	return res, nil
+}
+
+// buildBody builds the nodes from the given index up to the first else or end tag that
+// does not belong to a nested block. It returns the built nodes, the index after the
+// tag that ended the body and the tag itself, or nil if the end of the nodes is reached.
+func buildBody(nodes []node, i int) ([]node, int, *blockTag, error) {
+	res := []node{}
+	for i < len(nodes) {
+		tag, ok := nodes[i].(blockTag)
+		if !ok {
+			res = append(res, nodes[i])
+			i++
+			continue
+		}
+
+		switch tag.keyword {
+		case keywordElse, keywordEnd:
+			return res, i + 1, &tag, nil
+		case keywordIf:
+			block := ifBlock{
+				condition: tag.condition,
+			}
+
+			var end *blockTag
+			var err error
+			block.then, i, end, err = buildBody(nodes, i+1)
+			if err != nil {
+				return nil, 0, nil, err
+			}
+
+			if end != nil && end.keyword == keywordElse {
+				block.otherwise, i, end, err = buildBody(nodes, i)
+				if err != nil {
+					return nil, 0, nil, err
+				}
+			}
+
+			if end == nil {
+				return nil, 0, nil, ErrBlockNotClosed(tag.lineNo, tag.colNo, tag.keyword)
+			}
+			if end.keyword != keywordEnd {
+				return nil, 0, nil, ErrUnexpectedBlockTag(end.lineNo, end.colNo, end.keyword)
+			}
+			res = append(res, block)
+		case keywordRange:
+			block := tag.loop
+
+			var end *blockTag
+			var err error
+			block.body, i, end, err = buildBody(nodes, i+1)
+			if err != nil {
+				return nil, 0, nil, err
+			}
+
+			if end == nil {
+				return nil, 0, nil, ErrBlockNotClosed(tag.lineNo, tag.colNo, tag.keyword)
+			}
+			if end.keyword != keywordEnd {
+				return nil, 0, nil, ErrUnexpectedBlockTag(end.lineNo, end.colNo, end.keyword)
+			}
+			res = append(res, block)
+		}
+	}
+	return res, i, nil, nil
+}
@@ -0,0 +1,280 @@
+package tpl
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/secrethub/secrethub-cli/internals/secrethub/tpl/fakes"
+
+	"github.com/secrethub/secrethub-go/internals/assert"
+)
+
+func TestParserV3_Parse(t *testing.T) {
+	cases := map[string]struct {
+		input    string
+		expected []node
+		err      error
+	}{
+		"if": {
+			input: "{{ if ${env} }}a{{ end }}",
+			expected: []node{
+				ifBlock{
+					condition: condition{
+						variable: variable{key: "env"},
+					},
+					then:      []node{character('a')},
+					otherwise: nil,
+				},
+			},
+		},
+		"if else with comparison": {
+			input: "{{if $env == \"prd\"}}a{{else}}b{{end}}",
+			expected: []node{
+				ifBlock{
+					condition: condition{
+						variable: variable{key: "env"},
+						operator: "==",
+						value:    "prd",
+					},
+					then:      []node{character('a')},
+					otherwise: []node{character('b')},
+				},
+			},
+		},
+		"range": {
+			input: "{{ range $name, ${ value } := a/${dir} }}b{{ end }}",
+			expected: []node{
+				rangeBlock{
+					nameVar:  "name",
+					valueVar: "value",
+					dir: []node{
+						character('a'),
+						character('/'),
+						variable{key: "dir"},
+					},
+					body: []node{character('b')},
+				},
+			},
+		},
+		"nested blocks": {
+			input: "{{ range $name := a }}{{ if $name != \"b\" }}c{{ end }}{{ end }}",
+			expected: []node{
+				rangeBlock{
+					nameVar: "name",
+					dir:     []node{character('a')},
+					body: []node{
+						ifBlock{
+							condition: condition{
+								variable: variable{key: "name"},
+								operator: "!=",
+								value:    "b",
+							},
+							then: []node{character('c')},
+						},
+					},
+				},
+			},
+		},
+		"standalone tags": {
+			input: "a\n  {{ if $b }}  \nc\n{{ end }}\n",
+			expected: []node{
+				character('a'),
+				character('\n'),
+				ifBlock{
+					condition: condition{
+						variable: variable{key: "b"},
+					},
+					then: []node{character('c'), character('\n')},
+				},
+			},
+		},
+		"inline tags": {
+			input: "a {{ if $b }}c{{ end }}\n",
+			expected: []node{
+				character('a'),
+				character(' '),
+				ifBlock{
+					condition: condition{
+						variable: variable{key: "b"},
+					},
+					then: []node{character('c')},
+				},
+				character('\n'),
+			},
+		},
+		"secret starting with keyword": {
+			input: "{{ endpoint }}",
+			expected: []node{
+				secret{
+					path: []node{
+						character('e'),
+						character('n'),
+						character('d'),
+						character('p'),
+						character('o'),
+						character('i'),
+						character('n'),
+						character('t'),
+					},
+				},
+			},
+		},
+		"if not closed": {
+			input: "a\n{{ if $b }}c",
+			err:   ErrBlockNotClosed(2, 1, "if"),
+		},
+		"range not closed": {
+			input: "{{ range $b := c }}{{ if $b }}{{ end }}",
+			err:   ErrBlockNotClosed(1, 1, "range"),
+		},
+		"else in range": {
+			input: "{{ range $b := c }}{{ else }}{{ end }}",
+			err:   ErrUnexpectedBlockTag(1, 20, "else"),
+		},
+		"end without block": {
+			input: "a{{ end }}",
+			err:   ErrUnexpectedBlockTag(1, 2, "end"),
+		},
+		"second else": {
+			input: "{{ if $a }}{{ else }}{{ else }}{{ end }}",
+			err:   ErrUnexpectedBlockTag(1, 22, "else"),
+		},
+		"if without variable": {
+			input: "{{ if env }}{{ end }}",
+			err:   ErrUnexpectedCharacter(1, 7, 'e', '$'),
+		},
+		"invalid operator": {
+			input: "{{ if $env = \"prd\" }}{{ end }}",
+			err:   ErrUnexpectedCharacter(1, 13, ' ', '='),
+		},
+		"comparison without quotes": {
+			input: "{{ if $env == prd }}{{ end }}",
+			err:   ErrUnexpectedCharacter(1, 15, 'p', '"'),
+		},
+		"range without assignment": {
+			input: "{{ range $name in a }}{{ end }}",
+			err:   ErrUnexpectedCharacter(1, 16, 'i', ':'),
+		},
+		"range without directory": {
+			input: "{{ range $name := }}{{ end }}",
+			err:   ErrIllegalSecretCharacter(1, 19, '}'),
+		},
+		"block tag not closed": {
+			input: "{{ end }",
+			err:   ErrSecretTagNotClosed(1, 9),
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			actual, err := NewV3Parser().Parse(tc.input, 1, 1)
+
+			if tc.err != nil {
+				assert.Equal(t, err, tc.err)
+			} else {
+				assert.OK(t, err)
+				assert.Equal(t, actual.(templateV2).nodes, tc.expected)
+			}
+		})
+	}
+}
+
+func TestV3(t *testing.T) {
+	cases := map[string]struct {
+		raw     string
+		vars    map[string]string
+		secrets map[string]string
+
+		expected string
+	}{
+		"if true": {
+			raw:      "debug: {{ if ${debug} }}true{{ else }}false{{ end }}",
+			vars:     map[string]string{"debug": "1"},
+			expected: "debug: true",
+		},
+		"if variable not set": {
+			raw:      "debug: {{ if ${debug} }}true{{ else }}false{{ end }}",
+			expected: "debug: false",
+		},
+		"if with default": {
+			raw:      "{{ if ${env:-dev} == \"dev\" }}dev{{ end }}",
+			expected: "dev",
+		},
+		"if comparison": {
+			raw: "host: {{ if $env == \"prd\" }}{{ company/prd/db/host }}{{ else }}localhost{{ end }}",
+			vars: map[string]string{
+				"env": "prd",
+			},
+			secrets: map[string]string{
+				"company/prd/db/host": "db.example.com",
+			},
+			expected: "host: db.example.com",
+		},
+		"secrets in other branch are not read": {
+			raw: "host: {{ if $env == \"prd\" }}{{ company/prd/db/host }}{{ else }}localhost{{ end }}",
+			vars: map[string]string{
+				"env": "dev",
+			},
+			expected: "host: localhost",
+		},
+		"range": {
+			raw: "partners:\n{{ range $name, $key := company/app/partners }}\n  ${name}: ${key}\n{{ end }}\n",
+			secrets: map[string]string{
+				"company/app/partners/acme":    "key1",
+				"company/app/partners/initech": "key2",
+				"company/app/partners/sub/foo": "key3",
+			},
+			expected: "partners:\n  acme: key1\n  initech: key2\n",
+		},
+		"range with names": {
+			raw: "{{ range $name := ${dir}/ }}{{ ${dir}/${name} }},{{ end }}",
+			vars: map[string]string{
+				"dir": "company/app",
+			},
+			secrets: map[string]string{
+				"company/app/a": "1",
+				"company/app/b": "2",
+			},
+			expected: "1,2,",
+		},
+		"range over empty directory": {
+			raw:      "a{{ range $name := company/app/empty }}${name}{{ end }}b",
+			expected: "ab",
+		},
+		"range shadows variables": {
+			raw: "{{ range $name := company/app }}${name}{{ end }} ${name}",
+			vars: map[string]string{
+				"name": "outer",
+			},
+			secrets: map[string]string{
+				"company/app/inner": "1",
+			},
+			expected: "inner outer",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			parsed, err := NewV3Parser().Parse(tc.raw, 1, 1)
+			assert.OK(t, err)
+
+			actual, err := parsed.Evaluate(fakes.FakeVariableReader{Variables: tc.vars}, fakes.FakeSecretReader{Secrets: tc.secrets})
+			assert.OK(t, err)
+			assert.Equal(t, actual, tc.expected)
+		})
+	}
+}
+
+type secretReaderWithoutDirs struct{}
+
+func (sr secretReaderWithoutDirs) ReadSecret(path string) (string, error) {
+	return "", errors.New("not implemented")
+}
+
+func TestV3_RangeNotSupported(t *testing.T) {
+	parsed, err := NewV3Parser().Parse("{{ range $name := company/app }}${name}{{ end }}", 1, 1)
+	assert.OK(t, err)
+
+	_, err = parsed.Evaluate(fakes.FakeVariableReader{}, secretReaderWithoutDirs{})
+	assert.Equal(t, err, ErrCannotListSecrets("company/app"))
+}
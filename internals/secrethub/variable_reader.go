@@ -2,44 +2,134 @@ package secrethub
 
 import (
 	"fmt"
+	"io/ioutil"
 	"strings"
 
 	"github.com/secrethub/secrethub-cli/internals/cli/validation"
 
 	"github.com/secrethub/secrethub-cli/internals/cli/ui"
 	"github.com/secrethub/secrethub-cli/internals/secrethub/tpl"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Errors
+var (
+	ErrReadVarFile    = errRun.Code("var_file_read_error").ErrorPref("could not read the template variable file %s: %s")
+	ErrInvalidVarFile = errRun.Code("invalid_var_file").ErrorPref("template variable file %s is invalid: %s")
 )
 
+const (
+	// templateVarSourceFlag is the source of template variables defined with the --var flag.
+	templateVarSourceFlag = "--var"
+	// varFileForEnvironment is the file with the template variables of the environment selected with --environment.
+	varFileForEnvironment = "secrethub.%s.vars.yml"
+)
+
+// templateVar is the value of a template variable together with where it is defined.
+type templateVar struct {
+	Name   string
+	Value  string
+	Source string
+}
+
 type variableReader struct {
 	vars map[string]string
 }
 
 // newVariableReader returns a new template variable reader that fetches template variables from the
-// specified OS environment variables and commandFlags. An error is returned if any of the provided variable
-// names is invalid.
-func newVariableReader(osEnv map[string]string, commandTemplateVars map[string]string) (tpl.VariableReader, error) {
-	templateVars := make(map[string]string)
+// specified OS environment variables, commandFlags and variable files. An error is returned if any
+// of the provided variable names is invalid.
+func newVariableReader(osEnv map[string]string, commandTemplateVars map[string]string, varFiles ...string) (tpl.VariableReader, error) {
+	templateVars, err := readTemplateVars(osEnv, commandTemplateVars, varFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	vars := make(map[string]string, len(templateVars))
+	for name, v := range templateVars {
+		vars[name] = v.Value
+	}
+
+	return &variableReader{
+		vars: vars,
+	}, nil
+}
+
+// readTemplateVars returns the template variables by their name, together with where they are defined.
+// Variables defined with commandFlags take precedence over variables from the OS environment, which in
+// turn take precedence over variables from the variable files. Later variable files take precedence over
+// earlier ones.
+func readTemplateVars(osEnv map[string]string, commandTemplateVars map[string]string, varFiles []string) (map[string]templateVar, error) {
+	templateVars := make(map[string]templateVar)
+
+	for _, file := range varFiles {
+		vars, err := readVarFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		for k, v := range vars {
+			templateVars[strings.ToLower(k)] = templateVar{Value: v, Source: file}
+		}
+	}
 
 	for k, v := range osEnv {
 		if strings.HasPrefix(k, templateVarEnvVarPrefix) {
-			k = strings.TrimPrefix(k, templateVarEnvVarPrefix)
-			templateVars[strings.ToLower(k)] = v
+			name := strings.TrimPrefix(k, templateVarEnvVarPrefix)
+			templateVars[strings.ToLower(name)] = templateVar{Value: v, Source: "$" + k}
 		}
 	}
 
 	for k, v := range commandTemplateVars {
-		templateVars[strings.ToLower(k)] = v
+		templateVars[strings.ToLower(k)] = templateVar{Value: v, Source: templateVarSourceFlag}
 	}
 
-	for k := range templateVars {
+	for k, v := range templateVars {
 		if !validation.IsEnvarNamePosix(k) {
 			return nil, ErrInvalidTemplateVar(k)
 		}
+		v.Name = k
+		templateVars[k] = v
 	}
 
-	return &variableReader{
-		vars: templateVars,
-	}, nil
+	return templateVars, nil
+}
+
+// readVarFile reads a YAML file that maps the names of template variables to their values.
+func readVarFile(path string) (map[string]string, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, ErrReadVarFile(path, err)
+	}
+
+	var values map[string]interface{}
+	err = yaml.UnmarshalStrict(raw, &values)
+	if err != nil {
+		return nil, ErrInvalidVarFile(path, err)
+	}
+
+	vars := make(map[string]string, len(values))
+	for name, value := range values {
+		switch v := value.(type) {
+		case nil:
+			vars[name] = ""
+		case map[interface{}]interface{}, []interface{}:
+			return nil, ErrInvalidVarFile(path, fmt.Sprintf("the value of %s is not a string, number or boolean", name))
+		default:
+			vars[name] = fmt.Sprint(v)
+		}
+	}
+	return vars, nil
+}
+
+// templateVarFiles returns the variable files to read the template variables from: the variable
+// file of the given environment, if any, followed by the given variable files.
+func templateVarFiles(environment string, varFiles []string) []string {
+	if environment == "" {
+		return varFiles
+	}
+	return append([]string{fmt.Sprintf(varFileForEnvironment, environment)}, varFiles...)
 }
 
 // ReadVariable fetches a template variable by name and errors if it is not found.
@@ -51,6 +141,12 @@ func (v *variableReader) ReadVariable(name string) (string, error) {
 	return variable, nil
 }
 
+// LookupVariable implements tpl.VariableLookupReader.
+func (v *variableReader) LookupVariable(name string) (string, bool, error) {
+	variable, ok := v.vars[name]
+	return variable, ok, nil
+}
+
 type promptMissingVariableReader struct {
 	reader  tpl.VariableReader
 	io      ui.IO
@@ -86,3 +182,13 @@ func (p *promptMissingVariableReader) ReadVariable(name string) (string, error)
 
 	return variable, err
 }
+
+// LookupVariable implements tpl.VariableLookupReader. It does not prompt the user
+// for variables that are not found, as these have a default value.
+func (p *promptMissingVariableReader) LookupVariable(name string) (string, bool, error) {
+	variable, ok := p.answers[name]
+	if ok {
+		return variable, true, nil
+	}
+	return tpl.LookupVariable(p.reader, name)
+}
@@ -1,6 +1,10 @@
 package secrethub
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
 	"testing"
 
 	"github.com/secrethub/secrethub-cli/internals/cli/ui"
@@ -172,3 +176,109 @@ func TestPromptVariableReader(t *testing.T) {
 		})
 	}
 }
+
+func TestPromptVariableReader_LookupVariable(t *testing.T) {
+	reader, err := newVariableReader(map[string]string{}, map[string]string{"test1": "testA"})
+	assert.OK(t, err)
+
+	io := ui.NewFakeIO()
+	io.PromptIn.Reads = []string{"foobar\n"}
+	promptReader := newPromptMissingVariableReader(reader, io).(tpl.VariableLookupReader)
+
+	value, ok, err := promptReader.LookupVariable("test1")
+	assert.OK(t, err)
+	assert.Equal(t, ok, true)
+	assert.Equal(t, value, "testA")
+
+	// Variables that are not set are not prompted for.
+	value, ok, err = promptReader.LookupVariable("test2")
+	assert.OK(t, err)
+	assert.Equal(t, ok, false)
+	assert.Equal(t, value, "")
+
+	// Answers that are given before are used.
+	_, err = promptReader.ReadVariable("test2")
+	assert.OK(t, err)
+	value, ok, err = promptReader.LookupVariable("test2")
+	assert.OK(t, err)
+	assert.Equal(t, ok, true)
+	assert.Equal(t, value, "foobar")
+}
+
+func TestReadTemplateVars(t *testing.T) {
+	dir, cleanup := testdata.tempDir(t)
+	defer cleanup()
+
+	files := map[string]string{
+		"secrethub.prd.vars.yml": "env: prd\napp: billing\nreplicas: 3\ndebug: false\n",
+		"override.yml":           "app: invoicing\n",
+		"nested.yml":             "db:\n  host: localhost\n",
+		"invalid-name.yml":       "3app: billing\n",
+		"invalid.yml":            "env: [prd\n",
+	}
+	for name, content := range files {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600)
+		assert.OK(t, err)
+	}
+	path := func(name string) string {
+		return filepath.Join(dir, name)
+	}
+
+	cases := map[string]struct {
+		osEnv        map[string]string
+		templateVars map[string]string
+		varFiles     []string
+		expected     map[string]templateVar
+		err          error
+	}{
+		"precedence": {
+			osEnv: map[string]string{
+				templateVarEnvVarPrefix + "ENV": "stg",
+			},
+			templateVars: map[string]string{
+				"DEBUG": "true",
+			},
+			varFiles: []string{path("secrethub.prd.vars.yml"), path("override.yml")},
+			expected: map[string]templateVar{
+				"env":      {Name: "env", Value: "stg", Source: "$" + templateVarEnvVarPrefix + "ENV"},
+				"app":      {Name: "app", Value: "invoicing", Source: path("override.yml")},
+				"replicas": {Name: "replicas", Value: "3", Source: path("secrethub.prd.vars.yml")},
+				"debug":    {Name: "debug", Value: "true", Source: templateVarSourceFlag},
+			},
+		},
+		"file does not exist": {
+			varFiles: []string{path("missing.yml")},
+			err:      ErrReadVarFile(path("missing.yml"), &os.PathError{Op: "open", Path: path("missing.yml"), Err: syscall.ENOENT}),
+		},
+		"nested value": {
+			varFiles: []string{path("nested.yml")},
+			err:      ErrInvalidVarFile(path("nested.yml"), "the value of db is not a string, number or boolean"),
+		},
+		"invalid name": {
+			varFiles: []string{path("invalid-name.yml")},
+			err:      ErrInvalidTemplateVar("3app"),
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			actual, err := readTemplateVars(tc.osEnv, tc.templateVars, tc.varFiles)
+			assert.Equal(t, err, tc.err)
+			if tc.err == nil {
+				assert.Equal(t, actual, tc.expected)
+			}
+		})
+	}
+
+	t.Run("invalid yaml", func(t *testing.T) {
+		_, err := readTemplateVars(nil, nil, []string{path("invalid.yml")})
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
+
+func TestTemplateVarFiles(t *testing.T) {
+	assert.Equal(t, templateVarFiles("", []string{"vars.yml"}), []string{"vars.yml"})
+	assert.Equal(t, templateVarFiles("prod", []string{"vars.yml"}), []string{"secrethub.prod.vars.yml", "vars.yml"})
+}
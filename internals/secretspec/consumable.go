@@ -26,6 +26,8 @@ var (
 		FileParser{},
 		EnvParser{},
 		InjectParser{},
+		K8sSecretParser{},
+		SystemdCredentialParser{},
 	}
 
 	// DefaultFileMode is the default filemode to use for consumables.
@@ -56,6 +58,8 @@ type Consumable interface {
 	Set(secrets map[string]api.SecretVersion) error
 	// Clear clears the consumable of any content.
 	Clear() error
+	// Status compares the consumable on the system with the matching secrets, without revealing their values.
+	Status(secrets map[string]api.SecretVersion) (Status, error)
 	// Sources returns a set of full paths of the secrets corresponding to the consumable.
 	Sources() map[string]struct{}
 	// Equals returns whether to Consumables have the same target. This can be used to check whether they can exist in the same spec.
@@ -170,6 +174,29 @@ func (p *Presenter) Set(secrets map[string]api.SecretVersion) error {
 	return nil
 }
 
+// ConsumableStatus is the status of a consumable on the system.
+type ConsumableStatus struct {
+	Consumable Consumable
+	Status     Status
+}
+
+// Status compares all consumables on the system with the given secrets.
+func (p *Presenter) Status(secrets map[string]api.SecretVersion) ([]ConsumableStatus, error) {
+	statuses := make([]ConsumableStatus, len(p.consumables))
+	for i, consumable := range p.consumables {
+		status, err := consumable.Status(secrets)
+		if err != nil {
+			return nil, err
+		}
+		statuses[i] = ConsumableStatus{
+			Consumable: consumable,
+			Status:     status,
+		}
+	}
+
+	return statuses, nil
+}
+
 // Sources returns the full paths of all secrets sourced within the presenter.
 func (p *Presenter) Sources() map[string]struct{} {
 	total := make(map[string]struct{})
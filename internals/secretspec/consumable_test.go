@@ -48,6 +48,16 @@ secrets:
     - env:
         name: "environment_name"
         vars:
+            TEST: user/repo/secret
+    - k8s-secret:
+        name: "app-secrets"
+        target: "k8s_secret_target"
+        data:
+            TEST: user/repo/secret
+    - systemd-credential:
+        target: "systemd_credential_target"
+        format: "env-file"
+        credentials:
             TEST: user/repo/secret`)
 
 	err = p.Parse(spec)
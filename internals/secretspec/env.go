@@ -160,6 +160,24 @@ func (e env) Set(secrets map[string]api.SecretVersion) error {
 	return nil
 }
 
+// Status compares the environment variable files with the matching secrets in the given map.
+func (e *env) Status(secrets map[string]api.SecretVersion) (Status, error) {
+	statuses := make([]Status, len(e.vars))
+	for i, v := range e.vars {
+		version, found := secrets[v.source]
+		if !found {
+			return "", ErrSecretNotFound(v.source)
+		}
+
+		status, err := fileStatus(e.getVarPath(v), version.Data, []api.SecretVersion{version})
+		if err != nil {
+			return "", err
+		}
+		statuses[i] = status
+	}
+	return combineStatus(statuses...), nil
+}
+
 // Clear removes the environment variable directory from the filesystem.
 func (e *env) Clear() error {
 	err := os.RemoveAll(e.dirPath)
@@ -119,6 +119,16 @@ func (f *file) Set(secrets map[string]api.SecretVersion) error {
 	return overwriteFile(f.target, posix.AddNewLine(version.Data), f.filemode)
 }
 
+// Status compares the file with the contents of the matching secret in the given map.
+func (f *file) Status(secrets map[string]api.SecretVersion) (Status, error) {
+	version, found := secrets[f.source]
+	if !found {
+		return "", ErrSecretNotFound(f.source)
+	}
+
+	return fileStatus(f.target, posix.AddNewLine(version.Data), []api.SecretVersion{version})
+}
+
 // Clear removes the file from the filesystem.
 func (f *file) Clear() error {
 	err := os.Remove(f.target)
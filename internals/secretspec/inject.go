@@ -5,6 +5,8 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 
 	"github.com/secrethub/secrethub-cli/internals/tpl"
 
@@ -20,12 +22,22 @@ var (
 	ErrInjectParseFailed = errConsumption.Code("inject_parse_failed").ErrorPref("failed to parse contents: %v")
 	// ErrInjectFailed is returned when injecting secrets failed. Takes an error.
 	ErrInjectFailed = errConsumption.Code("inject_failed").ErrorPref("failed to inject secrets: %v")
+	// ErrCannotInclude is returned when a file included in the contents to inject cannot be read. Takes the path, the file and line of the include tag, and an error.
+	ErrCannotInclude = errConsumption.Code("cannot_include").ErrorPref("cannot include %s at %s:%d: %v")
+	// ErrIncludeCycle is returned when a file includes itself, directly or through other files. Takes the path and the file and line of the include tag.
+	ErrIncludeCycle = errConsumption.Code("include_cycle").ErrorPref("cannot include %s at %s:%d: it includes itself")
+	// ErrIncludeFailed is returned when a file included in the contents to inject contains an error. Takes the path, the file and line of the include tag, and an error.
+	ErrIncludeFailed = errConsumption.Code("include_failed").ErrorPref("in %s included at %s:%d: %v")
 )
 
 var (
 	fieldEncoding = "encoding"
 )
 
+// includeTag matches the tags that include other files in the contents to inject,
+// e.g. {{ include "path/to/partial.tpl" }}.
+var includeTag = regexp.MustCompile(`{{[ \t]*include[ \t]+"([^"]*)"[ \t]*}}`)
+
 // InjectParser parses Inject Consumables.
 type InjectParser struct{}
 
@@ -98,7 +110,7 @@ func (p InjectParser) Parse(rootPath string, allowMountAnywhere bool, config map
 		return nil, err
 	}
 
-	inj.template, err = tpl.NewParser("${", "}").Parse(string(decodedBytes))
+	inj.template, err = inj.parse(string(decodedBytes), tpl.NewIncluder(source))
 	if err != nil {
 		return nil, err
 	}
@@ -118,28 +130,124 @@ type Inject struct {
 	template tpl.Template
 }
 
+// parse parses the contents of the file of the given includer. The contents between the
+// include tags are parsed separately, so that every tag is closed in the file it is opened in.
+// The included files are read relative to the file that includes them and are decoded with
+// the encoding of the consumable.
+func (inj *Inject) parse(contents string, includer tpl.Includer) (tpl.Template, error) {
+	parser := tpl.NewParser("${", "}")
+
+	var templates includedTemplate
+	last := 0
+	for _, match := range includeTag.FindAllStringSubmatchIndex(contents, -1) {
+		text, err := parser.Parse(contents[last:match[0]])
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, text)
+		last = match[1]
+
+		lineNo := strings.Count(contents[:match[0]], "\n") + 1
+		included, ok := includer.Include(contents[match[2]:match[3]])
+		if !ok {
+			return nil, ErrIncludeCycle(included.File(), includer.File(), lineNo)
+		}
+
+		raw, err := ioutil.ReadFile(included.File())
+		if err != nil {
+			return nil, ErrCannotInclude(included.File(), includer.File(), lineNo, err)
+		}
+
+		decoded, err := inj.encoding.NewDecoder().Bytes(raw)
+		if err != nil {
+			return nil, ErrCannotInclude(included.File(), includer.File(), lineNo, err)
+		}
+
+		// The newline at the end of the included file is left out, so that an
+		// include tag on a line of its own does not leave an empty line.
+		partial, err := inj.parse(strings.TrimSuffix(string(decoded), "\n"), included)
+		if err != nil {
+			return nil, ErrIncludeFailed(included.File(), includer.File(), lineNo, err)
+		}
+		templates = append(templates, partial)
+	}
+
+	text, err := parser.Parse(contents[last:])
+	if err != nil {
+		return nil, err
+	}
+	return append(templates, text), nil
+}
+
+// includedTemplate is a template that consists of the templates of the contents
+// of a file and the files included in it, in the order in which they occur.
+type includedTemplate []tpl.Template
+
+// Inject implements tpl.Template.
+func (t includedTemplate) Inject(replacements map[string]string) (string, error) {
+	var res strings.Builder
+	for _, template := range t {
+		injected, err := template.Inject(replacements)
+		if err != nil {
+			return "", err
+		}
+		res.WriteString(injected)
+	}
+	return res.String(), nil
+}
+
+// Keys implements tpl.Template.
+func (t includedTemplate) Keys() []string {
+	set := map[string]struct{}{}
+	var res []string
+	for _, template := range t {
+		for _, key := range template.Keys() {
+			if _, ok := set[key]; !ok {
+				set[key] = struct{}{}
+				res = append(res, key)
+			}
+		}
+	}
+	return res
+}
+
 // Set injects all secrets with data from matching secrets in the map
 // and writes to the target file. Though the map may contain other
 // secrets, it must contain all source secrets of this consumable.
 func (inj *Inject) Set(secrets map[string]api.SecretVersion) error {
-	input := make(map[string]string, len(secrets))
-	for path, secret := range secrets {
-		input[path] = string(secret.Data)
-	}
-
-	output, err := inj.template.Inject(input)
+	encodedBytes, err := inj.inject(secrets)
 	if err != nil {
 		return err
 	}
 
 	log.Debugf("writing injected file to %s", inj.target)
 
-	encodedBytes, err := inj.encoding.NewEncoder().Bytes([]byte(output))
+	return overwriteFile(inj.target, encodedBytes, inj.filemode)
+}
+
+// Status compares the target file with the contents injected with the matching secrets in the given map.
+func (inj *Inject) Status(secrets map[string]api.SecretVersion) (Status, error) {
+	encodedBytes, err := inj.inject(secrets)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	return overwriteFile(inj.target, encodedBytes, inj.filemode)
+	return fileStatus(inj.target, encodedBytes, sourceVersions(inj, secrets))
+}
+
+// inject injects the secrets in the template and encodes the result with the encoding of the consumable.
+func (inj *Inject) inject(secrets map[string]api.SecretVersion) ([]byte, error) {
+	input := make(map[string]string, len(secrets))
+	for path, secret := range secrets {
+		input[path] = string(secret.Data)
+	}
+
+	output, err := inj.template.Inject(input)
+	if err != nil {
+		return nil, err
+	}
+
+	return inj.encoding.NewEncoder().Bytes([]byte(output))
 }
 
 // Sources returns the full paths of the secrets from which the Consumable is sourced.
@@ -3,9 +3,12 @@ package secretspec_test
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"syscall"
 	"testing"
 
 	"github.com/secrethub/secrethub-cli/internals/secretspec"
+	"github.com/secrethub/secrethub-cli/internals/tpl"
 
 	"github.com/secrethub/secrethub-go/internals/api"
 	"github.com/secrethub/secrethub-go/internals/assert"
@@ -107,3 +110,86 @@ func TestInjectSetClear(t *testing.T) {
 		t.Error("file still exists after presenter.Clear()")
 	}
 }
+
+func TestInjectInclude(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secretspec-include")
+	assert.OK(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		assert.OK(t, err)
+	}()
+
+	files := map[string]string{
+		"config.json":            "{\n\t{{ include \"partials/fields.json\" }}\n}",
+		"partials/fields.json":   "\"field1\": \"${ danny/example-repo/test_secret }\",\n\t{{ include \"field2.json\" }}\n",
+		"partials/field2.json":   "\"field2\": \"${ danny/example-repo/test_secret2 }\"\n",
+		"loop.json":              "{{ include \"loop.json\" }}",
+		"missing.json":           "\n{{ include \"partials/missing.json\" }}",
+		"unclosed.json":          "{\n\t\"field1\": \"{{ include \"partials/unclosed.json\" }} }\"\n}",
+		"partials/unclosed.json": "${ danny/example-repo/test_secret",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		err := os.MkdirAll(filepath.Dir(path), 0700)
+		assert.OK(t, err)
+		err = ioutil.WriteFile(path, []byte(content), 0600)
+		assert.OK(t, err)
+	}
+
+	cases := map[string]struct {
+		source   string
+		expected string
+		err      error
+	}{
+		"nested": {
+			source:   "config.json",
+			expected: "{\n\t\"field1\": \"test_secret_content\",\n\t\"field2\": \"test_secret_content2\"\n}",
+		},
+		"cycle": {
+			source: "loop.json",
+			err:    secretspec.ErrIncludeCycle(filepath.Join(dir, "loop.json"), filepath.Join(dir, "loop.json"), 1),
+		},
+		"file does not exist": {
+			source: "missing.json",
+			err: secretspec.ErrCannotInclude(
+				filepath.Join(dir, "partials/missing.json"),
+				filepath.Join(dir, "missing.json"),
+				2,
+				&os.PathError{Op: "open", Path: filepath.Join(dir, "partials/missing.json"), Err: syscall.ENOENT},
+			),
+		},
+		"tag not closed in included file": {
+			source: "unclosed.json",
+			err: secretspec.ErrIncludeFailed(
+				filepath.Join(dir, "partials/unclosed.json"),
+				filepath.Join(dir, "unclosed.json"),
+				2,
+				tpl.ErrTagNotClosed("}"),
+			),
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			target := filepath.Join(dir, "injected.json")
+			consumable, err := secretspec.InjectParser{}.Parse(testRootPath, true, map[string]interface{}{
+				"source": filepath.Join(dir, tc.source),
+				"target": target,
+			})
+			assert.Equal(t, err, tc.err)
+			if tc.err != nil {
+				return
+			}
+
+			err = consumable.Set(map[string]api.SecretVersion{
+				"danny/example-repo/test_secret":  testSecret1,
+				"danny/example-repo/test_secret2": testSecret2,
+			})
+			assert.OK(t, err)
+
+			actual, err := ioutil.ReadFile(target)
+			assert.OK(t, err)
+			assert.Equal(t, string(actual), tc.expected)
+		})
+	}
+}
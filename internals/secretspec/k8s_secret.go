@@ -0,0 +1,274 @@
+package secretspec
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/secrethub/secrethub-go/internals/api"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	fieldNamespace = "namespace"
+	fieldType      = "type"
+	fieldData      = "data"
+
+	defaultK8sSecretType = "Opaque"
+)
+
+// Errors
+var (
+	ErrInvalidK8sSecretName = errConsumption.Code("invalid_k8s_secret_name").ErrorPref("invalid name %s for a Kubernetes Secret: it must consist of lower case alphanumeric characters, '-' or '.' and be at most 253 characters long")
+	ErrInvalidK8sSecretKey  = errConsumption.Code("invalid_k8s_secret_key").ErrorPref("invalid data key %s for a Kubernetes Secret: it must consist of alphanumeric characters, '-', '_' or '.'")
+	ErrCannotEncodeManifest = errConsumption.Code("cannot_encode_manifest").ErrorPref("cannot encode the manifest of Kubernetes Secret %s: %v")
+)
+
+var (
+	k8sSecretNamePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+	k8sSecretKeyPattern  = regexp.MustCompile(`^[-._a-zA-Z0-9]+$`)
+)
+
+// K8sSecretParser is a Parser to parse Kubernetes Secret Consumables.
+type K8sSecretParser struct{}
+
+// Type returns the parser type.
+func (p K8sSecretParser) Type() string {
+	return "k8s-secret"
+}
+
+// Parse parses a config to create a Kubernetes Secret Consumable.
+func (p K8sSecretParser) Parse(rootPath string, allowMountAnywhere bool, config map[string]interface{}) (Consumable, error) {
+	name, ok := config[fieldName].(string)
+	if !ok {
+		return nil, ErrFieldNotSet(fieldName, name)
+	}
+
+	data, ok := config[fieldData].(map[interface{}]interface{})
+	if !ok {
+		return nil, ErrFieldNotSet(fieldData, data)
+	}
+
+	keys := make(map[string]string, len(data))
+	for key, val := range data {
+		source, ok := val.(string)
+		if !ok {
+			return nil, ErrCannotConvertField(key, val, source)
+		}
+
+		target, ok := key.(string)
+		if !ok {
+			return nil, ErrCannotConvertField(key, key, target)
+		}
+
+		keys[target] = source
+	}
+
+	namespace, _ := config[fieldNamespace].(string)
+	secretType, _ := config[fieldType].(string)
+	target, _ := config[fieldTarget].(string)
+
+	var filemode os.FileMode
+	var err error
+	mode, ok := config[fieldFilemode].(string)
+	if ok && mode != "" {
+		filemode, err = strToFileMode(mode)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	secret, err := newK8sSecret(name, namespace, secretType, target, filemode, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	secret.target, err = createTarget(rootPath, secret.target, allowMountAnywhere)
+	if err != nil {
+		return nil, err
+	}
+
+	return secret, nil
+}
+
+// k8sSecretKey is a data key of a Kubernetes Secret.
+type k8sSecretKey struct {
+	source string
+	target string
+}
+
+// k8sSecret implements a Consumable written to a file as the manifest of a Kubernetes Secret.
+type k8sSecret struct {
+	name       string
+	namespace  string
+	secretType string
+	target     string
+	filemode   os.FileMode
+	keys       []k8sSecretKey
+}
+
+// newK8sSecret creates a new Kubernetes Secret consumable with the given data keys mapped
+// to the paths of the secrets they are sourced from. When target is empty, it defaults to
+// the name of the Secret with a .yml extension. When the type is empty, it defaults to Opaque.
+// When filemode is empty, it defaults to the DefaultFileMode.
+func newK8sSecret(name, namespace, secretType, target string, filemode os.FileMode, keys map[string]string) (*k8sSecret, error) {
+	name = strings.TrimSpace(name)
+	if len(name) > 253 || !k8sSecretNamePattern.MatchString(name) {
+		return nil, ErrInvalidK8sSecretName(name)
+	}
+
+	secret := &k8sSecret{
+		name:       name,
+		namespace:  strings.TrimSpace(namespace),
+		secretType: strings.TrimSpace(secretType),
+		target:     target,
+		filemode:   filemode,
+		keys:       make([]k8sSecretKey, 0, len(keys)),
+	}
+
+	if secret.secretType == "" {
+		secret.secretType = defaultK8sSecretType
+	}
+
+	if secret.target == "" {
+		secret.target = name + ".yml"
+	}
+
+	if secret.filemode == 0 {
+		secret.filemode = DefaultFileMode
+	}
+
+	for target, source := range keys {
+		source = strings.ToLower(strings.TrimSpace(source))
+		err := api.ValidateSecretPath(source)
+		if err != nil {
+			return nil, ErrInvalidSourcePath(err)
+		}
+
+		target = strings.TrimSpace(target)
+		if !k8sSecretKeyPattern.MatchString(target) {
+			return nil, ErrInvalidK8sSecretKey(target)
+		}
+
+		secret.keys = append(secret.keys, k8sSecretKey{
+			source: source,
+			target: target,
+		})
+	}
+
+	// Keys are sorted for predictability and easy testing.
+	sort.Slice(secret.keys, func(i, j int) bool {
+		return secret.keys[i].target < secret.keys[j].target
+	})
+
+	return secret, nil
+}
+
+// k8sSecretManifest is the manifest of a Kubernetes Secret.
+type k8sSecretManifest struct {
+	APIVersion string            `yaml:"apiVersion"`
+	Kind       string            `yaml:"kind"`
+	Metadata   k8sSecretMetadata `yaml:"metadata"`
+	Type       string            `yaml:"type"`
+	Data       yaml.MapSlice     `yaml:"data"`
+}
+
+// k8sSecretMetadata is the metadata in the manifest of a Kubernetes Secret.
+type k8sSecretMetadata struct {
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace,omitempty"`
+}
+
+// Set writes the manifest of the Kubernetes Secret with the base64 encoded
+// values of the matching secrets in the given map to the target file.
+func (s *k8sSecret) Set(secrets map[string]api.SecretVersion) error {
+	log.Debugf("setting Kubernetes Secret: %s => %s (target)", s.name, s.target)
+
+	out, err := s.manifest(secrets)
+	if err != nil {
+		return err
+	}
+
+	return overwriteFile(s.target, out, s.filemode)
+}
+
+// Status compares the target file with the manifest of the Kubernetes Secret
+// with the values of the matching secrets in the given map.
+func (s *k8sSecret) Status(secrets map[string]api.SecretVersion) (Status, error) {
+	out, err := s.manifest(secrets)
+	if err != nil {
+		return "", err
+	}
+
+	return fileStatus(s.target, out, sourceVersions(s, secrets))
+}
+
+// manifest returns the manifest of the Kubernetes Secret with the base64
+// encoded values of the matching secrets in the given map.
+func (s *k8sSecret) manifest(secrets map[string]api.SecretVersion) ([]byte, error) {
+	manifest := k8sSecretManifest{
+		APIVersion: "v1",
+		Kind:       "Secret",
+		Metadata: k8sSecretMetadata{
+			Name:      s.name,
+			Namespace: s.namespace,
+		},
+		Type: s.secretType,
+		Data: make(yaml.MapSlice, len(s.keys)),
+	}
+
+	for i, key := range s.keys {
+		version, found := secrets[key.source]
+		if !found {
+			return nil, ErrSecretNotFound(key.source)
+		}
+
+		manifest.Data[i] = yaml.MapItem{
+			Key:   key.target,
+			Value: base64.StdEncoding.EncodeToString(version.Data),
+		}
+	}
+
+	out, err := yaml.Marshal(manifest)
+	if err != nil {
+		return nil, ErrCannotEncodeManifest(s.name, err)
+	}
+	return out, nil
+}
+
+// Clear removes the manifest from the filesystem.
+func (s *k8sSecret) Clear() error {
+	err := os.Remove(s.target)
+	if os.IsNotExist(err) {
+		log.Warningf("cannot clear file %s as it does not exist", s.target)
+		return nil
+	}
+	return err
+}
+
+// Sources returns the full paths of the secrets from which the consumable is sourced.
+func (s *k8sSecret) Sources() map[string]struct{} {
+	sources := make(map[string]struct{})
+	for _, key := range s.keys {
+		sources[key.source] = struct{}{}
+	}
+	return sources
+}
+
+// Equals checks whether two Kubernetes Secrets have the same target.
+func (s *k8sSecret) Equals(consumable Consumable) bool {
+	secretConsumable, ok := consumable.(*k8sSecret)
+	if !ok {
+		return false
+	}
+	return strings.EqualFold(secretConsumable.target, s.target)
+}
+
+// String returns the string representation of the Kubernetes Secret.
+func (s *k8sSecret) String() string {
+	return fmt.Sprintf("k8s-secret:%s", s.target)
+}
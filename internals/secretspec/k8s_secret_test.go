@@ -0,0 +1,156 @@
+package secretspec
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/secrethub/secrethub-go/internals/api"
+	"github.com/secrethub/secrethub-go/internals/assert"
+)
+
+func TestK8sSecretParse(t *testing.T) {
+	cases := map[string]struct {
+		config   map[string]interface{}
+		expected *k8sSecret
+		err      error
+	}{
+		"all values": {
+			config: map[string]interface{}{
+				"name":      "app-secrets",
+				"namespace": "prod",
+				"type":      "kubernetes.io/basic-auth",
+				"target":    "manifests/secret.yml",
+				"filemode":  "0600",
+				"data": map[interface{}]interface{}{
+					"username": "company/app/db/user",
+					"password": "company/app/db/password",
+				},
+			},
+			expected: &k8sSecret{
+				name:       "app-secrets",
+				namespace:  "prod",
+				secretType: "kubernetes.io/basic-auth",
+				target:     "/root/manifests/secret.yml",
+				filemode:   0600,
+				keys: []k8sSecretKey{
+					{source: "company/app/db/password", target: "password"},
+					{source: "company/app/db/user", target: "username"},
+				},
+			},
+		},
+		"defaults": {
+			config: map[string]interface{}{
+				"name": "app-secrets",
+				"data": map[interface{}]interface{}{
+					"DB_PASSWORD": "company/app/db/password",
+				},
+			},
+			expected: &k8sSecret{
+				name:       "app-secrets",
+				secretType: "Opaque",
+				target:     "/root/app-secrets.yml",
+				filemode:   DefaultFileMode,
+				keys: []k8sSecretKey{
+					{source: "company/app/db/password", target: "DB_PASSWORD"},
+				},
+			},
+		},
+		"name not set": {
+			config: map[string]interface{}{
+				"data": map[interface{}]interface{}{
+					"password": "company/app/db/password",
+				},
+			},
+			err: ErrFieldNotSet("name", ""),
+		},
+		"invalid name": {
+			config: map[string]interface{}{
+				"name": "App_Secrets",
+				"data": map[interface{}]interface{}{
+					"password": "company/app/db/password",
+				},
+			},
+			err: ErrInvalidK8sSecretName("App_Secrets"),
+		},
+		"invalid key": {
+			config: map[string]interface{}{
+				"name": "app-secrets",
+				"data": map[interface{}]interface{}{
+					"db/password": "company/app/db/password",
+				},
+			},
+			err: ErrInvalidK8sSecretKey("db/password"),
+		},
+		"target outside root": {
+			config: map[string]interface{}{
+				"name":   "app-secrets",
+				"target": "../secret.yml",
+				"data": map[interface{}]interface{}{
+					"password": "company/app/db/password",
+				},
+			},
+			err: ErrPathNotInRoot("/secret.yml", "/root"),
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			actual, err := K8sSecretParser{}.Parse("/root", false, tc.config)
+			assert.Equal(t, err, tc.err)
+			if tc.err == nil {
+				assert.Equal(t, actual, tc.expected)
+			}
+		})
+	}
+}
+
+func TestK8sSecretSetAndClear(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrethub-k8s-secret")
+	assert.OK(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		assert.OK(t, err)
+	}()
+
+	secret, err := newK8sSecret("app-secrets", "prod", "", filepath.Join(dir, "secret.yml"), 0, map[string]string{
+		"DB_PASSWORD": "company/app/db/password",
+		"api.key":     "company/app/api/key",
+	})
+	assert.OK(t, err)
+
+	err = secret.Set(map[string]api.SecretVersion{
+		"company/app/db/password": {Data: []byte("hunter2")},
+	})
+	assert.Equal(t, err, ErrSecretNotFound("company/app/api/key"))
+
+	err = secret.Set(map[string]api.SecretVersion{
+		"company/app/db/password": {Data: []byte("hunter2")},
+		"company/app/api/key":     {Data: []byte("key\n")},
+	})
+	assert.OK(t, err)
+
+	actual, err := ioutil.ReadFile(secret.target)
+	assert.OK(t, err)
+	expected := "apiVersion: v1\n" +
+		"kind: Secret\n" +
+		"metadata:\n" +
+		"  name: app-secrets\n" +
+		"  namespace: prod\n" +
+		"type: Opaque\n" +
+		"data:\n" +
+		"  DB_PASSWORD: aHVudGVyMg==\n" +
+		"  api.key: a2V5Cg==\n"
+	assert.Equal(t, string(actual), expected)
+
+	info, err := os.Stat(secret.target)
+	assert.OK(t, err)
+	assert.Equal(t, info.Mode().Perm(), DefaultFileMode)
+
+	err = secret.Clear()
+	assert.OK(t, err)
+
+	_, err = os.Stat(secret.target)
+	assert.Equal(t, os.IsNotExist(err), true)
+}
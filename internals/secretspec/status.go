@@ -0,0 +1,91 @@
+package secretspec
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+
+	"github.com/secrethub/secrethub-go/internals/api"
+)
+
+// Status is the state of a consumable on the system compared to the secrets it is sourced from.
+type Status string
+
+// Statuses of consumables, from the least to the most severe.
+const (
+	// StatusUpToDate means the consumable contains the given secrets.
+	StatusUpToDate Status = "up to date"
+	// StatusStale means the consumable was written before a newer version of its secrets was created.
+	StatusStale Status = "stale"
+	// StatusModified means the consumable was changed on the system after it was written.
+	StatusModified Status = "modified locally"
+	// StatusMissing means the consumable, or a part of it, does not exist on the system.
+	StatusMissing Status = "missing"
+)
+
+// severity returns how severe the status is, so that the status of a
+// consumable that consists of multiple files is that of its worst file.
+func (s Status) severity() int {
+	switch s {
+	case StatusUpToDate:
+		return 0
+	case StatusStale:
+		return 1
+	case StatusModified:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// combineStatus returns the most severe of the given statuses.
+func combineStatus(statuses ...Status) Status {
+	combined := StatusUpToDate
+	for _, status := range statuses {
+		if status.severity() > combined.severity() {
+			combined = status
+		}
+	}
+	return combined
+}
+
+// fileStatus compares the file at the given path with the contents it is expected to have.
+// When they differ, the file is stale when it was last modified before the newest of the
+// given secret versions was created. Otherwise, the file is modified locally.
+func fileStatus(path string, expected []byte, versions []api.SecretVersion) (Status, error) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return StatusMissing, nil
+	} else if err != nil {
+		return "", err
+	}
+
+	actual, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	if bytes.Equal(actual, expected) {
+		return StatusUpToDate, nil
+	}
+
+	for _, version := range versions {
+		if info.ModTime().Before(version.CreatedAt) {
+			return StatusStale, nil
+		}
+	}
+	return StatusModified, nil
+}
+
+// sourceVersions returns the versions of the secrets in the given map
+// from which the consumable is sourced.
+func sourceVersions(c Consumable, secrets map[string]api.SecretVersion) []api.SecretVersion {
+	var versions []api.SecretVersion
+	for source := range c.Sources() {
+		version, found := secrets[source]
+		if found {
+			versions = append(versions, version)
+		}
+	}
+	return versions
+}
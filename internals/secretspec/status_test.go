@@ -0,0 +1,101 @@
+package secretspec
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/secrethub/secrethub-go/internals/api"
+	"github.com/secrethub/secrethub-go/internals/assert"
+)
+
+func TestFileStatus(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrethub-status")
+	assert.OK(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		assert.OK(t, err)
+	}()
+
+	path := filepath.Join(dir, "secret")
+	err = ioutil.WriteFile(path, []byte("current"), 0600)
+	assert.OK(t, err)
+
+	modified := time.Now().Add(-time.Hour)
+	err = os.Chtimes(path, modified, modified)
+	assert.OK(t, err)
+
+	cases := map[string]struct {
+		path     string
+		expected []byte
+		versions []api.SecretVersion
+		status   Status
+	}{
+		"up to date": {
+			path:     path,
+			expected: []byte("current"),
+			versions: []api.SecretVersion{{CreatedAt: time.Now()}},
+			status:   StatusUpToDate,
+		},
+		"stale": {
+			path:     path,
+			expected: []byte("new"),
+			versions: []api.SecretVersion{{CreatedAt: modified.Add(-time.Hour)}, {CreatedAt: modified.Add(time.Minute)}},
+			status:   StatusStale,
+		},
+		"modified locally": {
+			path:     path,
+			expected: []byte("new"),
+			versions: []api.SecretVersion{{CreatedAt: modified.Add(-time.Minute)}},
+			status:   StatusModified,
+		},
+		"missing": {
+			path:     filepath.Join(dir, "missing"),
+			expected: []byte("new"),
+			status:   StatusMissing,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			status, err := fileStatus(tc.path, tc.expected, tc.versions)
+			assert.OK(t, err)
+			assert.Equal(t, status, tc.status)
+		})
+	}
+}
+
+func TestCombineStatus(t *testing.T) {
+	cases := map[string]struct {
+		statuses []Status
+		expected Status
+	}{
+		"none": {
+			expected: StatusUpToDate,
+		},
+		"all up to date": {
+			statuses: []Status{StatusUpToDate, StatusUpToDate},
+			expected: StatusUpToDate,
+		},
+		"stale": {
+			statuses: []Status{StatusUpToDate, StatusStale},
+			expected: StatusStale,
+		},
+		"modified over stale": {
+			statuses: []Status{StatusModified, StatusStale},
+			expected: StatusModified,
+		},
+		"missing over modified": {
+			statuses: []Status{StatusModified, StatusMissing, StatusUpToDate},
+			expected: StatusMissing,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, combineStatus(tc.statuses...), tc.expected)
+		})
+	}
+}
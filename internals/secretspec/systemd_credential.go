@@ -0,0 +1,303 @@
+package secretspec
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/secrethub/secrethub-cli/internals/cli/validation"
+	"github.com/secrethub/secrethub-go/internals/api"
+)
+
+const (
+	fieldFormat      = "format"
+	fieldCredentials = "credentials"
+
+	// credentialFormatDirectory writes every credential to a file in a directory,
+	// to be loaded with LoadCredential=.
+	credentialFormatDirectory = "directory"
+	// credentialFormatEnvFile writes the credentials to a file with environment
+	// variables, to be loaded with EnvironmentFile=.
+	credentialFormatEnvFile = "env-file"
+)
+
+var (
+	// DefaultCredentialDirFileMode is the filemode used for directories of systemd credentials.
+	DefaultCredentialDirFileMode os.FileMode = 0700
+)
+
+// Errors
+var (
+	ErrUnknownCredentialFormat = errConsumption.Code("unknown_credential_format").ErrorPref("unknown format %s for systemd credentials: supported formats are directory and env-file")
+	ErrInvalidCredentialName   = errConsumption.Code("invalid_credential_name").ErrorPref("invalid systemd credential name %s: it must consist of alphanumeric characters, '-', '_' or '.'")
+	ErrCannotCreateCredentials = errConsumption.Code("cannot_create_credentials").ErrorPref("could not create the directory for systemd credentials %s: %v")
+	ErrCannotClearCredentials  = errConsumption.Code("cannot_clear_credentials").ErrorPref("the systemd credentials could not be cleared: %s")
+)
+
+var credentialNamePattern = regexp.MustCompile(`^[-._a-zA-Z0-9]+$`)
+
+// SystemdCredentialParser is a Parser to parse systemd credential Consumables.
+type SystemdCredentialParser struct{}
+
+// Type returns the parser type.
+func (p SystemdCredentialParser) Type() string {
+	return "systemd-credential"
+}
+
+// Parse parses a config to create a systemd credential Consumable.
+func (p SystemdCredentialParser) Parse(rootPath string, allowMountAnywhere bool, config map[string]interface{}) (Consumable, error) {
+	target, ok := config[fieldTarget].(string)
+	if !ok || target == "" {
+		return nil, ErrFieldNotSet(fieldTarget, target)
+	}
+
+	credentials, ok := config[fieldCredentials].(map[interface{}]interface{})
+	if !ok {
+		return nil, ErrFieldNotSet(fieldCredentials, credentials)
+	}
+
+	names := make(map[string]string, len(credentials))
+	for key, val := range credentials {
+		source, ok := val.(string)
+		if !ok {
+			return nil, ErrCannotConvertField(key, val, source)
+		}
+
+		name, ok := key.(string)
+		if !ok {
+			return nil, ErrCannotConvertField(key, key, name)
+		}
+
+		names[name] = source
+	}
+
+	format, _ := config[fieldFormat].(string)
+
+	var filemode os.FileMode
+	var err error
+	mode, ok := config[fieldFilemode].(string)
+	if ok && mode != "" {
+		filemode, err = strToFileMode(mode)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	credential, err := newSystemdCredential(format, target, filemode, names)
+	if err != nil {
+		return nil, err
+	}
+
+	credential.target, err = createTarget(rootPath, credential.target, allowMountAnywhere)
+	if err != nil {
+		return nil, err
+	}
+
+	return credential, nil
+}
+
+// credential is a systemd credential or an environment variable in an environment file.
+type credential struct {
+	source string
+	name   string
+}
+
+// systemdCredential implements a Consumable that writes credentials for a systemd service,
+// either as a directory with a file per credential or as an environment file.
+type systemdCredential struct {
+	format      string
+	target      string
+	filemode    os.FileMode
+	credentials []credential
+}
+
+// newSystemdCredential creates a new systemd credential consumable with the given names
+// mapped to the paths of the secrets they are sourced from. When the format is empty,
+// it defaults to a directory. When filemode is empty, it defaults to the DefaultFileMode.
+func newSystemdCredential(format, target string, filemode os.FileMode, names map[string]string) (*systemdCredential, error) {
+	format = strings.TrimSpace(format)
+	if format == "" {
+		format = credentialFormatDirectory
+	}
+	if format != credentialFormatDirectory && format != credentialFormatEnvFile {
+		return nil, ErrUnknownCredentialFormat(format)
+	}
+
+	if filemode == 0 {
+		filemode = DefaultFileMode
+	}
+
+	c := &systemdCredential{
+		format:      format,
+		target:      target,
+		filemode:    filemode,
+		credentials: make([]credential, 0, len(names)),
+	}
+
+	for name, source := range names {
+		source = strings.ToLower(strings.TrimSpace(source))
+		err := api.ValidateSecretPath(source)
+		if err != nil {
+			return nil, ErrInvalidSourcePath(err)
+		}
+
+		name = strings.TrimSpace(name)
+		if format == credentialFormatEnvFile {
+			err = validation.ValidateEnvarName(name)
+			if err != nil {
+				return nil, err
+			}
+		} else if name == "." || name == ".." || !credentialNamePattern.MatchString(name) {
+			return nil, ErrInvalidCredentialName(name)
+		}
+
+		c.credentials = append(c.credentials, credential{
+			source: source,
+			name:   name,
+		})
+	}
+
+	// Credentials are sorted for predictability and easy testing.
+	sort.Slice(c.credentials, func(i, j int) bool {
+		return c.credentials[i].name < c.credentials[j].name
+	})
+
+	return c, nil
+}
+
+// Set writes the matching secrets in the given map to the credentials directory
+// or to the environment file.
+func (c *systemdCredential) Set(secrets map[string]api.SecretVersion) error {
+	log.Debugf("setting systemd credentials: %s (target)", c.target)
+
+	if c.format == credentialFormatEnvFile {
+		out, err := c.envFile(secrets)
+		if err != nil {
+			return err
+		}
+		return overwriteFile(c.target, out, c.filemode)
+	}
+
+	err := os.MkdirAll(c.target, DefaultCredentialDirFileMode)
+	if err != nil {
+		return ErrCannotCreateCredentials(c.target, err)
+	}
+
+	err = os.Chmod(c.target, DefaultCredentialDirFileMode)
+	if err != nil {
+		return ErrCannotCreateCredentials(c.target, err)
+	}
+
+	for _, cred := range c.credentials {
+		version, found := secrets[cred.source]
+		if !found {
+			return ErrSecretNotFound(cred.source)
+		}
+
+		err = overwriteFile(filepath.Join(c.target, cred.name), version.Data, c.filemode)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Status compares the environment file or the credential files with the matching secrets in the given map.
+func (c *systemdCredential) Status(secrets map[string]api.SecretVersion) (Status, error) {
+	if c.format == credentialFormatEnvFile {
+		out, err := c.envFile(secrets)
+		if err != nil {
+			return "", err
+		}
+		return fileStatus(c.target, out, sourceVersions(c, secrets))
+	}
+
+	statuses := make([]Status, len(c.credentials))
+	for i, cred := range c.credentials {
+		version, found := secrets[cred.source]
+		if !found {
+			return "", ErrSecretNotFound(cred.source)
+		}
+
+		status, err := fileStatus(filepath.Join(c.target, cred.name), version.Data, []api.SecretVersion{version})
+		if err != nil {
+			return "", err
+		}
+		statuses[i] = status
+	}
+	return combineStatus(statuses...), nil
+}
+
+// envFile returns the environment file with the values of the matching secrets in the given map.
+func (c *systemdCredential) envFile(secrets map[string]api.SecretVersion) ([]byte, error) {
+	var out strings.Builder
+	for _, cred := range c.credentials {
+		version, found := secrets[cred.source]
+		if !found {
+			return nil, ErrSecretNotFound(cred.source)
+		}
+		fmt.Fprintf(&out, "%s=\"%s\"\n", cred.name, escapeEnvFileValue(string(version.Data)))
+	}
+	return []byte(out.String()), nil
+}
+
+// Clear removes the environment file or the credential files from the filesystem.
+// The credentials directory is only removed when it is empty afterwards.
+func (c *systemdCredential) Clear() error {
+	if c.format == credentialFormatEnvFile {
+		err := os.Remove(c.target)
+		if os.IsNotExist(err) {
+			log.Warningf("cannot clear file %s as it does not exist", c.target)
+			return nil
+		}
+		return err
+	}
+
+	for _, cred := range c.credentials {
+		err := os.Remove(filepath.Join(c.target, cred.name))
+		if err != nil && !os.IsNotExist(err) {
+			return ErrCannotClearCredentials(err)
+		}
+	}
+
+	err := os.Remove(c.target)
+	if err != nil && !os.IsNotExist(err) {
+		log.Debugf("not removing credentials directory %s: %v", c.target, err)
+	}
+	return nil
+}
+
+// Sources returns the full paths of the secrets from which the consumable is sourced.
+func (c *systemdCredential) Sources() map[string]struct{} {
+	sources := make(map[string]struct{})
+	for _, cred := range c.credentials {
+		sources[cred.source] = struct{}{}
+	}
+	return sources
+}
+
+// Equals checks whether two systemd credential consumables have the same target.
+func (c *systemdCredential) Equals(consumable Consumable) bool {
+	credentialConsumable, ok := consumable.(*systemdCredential)
+	if !ok {
+		return false
+	}
+	return strings.EqualFold(credentialConsumable.target, c.target)
+}
+
+// String returns the string representation of the systemd credential consumable.
+func (c *systemdCredential) String() string {
+	return fmt.Sprintf("systemd-credential:%s", c.target)
+}
+
+// envFileEscaper escapes the characters that have a special meaning
+// in a double quoted value of a systemd environment file.
+var envFileEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "`", "\\`", `$`, `\$`)
+
+// escapeEnvFileValue escapes the value to be double quoted in a systemd environment file.
+func escapeEnvFileValue(value string) string {
+	return envFileEscaper.Replace(value)
+}
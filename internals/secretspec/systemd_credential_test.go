@@ -0,0 +1,213 @@
+package secretspec
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/secrethub/secrethub-cli/internals/cli/validation"
+
+	"github.com/secrethub/secrethub-go/internals/api"
+	"github.com/secrethub/secrethub-go/internals/assert"
+)
+
+func TestSystemdCredentialParse(t *testing.T) {
+	cases := map[string]struct {
+		config   map[string]interface{}
+		expected *systemdCredential
+		err      error
+	}{
+		"directory": {
+			config: map[string]interface{}{
+				"target": "credentials",
+				"credentials": map[interface{}]interface{}{
+					"db.password": "company/app/db/password",
+					"api-key":     "company/app/api/key",
+				},
+			},
+			expected: &systemdCredential{
+				format:   "directory",
+				target:   "/root/credentials",
+				filemode: DefaultFileMode,
+				credentials: []credential{
+					{source: "company/app/api/key", name: "api-key"},
+					{source: "company/app/db/password", name: "db.password"},
+				},
+			},
+		},
+		"env-file": {
+			config: map[string]interface{}{
+				"target":   "app.env",
+				"format":   "env-file",
+				"filemode": "0600",
+				"credentials": map[interface{}]interface{}{
+					"DB_PASSWORD": "company/app/db/password",
+				},
+			},
+			expected: &systemdCredential{
+				format:   "env-file",
+				target:   "/root/app.env",
+				filemode: 0600,
+				credentials: []credential{
+					{source: "company/app/db/password", name: "DB_PASSWORD"},
+				},
+			},
+		},
+		"target not set": {
+			config: map[string]interface{}{
+				"credentials": map[interface{}]interface{}{
+					"password": "company/app/db/password",
+				},
+			},
+			err: ErrFieldNotSet("target", ""),
+		},
+		"unknown format": {
+			config: map[string]interface{}{
+				"target": "credentials",
+				"format": "json",
+				"credentials": map[interface{}]interface{}{
+					"password": "company/app/db/password",
+				},
+			},
+			err: ErrUnknownCredentialFormat("json"),
+		},
+		"invalid credential name": {
+			config: map[string]interface{}{
+				"target": "credentials",
+				"credentials": map[interface{}]interface{}{
+					"..": "company/app/db/password",
+				},
+			},
+			err: ErrInvalidCredentialName(".."),
+		},
+		"invalid environment variable": {
+			config: map[string]interface{}{
+				"target": "app.env",
+				"format": "env-file",
+				"credentials": map[interface{}]interface{}{
+					"DB=PASSWORD": "company/app/db/password",
+				},
+			},
+			err: validation.ErrInvalidEnvarName("DB=PASSWORD"),
+		},
+		"target outside root": {
+			config: map[string]interface{}{
+				"target": "/etc/credentials",
+				"credentials": map[interface{}]interface{}{
+					"password": "company/app/db/password",
+				},
+			},
+			err: ErrPathNotInRoot("/etc/credentials", "/root"),
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			actual, err := SystemdCredentialParser{}.Parse("/root", false, tc.config)
+			assert.Equal(t, err, tc.err)
+			if tc.err == nil {
+				assert.Equal(t, actual, tc.expected)
+			}
+		})
+	}
+}
+
+func TestSystemdCredentialSetAndClear(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrethub-systemd-credential")
+	assert.OK(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		assert.OK(t, err)
+	}()
+
+	secrets := map[string]api.SecretVersion{
+		"company/app/db/password": {Data: []byte("p@ss\"$word\\")},
+		"company/app/api/key":     {Data: []byte("multi\nline")},
+	}
+
+	t.Run("directory", func(t *testing.T) {
+		target := filepath.Join(dir, "credentials")
+		c, err := newSystemdCredential("", target, 0, map[string]string{
+			"db.password": "company/app/db/password",
+			"api-key":     "company/app/api/key",
+		})
+		assert.OK(t, err)
+
+		err = c.Set(secrets)
+		assert.OK(t, err)
+
+		info, err := os.Stat(target)
+		assert.OK(t, err)
+		assert.Equal(t, info.Mode().Perm(), DefaultCredentialDirFileMode)
+
+		for name, expected := range map[string]string{
+			"db.password": "p@ss\"$word\\",
+			"api-key":     "multi\nline",
+		} {
+			path := filepath.Join(target, name)
+			actual, err := ioutil.ReadFile(path)
+			assert.OK(t, err)
+			assert.Equal(t, string(actual), expected)
+
+			info, err := os.Stat(path)
+			assert.OK(t, err)
+			assert.Equal(t, info.Mode().Perm(), DefaultFileMode)
+		}
+
+		err = c.Clear()
+		assert.OK(t, err)
+
+		_, err = os.Stat(target)
+		assert.Equal(t, os.IsNotExist(err), true)
+	})
+
+	t.Run("directory with other files", func(t *testing.T) {
+		target := filepath.Join(dir, "shared")
+		c, err := newSystemdCredential("directory", target, 0, map[string]string{
+			"api-key": "company/app/api/key",
+		})
+		assert.OK(t, err)
+
+		err = c.Set(secrets)
+		assert.OK(t, err)
+
+		other := filepath.Join(target, "other")
+		err = ioutil.WriteFile(other, []byte("other"), 0600)
+		assert.OK(t, err)
+
+		err = c.Clear()
+		assert.OK(t, err)
+
+		_, err = os.Stat(filepath.Join(target, "api-key"))
+		assert.Equal(t, os.IsNotExist(err), true)
+		_, err = os.Stat(other)
+		assert.OK(t, err)
+	})
+
+	t.Run("env-file", func(t *testing.T) {
+		target := filepath.Join(dir, "app.env")
+		c, err := newSystemdCredential("env-file", target, 0600, map[string]string{
+			"DB_PASSWORD": "company/app/db/password",
+			"API_KEY":     "company/app/api/key",
+		})
+		assert.OK(t, err)
+
+		err = c.Set(secrets)
+		assert.OK(t, err)
+
+		actual, err := ioutil.ReadFile(target)
+		assert.OK(t, err)
+		assert.Equal(t, string(actual), "API_KEY=\"multi\nline\"\nDB_PASSWORD=\"p@ss\\\"\\$word\\\\\"\n")
+
+		info, err := os.Stat(target)
+		assert.OK(t, err)
+		assert.Equal(t, info.Mode().Perm(), os.FileMode(0600))
+
+		err = c.Clear()
+		assert.OK(t, err)
+
+		_, err = os.Stat(target)
+		assert.Equal(t, os.IsNotExist(err), true)
+	})
+}
@@ -0,0 +1,71 @@
+package tpl
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// Includer reads the files that are included in a file. Relative paths are resolved
+// relative to the directory of the including file. It keeps track of the files that
+// include each other, so that files that include themselves can be detected.
+type Includer struct {
+	file string
+	// stack contains the absolute paths of the file and the files that include it.
+	stack []string
+}
+
+// NewIncluder returns an Includer for the files that are included in the file at the given
+// path. When the path is empty, included files are read relative to the working directory.
+func NewIncluder(file string) Includer {
+	includer := Includer{file: file}
+	if file != "" {
+		includer.stack = []string{absPath(file)}
+	}
+	return includer
+}
+
+// File returns the path of the file.
+func (i Includer) File() string {
+	return i.file
+}
+
+// Include returns the Includer of the file at the given path that is included in the file.
+// When the included file includes itself, directly or through other files, ok is false.
+func (i Includer) Include(path string) (included Includer, ok bool) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(i.file), path)
+	}
+
+	abs := absPath(path)
+	for _, f := range i.stack {
+		if f == abs {
+			return Includer{file: path}, false
+		}
+	}
+
+	return Includer{
+		file:  path,
+		stack: append(append([]string{}, i.stack...), abs),
+	}, true
+}
+
+// Read reads the contents of the file. The newline at the end of the file is left out,
+// so that an include tag on a line of its own does not leave an empty line in the output.
+func (i Includer) Read() ([]byte, error) {
+	raw, err := ioutil.ReadFile(i.file)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(raw, []byte("\n")), nil
+}
+
+// absPath returns the absolute representation of the path, or the cleaned path
+// when it cannot be made absolute.
+func absPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.Clean(path)
+	}
+	return abs
+}
@@ -0,0 +1,76 @@
+package tpl
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/secrethub/secrethub-go/internals/assert"
+)
+
+func TestIncluder_Include(t *testing.T) {
+	dir, err := filepath.Abs("app")
+	assert.OK(t, err)
+
+	cases := map[string]struct {
+		includer Includer
+		includes []string
+		expected string
+		ok       bool
+	}{
+		"relative to file": {
+			includer: NewIncluder(filepath.Join(dir, "config.tpl")),
+			includes: []string{"partials/db.tpl"},
+			expected: filepath.Join(dir, "partials", "db.tpl"),
+			ok:       true,
+		},
+		"relative to included file": {
+			includer: NewIncluder(filepath.Join(dir, "config.tpl")),
+			includes: []string{"partials/db.tpl", "../user.tpl"},
+			expected: filepath.Join(dir, "user.tpl"),
+			ok:       true,
+		},
+		"absolute": {
+			includer: NewIncluder(filepath.Join(dir, "config.tpl")),
+			includes: []string{filepath.Join(dir, "db.tpl")},
+			expected: filepath.Join(dir, "db.tpl"),
+			ok:       true,
+		},
+		"no file": {
+			includer: NewIncluder(""),
+			includes: []string{"db.tpl"},
+			expected: "db.tpl",
+			ok:       true,
+		},
+		"includes itself": {
+			includer: NewIncluder(filepath.Join(dir, "config.tpl")),
+			includes: []string{"config.tpl"},
+			expected: filepath.Join(dir, "config.tpl"),
+			ok:       false,
+		},
+		"cycle": {
+			includer: NewIncluder(filepath.Join(dir, "config.tpl")),
+			includes: []string{"partials/db.tpl", "../config.tpl"},
+			expected: filepath.Join(dir, "config.tpl"),
+			ok:       false,
+		},
+		"same file twice": {
+			includer: NewIncluder(filepath.Join(dir, "config.tpl")),
+			includes: []string{"partials/db.tpl", "user.tpl"},
+			expected: filepath.Join(dir, "partials", "user.tpl"),
+			ok:       true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			includer := tc.includer
+			ok := true
+			for _, path := range tc.includes {
+				includer, ok = includer.Include(path)
+			}
+
+			assert.Equal(t, includer.File(), tc.expected)
+			assert.Equal(t, ok, tc.ok)
+		})
+	}
+}